@@ -4,7 +4,7 @@
 [![Test](https://github.com/bsm/openmetrics/actions/workflows/test.yml/badge.svg)](https://github.com/bsm/openmetrics/actions/workflows/test.yml)
 [![License](https://img.shields.io/badge/License-Apache%202.0-blue.svg)](https://opensource.org/licenses/Apache-2.0)
 
-OpenMetrics is a standalone, dependency-free implementation of [OpenMetrics v1.0](https://github.com/OpenObservability/OpenMetrics/blob/main/specification/OpenMetrics.md) specification for [Go](https://golang.org/).
+OpenMetrics is a standalone implementation of [OpenMetrics v1.0](https://github.com/OpenObservability/OpenMetrics/blob/main/specification/OpenMetrics.md) specification for [Go](https://golang.org/). The core package is dependency-free. Only [omhttp](./omhttp/) and [omremote](./omremote/) depend on [klauspost/compress](https://github.com/klauspost/compress), for zstd and snappy support, and omhttp also depends on [golang.org/x/crypto](https://pkg.go.dev/golang.org/x/crypto/bcrypt) for bcrypt.
 
 ## Example
 
@@ -0,0 +1,78 @@
+// Command omlint checks OpenMetrics text documents for violations of naming
+// conventions and best practices.
+//
+// Usage:
+//
+//	omlint [flags] [file ...]
+//
+// Documents are read from the given files or from stdin. The exit status is 1
+// if issues were found and 2 if a document could not be read or parsed.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/bsm/openmetrics/omlint"
+)
+
+func main() {
+	var opts omlint.Options
+	var disable string
+	flag.IntVar(&opts.MaxSeries, "max-series", 1000, "maximum number of series per family")
+	flag.IntVar(&opts.MaxLabelValues, "max-label-values", 100, "maximum number of distinct values per label")
+	flag.StringVar(&disable, "disable", "", "comma-separated list of rules to disable")
+	flag.Parse()
+
+	for _, rule := range strings.Split(disable, ",") {
+		if rule = strings.TrimSpace(rule); rule != "" {
+			opts.Disable = append(opts.Disable, omlint.Rule(rule))
+		}
+	}
+
+	status, err := run(os.Stdout, flag.Args(), &opts)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "omlint:", err)
+	}
+	os.Exit(status)
+}
+
+func run(w io.Writer, names []string, opts *omlint.Options) (int, error) {
+	if len(names) == 0 {
+		names = []string{"-"}
+	}
+
+	status := 0
+	for _, name := range names {
+		diags, err := lintFile(name, opts)
+		if err != nil {
+			return 2, err
+		}
+		for _, d := range diags {
+			fmt.Fprintf(w, "%s: %s\n", name, d)
+			status = 1
+		}
+	}
+	return status, nil
+}
+
+func lintFile(name string, opts *omlint.Options) ([]omlint.Diagnostic, error) {
+	var r io.Reader = os.Stdin
+	if name != "-" {
+		f, err := os.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	diags, err := omlint.LintDocument(r, opts)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return diags, nil
+}
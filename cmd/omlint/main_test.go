@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bsm/openmetrics/omlint"
+)
+
+func TestRun(t *testing.T) {
+	dir := t.TempDir()
+	good := filepath.Join(dir, "good.txt")
+	bad := filepath.Join(dir, "bad.txt")
+	invalid := filepath.Join(dir, "invalid.txt")
+	writeFile(t, good, "# TYPE jobs counter\n# HELP jobs Total \\\"jobs\\\".\njobs_total 1\n# EOF\n")
+	writeFile(t, bad, "# TYPE jobs counter\njobs_total 1\n# EOF\n")
+	writeFile(t, invalid, "# TYPE jobs counter\njobs_total 1\n")
+
+	var buf bytes.Buffer
+	if status, err := run(&buf, []string{good}, &omlint.Options{}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	} else if exp, got := 0, status; exp != got {
+		t.Fatalf("expected %v, got %v", exp, got)
+	}
+	if exp, got := "", buf.String(); exp != got {
+		t.Fatalf("expected %q, got %q", exp, got)
+	}
+
+	if status, err := run(&buf, []string{good, bad}, &omlint.Options{}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	} else if exp, got := 1, status; exp != got {
+		t.Fatalf("expected %v, got %v", exp, got)
+	}
+	if exp, got := bad+": jobs: missing help text (missing-help)\n", buf.String(); exp != got {
+		t.Fatalf("expected %q, got %q", exp, got)
+	}
+
+	buf.Reset()
+	if status, _ := run(&buf, []string{bad}, &omlint.Options{Disable: []omlint.Rule{omlint.RuleMissingHelp}}); status != 0 {
+		t.Fatalf("expected no issues, got %q", buf.String())
+	}
+
+	status, err := run(&buf, []string{invalid}, &omlint.Options{})
+	if exp, got := 2, status; exp != got {
+		t.Fatalf("expected %v, got %v", exp, got)
+	}
+	if err == nil || !strings.HasPrefix(err.Error(), invalid+": ") {
+		t.Fatalf("expected parse error, got %v", err)
+	}
+}
+
+func writeFile(t *testing.T, name, data string) {
+	t.Helper()
+
+	if err := os.WriteFile(name, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,178 @@
+// Command omtool validates OpenMetrics text documents and converts them to
+// other exposition formats.
+//
+// Usage:
+//
+//	omtool validate [flags] [file|url ...]
+//	omtool convert [flags] [file|url]
+//
+// Documents are read from files, http(s) URLs or stdin if no argument or "-"
+// is given. The validate command checks documents against the OpenMetrics
+// specification and reports violations with their line numbers. The convert
+// command writes the document to stdout in the format given by -format:
+//
+//	prometheus  Prometheus text format 0.0.4 (default)
+//	json        JSON, see openmetrics.WriteJSON
+//	protobuf    delimited Prometheus protobuf messages
+//
+// The exit status is 1 if a document is invalid and 2 on other errors.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/bsm/openmetrics"
+)
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+	if flag.NArg() == 0 {
+		usage()
+		os.Exit(2)
+	}
+
+	var err error
+	switch cmd, args := flag.Arg(0), flag.Args()[1:]; cmd {
+	case "validate":
+		err = validate(os.Stdout, args)
+	case "convert":
+		err = convert(args)
+	default:
+		usage()
+		os.Exit(2)
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "omtool:", err)
+
+		var perr *openmetrics.ParseError
+		if errors.As(err, &perr) {
+			os.Exit(1)
+		}
+		os.Exit(2)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "Usage:")
+	fmt.Fprintln(os.Stderr, "  omtool validate [flags] [file|url ...]")
+	fmt.Fprintln(os.Stderr, "  omtool convert [flags] [file|url]")
+	fmt.Fprintln(os.Stderr, "Run 'omtool <command> -h' for command flags.")
+}
+
+func validate(w io.Writer, args []string) error {
+	fs := flag.NewFlagSet("validate", flag.ExitOnError)
+	timeout := fs.Duration("timeout", 10*time.Second, "timeout for fetching URLs")
+	_ = fs.Parse(args)
+
+	names := fs.Args()
+	if len(names) == 0 {
+		names = []string{"-"}
+	}
+
+	var invalid error
+	for _, name := range names {
+		fams, err := load(name, *timeout)
+		var perr *openmetrics.ParseError
+		if errors.As(err, &perr) {
+			fmt.Fprintf(w, "%s: %v\n", name, err)
+			invalid = err
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		series := 0
+		for _, fam := range fams {
+			series += len(fam.Series)
+		}
+		fmt.Fprintf(w, "%s: ok (%d families, %d series)\n", name, len(fams), series)
+	}
+	if invalid != nil {
+		return fmt.Errorf("invalid documents: %w", invalid)
+	}
+	return nil
+}
+
+func convert(args []string) error {
+	fs := flag.NewFlagSet("convert", flag.ExitOnError)
+	format := fs.String("format", "prometheus", "output format: prometheus, json or protobuf")
+	createdAsGauge := fs.Bool("created-as-gauge", false, "expose _created points as gauges in prometheus format")
+	timeout := fs.Duration("timeout", 10*time.Second, "timeout for fetching URLs")
+	_ = fs.Parse(args)
+
+	if fs.NArg() > 1 {
+		return fmt.Errorf("convert accepts a single document, got %d", fs.NArg())
+	}
+	name := fs.Arg(0)
+	if name == "" {
+		name = "-"
+	}
+
+	fams, err := load(name, *timeout)
+	if err != nil {
+		return err
+	}
+
+	switch *format {
+	case "prometheus":
+		_, err = openmetrics.WritePrometheus(os.Stdout, fams, &openmetrics.PrometheusOptions{CreatedAsGauge: *createdAsGauge})
+	case "json":
+		_, err = openmetrics.WriteJSON(os.Stdout, fams)
+	case "protobuf":
+		_, err = os.Stdout.Write(appendProto(nil, fams))
+	default:
+		err = fmt.Errorf("unknown format %q", *format)
+	}
+	return err
+}
+
+// load parses a document from a file, URL or stdin.
+func load(name string, timeout time.Duration) ([]openmetrics.FamilySnapshot, error) {
+	switch {
+	case name == "-":
+		return openmetrics.Parse(os.Stdin)
+	case strings.HasPrefix(name, "http://"), strings.HasPrefix(name, "https://"):
+		return fetch(name, timeout)
+	}
+
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return openmetrics.Parse(f)
+}
+
+func fetch(url string, timeout time.Duration) ([]openmetrics.FamilySnapshot, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/openmetrics-text; version=1.0.0; charset=utf-8")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return nil, fmt.Errorf("GET %s: unexpected status %s", url, resp.Status)
+	}
+	return openmetrics.Parse(resp.Body)
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/bsm/openmetrics"
+)
+
+func TestValidate(t *testing.T) {
+	dir := t.TempDir()
+	examples := []struct {
+		Name, Doc string
+		Line      int
+	}{
+		{"good.txt", "# TYPE jobs counter\njobs_total 1\n# EOF\n", 0},
+		{"duplicate.txt", "# TYPE temp gauge\ntemp 1\ntemp 2\n# EOF\n", 3},
+		{"interleaved.txt", "temp{a=\"x\"} 1\ntemp{a=\"y\"} 1\ntemp{a=\"x\"} 2\n# EOF\n", 3},
+		{"buckets.txt", "# TYPE lat histogram\nlat_bucket{le=\"1\"} 5\nlat_bucket{le=\"+Inf\"} 3\n# EOF\n", 3},
+		{"no_inf.txt", "# TYPE lat histogram\nlat_bucket{le=\"1\"} 1\nlat_count 1\nlat_sum 1\n# EOF\n", 4},
+		{"count.txt", "# TYPE lat histogram\nlat_bucket{le=\"+Inf\"} 2\nlat_count 1\n# EOF\n", 3},
+	}
+
+	var names []string
+	for _, x := range examples {
+		name := filepath.Join(dir, x.Name)
+		if err := os.WriteFile(name, []byte(x.Doc), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, name)
+	}
+
+	var buf bytes.Buffer
+	err := validate(&buf, names)
+	var perr *openmetrics.ParseError
+	if !errors.As(err, &perr) {
+		t.Fatalf("expected parse error, got %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if exp, got := len(examples), len(lines); exp != got {
+		t.Fatalf("expected %v, got %v:\n%s", exp, got, buf.String())
+	}
+	for i, x := range examples {
+		prefix := names[i] + ": ok"
+		if x.Line != 0 {
+			prefix = names[i] + ": line " + strconv.Itoa(x.Line) + ": "
+		}
+		if !strings.HasPrefix(lines[i], prefix) {
+			t.Errorf("expected %q to start with %q", lines[i], prefix)
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"encoding/binary"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/bsm/openmetrics"
+	"github.com/bsm/openmetrics/internal/protowire"
+)
+
+// Prometheus MetricType enum values, see io.prometheus.client.MetricType.
+const (
+	protoCounter        = 0
+	protoGauge          = 1
+	protoSummary        = 2
+	protoUntyped        = 3
+	protoHistogram      = 4
+	protoGaugeHistogram = 5
+)
+
+// appendProto appends a length-delimited io.prometheus.client.MetricFamily
+// message for each non-empty family.
+func appendProto(dst []byte, fams []openmetrics.FamilySnapshot) []byte {
+	var msg []byte
+	for i := range fams {
+		fam := &fams[i]
+		if len(fam.Series) == 0 {
+			continue
+		}
+
+		msg = appendFamily(msg[:0], fam)
+		dst = binary.AppendUvarint(dst, uint64(len(msg)))
+		dst = append(dst, msg...)
+	}
+	return dst
+}
+
+func appendFamily(b []byte, fam *openmetrics.FamilySnapshot) []byte {
+	name := fam.Desc.FullName()
+	typ := protoUntyped
+	switch fam.Type {
+	case openmetrics.CounterType:
+		name += openmetrics.SuffixTotal.String()
+		typ = protoCounter
+	case openmetrics.GaugeType, openmetrics.StateSetType:
+		typ = protoGauge
+	case openmetrics.InfoType:
+		name += openmetrics.SuffixInfo.String()
+		typ = protoGauge
+	case openmetrics.HistogramType:
+		typ = protoHistogram
+	case openmetrics.GaugeHistogramType:
+		typ = protoGaugeHistogram
+	case openmetrics.SummaryType:
+		typ = protoSummary
+	}
+
+	b = protowire.AppendString(b, 1, name)
+	b = protowire.AppendString(b, 2, fam.Desc.Help)
+	b = protowire.AppendVarint(b, 3, uint64(typ))
+	for _, s := range fam.Series {
+		if fam.Type == openmetrics.StateSetType {
+			// one gauge per state, labelled by the family name
+			for _, pt := range s.Points {
+				b = protowire.AppendMessage(b, 4, func(b []byte) []byte {
+					b = appendLabels(b, 1, s.Labels, pt.Label)
+					return protowire.AppendMessage(b, 2, func(b []byte) []byte {
+						return protowire.AppendDouble(b, 1, pt.Value)
+					})
+				})
+			}
+			continue
+		}
+
+		b = protowire.AppendMessage(b, 4, func(b []byte) []byte {
+			b = appendLabels(b, 1, s.Labels, openmetrics.Label{})
+			return appendMetric(b, typ, s.Points)
+		})
+	}
+	return protowire.AppendString(b, 5, fam.Desc.Unit)
+}
+
+func appendMetric(b []byte, typ int, pts []openmetrics.MetricPoint) []byte {
+	switch typ {
+	case protoCounter:
+		return protowire.AppendMessage(b, 3, func(b []byte) []byte {
+			for _, pt := range pts {
+				switch pt.Suffix {
+				case openmetrics.SuffixTotal:
+					b = protowire.AppendDouble(b, 1, pt.Value)
+					b = appendExemplar(b, 2, pt.Exemplar)
+				case openmetrics.SuffixCreated:
+					b = appendTimestamp(b, 3, pt.Value)
+				}
+			}
+			return b
+		})
+	case protoHistogram, protoGaugeHistogram:
+		return protowire.AppendMessage(b, 7, func(b []byte) []byte {
+			for _, pt := range pts {
+				switch pt.Suffix {
+				case openmetrics.SuffixBucket:
+					b = protowire.AppendMessage(b, 3, func(b []byte) []byte {
+						b = protowire.AppendVarint(b, 1, uint64(pt.Value))
+						b = protowire.AppendDouble(b, 2, parseFloat(pt.Label.Value))
+						return appendExemplar(b, 3, pt.Exemplar)
+					})
+				case openmetrics.SuffixCount, openmetrics.SuffixGCount:
+					b = protowire.AppendVarint(b, 1, uint64(pt.Value))
+				case openmetrics.SuffixSum, openmetrics.SuffixGSum:
+					b = protowire.AppendDouble(b, 2, pt.Value)
+				case openmetrics.SuffixCreated:
+					b = appendTimestamp(b, 15, pt.Value)
+				}
+			}
+			return b
+		})
+	case protoSummary:
+		return protowire.AppendMessage(b, 4, func(b []byte) []byte {
+			for _, pt := range pts {
+				switch pt.Suffix {
+				case openmetrics.SuffixEmpty:
+					b = protowire.AppendMessage(b, 3, func(b []byte) []byte {
+						b = protowire.AppendDouble(b, 1, parseFloat(pt.Label.Value))
+						return protowire.AppendDouble(b, 2, pt.Value)
+					})
+				case openmetrics.SuffixCount:
+					b = protowire.AppendVarint(b, 1, uint64(pt.Value))
+				case openmetrics.SuffixSum:
+					b = protowire.AppendDouble(b, 2, pt.Value)
+				case openmetrics.SuffixCreated:
+					b = appendTimestamp(b, 4, pt.Value)
+				}
+			}
+			return b
+		})
+	}
+
+	// gauges, infos and unknowns have a single point
+	field := 2 // gauge
+	if typ == protoUntyped {
+		field = 5
+	}
+	return protowire.AppendMessage(b, field, func(b []byte) []byte {
+		for _, pt := range pts {
+			b = protowire.AppendDouble(b, 1, pt.Value)
+		}
+		return b
+	})
+}
+
+func appendLabels(b []byte, num int, set openmetrics.LabelSet, extra openmetrics.Label) []byte {
+	for _, l := range set {
+		b = appendLabel(b, num, l)
+	}
+	if !extra.IsZero() {
+		b = appendLabel(b, num, extra)
+	}
+	return b
+}
+
+func appendLabel(b []byte, num int, l openmetrics.Label) []byte {
+	return protowire.AppendMessage(b, num, func(b []byte) []byte {
+		b = protowire.AppendString(b, 1, l.Name)
+		return protowire.AppendString(b, 2, l.Value)
+	})
+}
+
+func appendExemplar(b []byte, num int, x *openmetrics.Exemplar) []byte {
+	if x == nil {
+		return b
+	}
+	return protowire.AppendMessage(b, num, func(b []byte) []byte {
+		b = appendLabels(b, 1, x.Labels, openmetrics.Label{})
+		b = protowire.AppendDouble(b, 2, x.Value)
+		if !x.Timestamp.IsZero() {
+			b = appendTime(b, 3, x.Timestamp)
+		}
+		return b
+	})
+}
+
+// appendTimestamp appends a google.protobuf.Timestamp from epoch seconds.
+func appendTimestamp(b []byte, num int, epoch float64) []byte {
+	sec, frac := math.Modf(epoch)
+	return appendTime(b, num, time.Unix(int64(sec), int64(math.Round(frac*1e9))))
+}
+
+func appendTime(b []byte, num int, t time.Time) []byte {
+	return protowire.AppendMessage(b, num, func(b []byte) []byte {
+		b = protowire.AppendInt64(b, 1, t.Unix())
+		return protowire.AppendInt64(b, 2, int64(t.Nanosecond()))
+	})
+}
+
+func parseFloat(s string) float64 {
+	f, _ := strconv.ParseFloat(s, 64)
+	return f
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/bsm/openmetrics"
+	"github.com/bsm/openmetrics/internal/protowire"
+)
+
+func TestAppendProto(t *testing.T) {
+	fams, err := openmetrics.Parse(strings.NewReader(`# TYPE foo counter
+# HELP foo Foo.
+foo_total{a="b"} 2 # {trace_id="x"} 1
+foo_created{a="b"} 1515151515.5
+# TYPE mode stateset
+mode{mode="a"} 1
+mode{mode="b"} 0
+# TYPE lat_seconds histogram
+# UNIT lat_seconds seconds
+lat_seconds_bucket{le="0.1"} 1
+lat_seconds_bucket{le="+Inf"} 2
+lat_seconds_count 2
+lat_seconds_sum 3.5
+# TYPE empty gauge
+# EOF
+`))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if exp, got := []string{
+		`family foo_total "Foo." type=0`,
+		`  metric {a="b"} counter value=2 exemplar=1 created=1515151515.500000000`,
+		`family mode "" type=1`,
+		`  metric {mode="a"} gauge value=1`,
+		`  metric {mode="b"} gauge value=0`,
+		`family lat_seconds "" type=4 unit=seconds`,
+		`  metric {} histogram count=2 sum=3.5 buckets=[0.1:1 +Inf:2]`,
+	}, decodeProto(t, appendProto(nil, fams)); !reflect.DeepEqual(exp, got) {
+		t.Fatalf("expected:\n%v\ngot:\n%v", strings.Join(exp, "\n"), strings.Join(got, "\n"))
+	}
+}
+
+func decodeProto(t *testing.T, b []byte) []string {
+	t.Helper()
+
+	var lines []string
+	for len(b) > 0 {
+		size, n := binary.Uvarint(b)
+		if n <= 0 {
+			t.Fatalf("invalid message length")
+		}
+		msg := b[n : n+int(size)]
+		b = b[n+int(size):]
+
+		var metrics []string
+		var typ uint64
+		var name, help, unit string
+		mustRange(t, msg, func(num int, v uint64, p []byte) {
+			switch num {
+			case 1:
+				name = string(p)
+			case 2:
+				help = string(p)
+			case 3:
+				typ = v
+			case 4:
+				metrics = append(metrics, "  metric "+decodeMetric(t, p))
+			case 5:
+				unit = " unit=" + string(p)
+			}
+		})
+		lines = append(lines, fmt.Sprintf("family %s %q type=%d%s", name, help, typ, unit))
+		lines = append(lines, metrics...)
+	}
+	return lines
+}
+
+func decodeMetric(t *testing.T, b []byte) string {
+	var labels []string
+	var value string
+	mustRange(t, b, func(num int, v uint64, p []byte) {
+		switch num {
+		case 1:
+			var ln, lv string
+			mustRange(t, p, func(num int, _ uint64, p []byte) {
+				if num == 1 {
+					ln = string(p)
+				} else {
+					lv = string(p)
+				}
+			})
+			labels = append(labels, fmt.Sprintf("%s=%q", ln, lv))
+		case 2:
+			value = "gauge value=0"
+			mustRange(t, p, func(_ int, v uint64, _ []byte) { value = fmt.Sprintf("gauge value=%g", math.Float64frombits(v)) })
+		case 3:
+			value = "counter"
+			mustRange(t, p, func(num int, v uint64, p []byte) {
+				switch num {
+				case 1:
+					value += fmt.Sprintf(" value=%g", math.Float64frombits(v))
+				case 2:
+					mustRange(t, p, func(num int, v uint64, _ []byte) {
+						if num == 2 {
+							value += fmt.Sprintf(" exemplar=%g", math.Float64frombits(v))
+						}
+					})
+				case 3:
+					var sec, nsec uint64
+					mustRange(t, p, func(num int, v uint64, _ []byte) {
+						if num == 1 {
+							sec = v
+						} else {
+							nsec = v
+						}
+					})
+					value += fmt.Sprintf(" created=%d.%09d", sec, nsec)
+				}
+			})
+		case 7:
+			var buckets []string
+			value = "histogram"
+			mustRange(t, p, func(num int, v uint64, p []byte) {
+				switch num {
+				case 1:
+					value += fmt.Sprintf(" count=%d", v)
+				case 2:
+					value += fmt.Sprintf(" sum=%g", math.Float64frombits(v))
+				case 3:
+					var le float64
+					var cnt uint64
+					mustRange(t, p, func(num int, v uint64, _ []byte) {
+						if num == 1 {
+							cnt = v
+						} else if num == 2 {
+							le = math.Float64frombits(v)
+						}
+					})
+					buckets = append(buckets, fmt.Sprintf("%s:%d", formatBound(le), cnt))
+				}
+			})
+			value += fmt.Sprintf(" buckets=%v", buckets)
+		}
+	})
+	return "{" + strings.Join(labels, ",") + "} " + value
+}
+
+func formatBound(f float64) string {
+	if math.IsInf(f, 1) {
+		return "+Inf"
+	}
+	return fmt.Sprint(f)
+}
+
+func mustRange(t *testing.T, b []byte, fn func(num int, v uint64, p []byte)) {
+	t.Helper()
+
+	if err := protowire.Range(b, func(num int, _ protowire.Type, v uint64, p []byte) error {
+		fn(num, v, p)
+		return nil
+	}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+}
@@ -0,0 +1,54 @@
+package openmetrics
+
+import "context"
+
+// A Collector updates metrics on demand, whenever the registry it was added to
+// is written or snapshotted. Collectors may register new families on the
+// registry, but must not write or snapshot it.
+type Collector interface {
+	Collect(ctx context.Context, reg *Registry) error
+}
+
+// CollectorFunc is a Collector function.
+type CollectorFunc func(ctx context.Context, reg *Registry) error
+
+// Collect implements the Collector interface.
+func (f CollectorFunc) Collect(ctx context.Context, reg *Registry) error {
+	return f(ctx, reg)
+}
+
+// AddCollector adds a collector to the registry. Collectors are invoked in
+// order, before the registered families are written or snapshotted. Errors are
+// passed to the registry's error handler.
+func (r *Registry) AddCollector(c Collector) {
+	r.cmu.Lock()
+	r.collectors = append(r.collectors, c)
+	r.cmu.Unlock()
+}
+
+// collect invokes all collectors, one scrape at a time. It gives up waiting
+// for a concurrent scrape when ctx is done.
+func (r *Registry) collect(ctx context.Context) {
+	r.cmu.Lock()
+	if r.csem == nil {
+		r.csem = make(chan struct{}, 1)
+	}
+	sem, collectors := r.csem, r.collectors
+	r.cmu.Unlock()
+
+	select {
+	case sem <- struct{}{}:
+		defer func() { <-sem }()
+	case <-ctx.Done():
+		return
+	}
+
+	for _, c := range collectors {
+		if ctx.Err() != nil {
+			return
+		}
+		if err := c.Collect(ctx, r); err != nil {
+			r.onError()(err)
+		}
+	}
+}
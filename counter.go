@@ -32,8 +32,9 @@ func (f *counterFamily) With(labelValues ...string) Counter {
 
 // CounterOptions configure Counter instances.
 type CounterOptions struct {
-	CreatedAt time.Time    // defaults to time.Now()
-	OnError   ErrorHandler // defaults to WarnOnError
+	CreatedAt   time.Time    // defaults to time.Now()
+	OnError     ErrorHandler // defaults to WarnOnError
+	LabelPolicy LabelPolicy  // applied to exemplar labels, defaults to RejectInvalidLabelValues
 }
 
 // Counter is an Metric.
@@ -66,6 +67,7 @@ type counter struct {
 	created  time.Time
 	exemplar *Exemplar
 	onError  ErrorHandler
+	policy   LabelPolicy
 
 	mu sync.RWMutex
 }
@@ -111,20 +113,21 @@ func (m *counter) AddExemplar(ex *Exemplar) {
 		return
 	}
 
-	if err := ex.Validate(); err != nil {
-		m.handleError(err)
-		m.Add(ex.Value)
-		return
-	}
-
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
+	m.total += ex.Value
+
+	x, err := ex.sanitize(m.policy)
+	if err != nil {
+		m.onError(err)
+		return
+	}
+
 	if m.exemplar == nil {
 		m.exemplar = new(Exemplar)
 	}
-	m.exemplar.copyFrom(ex)
-	m.total += ex.Value
+	m.exemplar.copyFrom(&x)
 }
 
 func (m *counter) Reset(opts CounterOptions) {
@@ -134,6 +137,7 @@ func (m *counter) Reset(opts CounterOptions) {
 	m.total = 0
 	m.created = opts.CreatedAt
 	m.onError = opts.OnError
+	m.policy = opts.LabelPolicy
 	m.exemplar = nil
 
 	if m.created.IsZero() {
@@ -25,12 +25,26 @@ type Desc struct {
 	Help string
 	// Names of the labels that will be used with this metric (optional).
 	Labels []string
+	// OmitCreated suppresses the _created points of counters, histograms and
+	// summaries in the exposition. Creation times are still tracked internally.
+	OmitCreated bool
 }
 
 // Validate validates the description.
 func (d *Desc) Validate() error {
+	return d.validate(false)
+}
+
+// validate validates the description, optionally permitting metric and label
+// names with arbitrary UTF-8 characters.
+func (d *Desc) validate(utf8Names bool) error {
+	isValidName, isValidLabel := isValidMetricName, isValidLabelName
+	if utf8Names {
+		isValidName, isValidLabel = isValidUTF8Name, isValidUTF8Name
+	}
+
 	// ensure name is ABNF valid
-	if !isValidMetricName(d.Name) {
+	if !isValidName(d.Name) {
 		return fmt.Errorf("metric name %q is invalid", d.Name)
 	}
 
@@ -60,7 +74,7 @@ func (d *Desc) Validate() error {
 
 	// ensure label names are valid and unique
 	for i, name := range d.Labels {
-		if !isValidLabelName(name) {
+		if !isValidLabel(name) {
 			return fmt.Errorf("label name %q is invalid", name)
 		}
 		if i < len(d.Labels)-2 {
@@ -89,20 +103,36 @@ func (d *Desc) copyLabelValues(values []string) []string {
 	return newValues
 }
 
-func (d *Desc) validateLabelValues(values []string) (err error) {
+// sanitizeLabelValues validates values and applies the label policy. The
+// values are copied before they are modified.
+func (d *Desc) sanitizeLabelValues(values []string, policy LabelPolicy) ([]string, error) {
 	if need, got := len(d.Labels), len(values); got > need {
-		return fmt.Errorf("metric %q requires %d label value(s)", d.Name, need)
+		return nil, fmt.Errorf("metric %q requires %d label value(s)", d.Name, need)
 	}
 
+	var sanitized []string
 	for i, lv := range values {
-		if !isValidLabelValue(lv) {
-			values[i] = lv
-			if err == nil {
-				err = fmt.Errorf("invalid label value %q", lv)
+		if lv == "" {
+			continue
+		}
+
+		value, err := applyLabelPolicy(policy, d.Labels[i], lv)
+		if err != nil {
+			return nil, err
+		}
+		if value != lv {
+			if sanitized == nil {
+				sanitized = make([]string, len(values))
+				copy(sanitized, values)
 			}
+			sanitized[i] = value
 		}
 	}
-	return
+
+	if sanitized != nil {
+		return sanitized, nil
+	}
+	return values, nil
 }
 
 func (d *Desc) calcID() (id uint64) {
@@ -44,6 +44,21 @@ func (x *Exemplar) Validate() error {
 	return nil
 }
 
+// sanitize applies a label policy and returns a validated shallow copy of the
+// exemplar.
+func (x *Exemplar) sanitize(policy LabelPolicy) (Exemplar, error) {
+	labels, err := sanitizeLabels(x.Labels, policy)
+	if err != nil {
+		return Exemplar{}, err
+	}
+
+	sx := Exemplar{Value: x.Value, Timestamp: x.Timestamp, Labels: labels}
+	if err := sx.Validate(); err != nil {
+		return Exemplar{}, err
+	}
+	return sx, nil
+}
+
 func (x *Exemplar) copyFrom(other *Exemplar) {
 	*x = Exemplar{
 		Value:     other.Value,
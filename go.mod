@@ -1,3 +1,8 @@
 module github.com/bsm/openmetrics
 
 go 1.24
+
+require (
+	github.com/klauspost/compress v1.18.0
+	golang.org/x/crypto v0.39.0
+)
@@ -33,8 +33,9 @@ func (f *histogramFamily) With(labelValues ...string) Histogram {
 
 // HistogramOptions configure Histogram instances.
 type HistogramOptions struct {
-	CreatedAt time.Time    // defaults to time.Now()
-	OnError   ErrorHandler // defaults to WarnOnError
+	CreatedAt   time.Time    // defaults to time.Now()
+	OnError     ErrorHandler // defaults to WarnOnError
+	LabelPolicy LabelPolicy  // applied to exemplar labels, defaults to RejectInvalidLabelValues
 }
 
 // Histogram is a Metric.
@@ -70,6 +71,7 @@ type histogram struct {
 	count   int64
 	created time.Time
 	onError ErrorHandler
+	policy  LabelPolicy
 
 	bounds  []float64
 	buckets []histogramBucket
@@ -160,12 +162,6 @@ func (m *histogram) ObserveExemplar(ex *Exemplar) {
 		return
 	}
 
-	if err := ex.Validate(); err != nil {
-		m.handleError(err)
-		m.Observe(ex.Value)
-		return
-	}
-
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
@@ -173,10 +169,17 @@ func (m *histogram) ObserveExemplar(ex *Exemplar) {
 	m.count++
 
 	bk := m.incrementBuckets(ex.Value)
+
+	x, err := ex.sanitize(m.policy)
+	if err != nil {
+		m.onError(err)
+		return
+	}
+
 	if bk.exemplar == nil {
 		bk.exemplar = new(Exemplar)
 	}
-	bk.exemplar.copyFrom(ex)
+	bk.exemplar.copyFrom(&x)
 }
 
 func (m *histogram) Reset(opts HistogramOptions) {
@@ -187,6 +190,7 @@ func (m *histogram) Reset(opts HistogramOptions) {
 	m.count = 0
 	m.created = opts.CreatedAt
 	m.onError = opts.OnError
+	m.policy = opts.LabelPolicy
 	for _, b := range m.buckets {
 		b.Reset()
 	}
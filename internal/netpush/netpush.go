@@ -0,0 +1,46 @@
+// Package netpush pushes plaintext documents over short-lived connections.
+package netpush
+
+import (
+	"context"
+	"io"
+	"net"
+	"time"
+)
+
+// Run pushes documents rendered by w at the given interval. It blocks until
+// the context is cancelled. Push errors are passed to onError.
+func Run(ctx context.Context, interval time.Duration, network, address string, w io.WriterTo, onError func(error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := Push(ctx, network, address, w); err != nil {
+				onError(err)
+			}
+		}
+	}
+}
+
+// Push connects to address, writes a document rendered by w and closes the
+// connection.
+func Push(ctx context.Context, network, address string, w io.WriterTo) error {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, network, address)
+	if err != nil {
+		return err
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetWriteDeadline(deadline)
+	}
+	_, err = w.WriteTo(conn)
+	if cerr := conn.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
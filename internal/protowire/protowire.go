@@ -0,0 +1,154 @@
+// Package protowire implements a minimal subset of the protocol buffers wire
+// format, as described in https://protobuf.dev/programming-guides/encoding/
+package protowire
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+// Type is the wire type of a field.
+type Type int8
+
+// Wire types.
+const (
+	VarintType  Type = 0
+	Fixed64Type Type = 1
+	BytesType   Type = 2
+	Fixed32Type Type = 5
+)
+
+// ErrCorrupt is returned when the input cannot be parsed.
+var ErrCorrupt = errors.New("protowire: corrupt input")
+
+// AppendTag appends a field tag.
+func AppendTag(b []byte, num int, typ Type) []byte {
+	return binary.AppendUvarint(b, uint64(num)<<3|uint64(typ))
+}
+
+// AppendVarint appends a varint field. Zero values are omitted.
+func AppendVarint(b []byte, num int, v uint64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = AppendTag(b, num, VarintType)
+	return binary.AppendUvarint(b, v)
+}
+
+// AppendInt64 appends an int64 field. Zero values are omitted.
+func AppendInt64(b []byte, num int, v int64) []byte {
+	return AppendVarint(b, num, uint64(v))
+}
+
+// AppendDouble appends a double field. Zero values are omitted.
+func AppendDouble(b []byte, num int, v float64) []byte {
+	if v == 0 && !math.Signbit(v) {
+		return b
+	}
+	return AppendFixed64(b, num, math.Float64bits(v))
+}
+
+// AppendFixed64 appends a fixed64 field, regardless of its value.
+func AppendFixed64(b []byte, num int, v uint64) []byte {
+	b = AppendTag(b, num, Fixed64Type)
+	return binary.LittleEndian.AppendUint64(b, v)
+}
+
+// AppendString appends a string field. Empty strings are omitted.
+func AppendString(b []byte, num int, s string) []byte {
+	if s == "" {
+		return b
+	}
+	b = AppendTag(b, num, BytesType)
+	b = binary.AppendUvarint(b, uint64(len(s)))
+	return append(b, s...)
+}
+
+// AppendBytes appends a bytes field, regardless of its length.
+func AppendBytes(b []byte, num int, p []byte) []byte {
+	b = AppendTag(b, num, BytesType)
+	b = binary.AppendUvarint(b, uint64(len(p)))
+	return append(b, p...)
+}
+
+// AppendMessage appends an embedded message field. The message is encoded by
+// fn which must append it to the passed slice.
+func AppendMessage(b []byte, num int, fn func([]byte) []byte) []byte {
+	b = AppendTag(b, num, BytesType)
+
+	// reserve a single byte for the length, most messages are short
+	pos := len(b)
+	b = append(b, 0)
+	b = fn(b)
+
+	size := len(b) - pos - 1
+	if size < 0x80 {
+		b[pos] = byte(size)
+		return b
+	}
+
+	// shift the message to make space for the length
+	var tmp [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(tmp[:], uint64(size))
+	b = append(b, tmp[1:n]...)
+	copy(b[pos+n:], b[pos+1:pos+1+size])
+	copy(b[pos:], tmp[:n])
+	return b
+}
+
+// ConsumeField parses a single field from b. It returns the field number, the
+// wire type, the numeric value for varint and fixed types, the payload for
+// bytes types and the number of bytes consumed.
+func ConsumeField(b []byte) (num int, typ Type, v uint64, p []byte, err error) {
+	tag, n := binary.Uvarint(b)
+	if n <= 0 {
+		return 0, 0, 0, nil, ErrCorrupt
+	}
+	num, typ, b = int(tag>>3), Type(tag&7), b[n:]
+
+	switch typ {
+	case VarintType:
+		var m int
+		if v, m = binary.Uvarint(b); m <= 0 {
+			return 0, 0, 0, nil, ErrCorrupt
+		}
+		p = b[:m]
+	case Fixed64Type:
+		if len(b) < 8 {
+			return 0, 0, 0, nil, ErrCorrupt
+		}
+		v, p = binary.LittleEndian.Uint64(b), b[:8]
+	case Fixed32Type:
+		if len(b) < 4 {
+			return 0, 0, 0, nil, ErrCorrupt
+		}
+		v, p = uint64(binary.LittleEndian.Uint32(b)), b[:4]
+	case BytesType:
+		size, m := binary.Uvarint(b)
+		if m <= 0 || uint64(len(b)-m) < size {
+			return 0, 0, 0, nil, ErrCorrupt
+		}
+		v, p = size, b[m:m+int(size)]
+	default:
+		return 0, 0, 0, nil, ErrCorrupt
+	}
+	return num, typ, v, p, nil
+}
+
+// Range iterates over all fields in b.
+func Range(b []byte, fn func(num int, typ Type, v uint64, p []byte) error) error {
+	for len(b) > 0 {
+		num, typ, v, p, err := ConsumeField(b)
+		if err != nil {
+			return err
+		}
+		if err := fn(num, typ, v, p); err != nil {
+			return err
+		}
+
+		// p is always a sub-slice of b
+		b = b[cap(b)-cap(p)+len(p):]
+	}
+	return nil
+}
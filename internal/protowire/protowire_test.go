@@ -0,0 +1,74 @@
+package protowire
+
+import (
+	"bytes"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestAppend(t *testing.T) {
+	var b []byte
+	b = AppendVarint(b, 1, 150)
+	b = AppendString(b, 2, "testing")
+	b = AppendDouble(b, 3, 1.5)
+	b = AppendVarint(b, 4, 0)
+	b = AppendString(b, 5, "")
+
+	exp := []byte{
+		0x08, 0x96, 0x01,
+		0x12, 0x07, 't', 'e', 's', 't', 'i', 'n', 'g',
+		0x19, 0, 0, 0, 0, 0, 0, 0xf8, 0x3f,
+	}
+	if !bytes.Equal(exp, b) {
+		t.Fatalf("expected %x, got %x", exp, b)
+	}
+}
+
+func TestAppendMessage(t *testing.T) {
+	for _, size := range []int{0, 1, 127, 128, 20_000} {
+		s := strings.Repeat("x", size)
+		b := AppendMessage([]byte{0xff}, 1, func(b []byte) []byte {
+			return AppendString(b, 2, s)
+		})
+
+		exp := append([]byte{0xff}, AppendBytes(nil, 1, AppendString(nil, 2, s))...)
+		if !bytes.Equal(exp, b) {
+			t.Fatalf("[%d] expected %x, got %x", size, exp, b)
+		}
+	}
+}
+
+func TestRange(t *testing.T) {
+	var b []byte
+	b = AppendVarint(b, 1, 150)
+	b = AppendString(b, 2, "testing")
+	b = AppendDouble(b, 3, math.Inf(1))
+
+	type field struct {
+		Num int
+		Typ Type
+		V   uint64
+	}
+	var got []field
+	if err := Range(b, func(num int, typ Type, v uint64, _ []byte) error {
+		got = append(got, field{Num: num, Typ: typ, V: v})
+		return nil
+	}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	exp := []field{
+		{Num: 1, Typ: VarintType, V: 150},
+		{Num: 2, Typ: BytesType, V: 7},
+		{Num: 3, Typ: Fixed64Type, V: math.Float64bits(math.Inf(1))},
+	}
+	if !reflect.DeepEqual(exp, got) {
+		t.Fatalf("expected %+v, got %+v", exp, got)
+	}
+
+	if err := Range(b[:len(b)-1], func(int, Type, uint64, []byte) error { return nil }); err != ErrCorrupt {
+		t.Fatalf("expected %v, got %v", ErrCorrupt, err)
+	}
+}
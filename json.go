@@ -0,0 +1,152 @@
+package openmetrics
+
+import (
+	"encoding/json"
+	"io"
+	"math"
+	"strconv"
+	"time"
+)
+
+// JSONContentType is the content type of JSON documents written by WriteJSON.
+const JSONContentType = "application/json; charset=utf-8"
+
+// WriteJSON writes snapshots of metric families as a JSON document. Created
+// points are exposed as RFC 3339 timestamps of each series, non-finite values
+// are encoded as strings, i.e. "NaN", "+Inf" and "-Inf".
+func WriteJSON(w io.Writer, fams []FamilySnapshot) (int64, error) {
+	doc := jsonDocument{Families: make([]jsonFamily, 0, len(fams))}
+	for i := range fams {
+		doc.Families = append(doc.Families, newJSONFamily(&fams[i]))
+	}
+
+	cw := &countingWriter{Writer: w}
+	err := json.NewEncoder(cw).Encode(&doc)
+	return cw.n, err
+}
+
+// WriteJSON writes a snapshot of all registered metric families as a JSON
+// document. See WriteJSON for details.
+func (r *Registry) WriteJSON(w io.Writer) (int64, error) {
+	fams, err := r.Snapshot()
+	if err != nil {
+		return 0, err
+	}
+	return WriteJSON(w, fams)
+}
+
+type jsonDocument struct {
+	Families []jsonFamily `json:"families"`
+}
+
+type jsonFamily struct {
+	Name   string       `json:"name"`
+	Type   string       `json:"type"`
+	Unit   string       `json:"unit,omitempty"`
+	Help   string       `json:"help,omitempty"`
+	Series []jsonSeries `json:"series"`
+}
+
+type jsonSeries struct {
+	Labels  map[string]string `json:"labels,omitempty"`
+	Points  []jsonPoint       `json:"points"`
+	Created *time.Time        `json:"created,omitempty"`
+}
+
+type jsonPoint struct {
+	Name     string            `json:"name"`
+	Labels   map[string]string `json:"labels,omitempty"`
+	Value    jsonFloat         `json:"value"`
+	Exemplar *jsonExemplar     `json:"exemplar,omitempty"`
+}
+
+type jsonExemplar struct {
+	Labels    map[string]string `json:"labels,omitempty"`
+	Value     jsonFloat         `json:"value"`
+	Timestamp *time.Time        `json:"timestamp,omitempty"`
+}
+
+func newJSONFamily(fam *FamilySnapshot) jsonFamily {
+	name := fam.Desc.FullName()
+	jf := jsonFamily{
+		Name:   name,
+		Type:   fam.Type.String(),
+		Unit:   fam.Desc.Unit,
+		Help:   fam.Desc.Help,
+		Series: make([]jsonSeries, 0, len(fam.Series)),
+	}
+
+	for _, s := range fam.Series {
+		js := jsonSeries{
+			Labels: jsonLabels(s.Labels),
+			Points: make([]jsonPoint, 0, len(s.Points)),
+		}
+		for _, pt := range s.Points {
+			if pt.Suffix == SuffixCreated {
+				t := fromEpoch(pt.Value)
+				js.Created = &t
+				continue
+			}
+
+			jp := jsonPoint{
+				Name:  name + pt.Suffix.String(),
+				Value: jsonFloat(pt.Value),
+			}
+			if !pt.Label.IsZero() {
+				jp.Labels = map[string]string{pt.Label.Name: pt.Label.Value}
+			}
+			if x := pt.Exemplar; x != nil {
+				jp.Exemplar = &jsonExemplar{
+					Labels: jsonLabels(x.Labels),
+					Value:  jsonFloat(x.Value),
+				}
+				if !x.Timestamp.IsZero() {
+					ts := x.Timestamp.UTC()
+					jp.Exemplar.Timestamp = &ts
+				}
+			}
+			js.Points = append(js.Points, jp)
+		}
+		jf.Series = append(jf.Series, js)
+	}
+	return jf
+}
+
+func jsonLabels(set LabelSet) map[string]string {
+	var m map[string]string
+	for _, l := range set {
+		if !l.IsZero() {
+			if m == nil {
+				m = make(map[string]string, len(set))
+			}
+			m[l.Name] = l.Value
+		}
+	}
+	return m
+}
+
+type jsonFloat float64
+
+func (f jsonFloat) MarshalJSON() ([]byte, error) {
+	v := float64(f)
+	switch {
+	case math.IsNaN(v):
+		return []byte(`"NaN"`), nil
+	case math.IsInf(v, 1):
+		return []byte(`"+Inf"`), nil
+	case math.IsInf(v, -1):
+		return []byte(`"-Inf"`), nil
+	}
+	return strconv.AppendFloat(nil, v, 'g', -1, 64), nil
+}
+
+type countingWriter struct {
+	io.Writer
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.Writer.Write(p)
+	w.n += int64(n)
+	return n, err
+}
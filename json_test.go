@@ -0,0 +1,44 @@
+package openmetrics_test
+
+import (
+	"bytes"
+	"math"
+	"strings"
+	"testing"
+
+	. "github.com/bsm/openmetrics"
+)
+
+func TestRegistry_WriteJSON(t *testing.T) {
+	reg := NewConsistentRegistry(mockNow)
+	foo := reg.Counter(Desc{Name: "foo", Help: "Helpful.", Labels: []string{"status"}})
+	foo.With("200").AddExemplar(&Exemplar{Value: 2, Timestamp: mockTime, Labels: Labels("trace_id", "abc")})
+	bar := reg.Histogram(Desc{Name: "bar", Unit: "seconds"}, []float64{.1})
+	bar.With().Observe(0.05)
+	baz := reg.Gauge(Desc{Name: "baz"})
+	baz.With().Set(math.Inf(1))
+	reg.Gauge(Desc{Name: "qux"})
+
+	var buf bytes.Buffer
+	if n, err := reg.WriteJSON(&buf); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	} else if exp, got := buf.Len(), int(n); exp != got {
+		t.Fatalf("expected %v, got %v", exp, got)
+	}
+
+	exp := strings.Join([]string{
+		`{"families":[`,
+		`{"name":"foo","type":"counter","help":"Helpful.","series":[`,
+		`{"labels":{"status":"200"},"points":[{"name":"foo_total","value":2,"exemplar":{"labels":{"trace_id":"abc"},"value":2,"timestamp":"2018-01-05T11:25:15.757575757Z"}}],"created":"2018-01-05T11:25:15.757576Z"}`,
+		`]},`,
+		`{"name":"bar_seconds","type":"histogram","unit":"seconds","series":[`,
+		`{"points":[{"name":"bar_seconds_bucket","labels":{"le":"0.1"},"value":1},{"name":"bar_seconds_bucket","labels":{"le":"+Inf"},"value":1},{"name":"bar_seconds_count","value":1},{"name":"bar_seconds_sum","value":0.05}],"created":"2018-01-05T11:25:15.757576Z"}`,
+		`]},`,
+		`{"name":"baz","type":"gauge","series":[{"points":[{"name":"baz","value":"+Inf"}]}]},`,
+		`{"name":"qux","type":"gauge","series":[]}`,
+		`]}`,
+	}, "") + "\n"
+	if got := buf.String(); exp != got {
+		t.Fatalf("expected:\n%s\ngot:\n%s", exp, got)
+	}
+}
@@ -0,0 +1,318 @@
+// Package omexpvar bridges variables published via the expvar package.
+package omexpvar
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/bsm/openmetrics"
+)
+
+// Field maps a field of a JSON-valued variable to a gauge.
+type Field struct {
+	// Path is the dot-separated path to a numeric field, e.g.
+	// "PauseTotalNs". An empty path refers to the variable itself.
+	Path string
+	// Desc describes the gauge. If it declares a single label, Path must
+	// refer to a JSON object and each of its numeric entries becomes a series,
+	// labelled with the entry key.
+	Desc openmetrics.Desc
+	// Scale multiplies values, e.g. 1e-9 to convert nanoseconds to seconds.
+	// Default: 1.
+	Scale float64
+}
+
+// Collector collects variables published via the expvar package. It
+// implements the openmetrics.Collector interface:
+//
+//	reg.AddCollector(omexpvar.New())
+//
+// Variables of type *expvar.Int and *expvar.Float are mapped to gauges,
+// numeric entries of an *expvar.Map to series of a labelled gauge. Other
+// variables are skipped, unless they are mapped via the Func option. Family
+// names are derived from the variable names, replacing invalid characters
+// with underscores, see EscapeNames for a collision-safe alternative.
+//
+// A Collector must only be added to a single registry.
+type Collector struct {
+	conf       config
+	fams       map[string]family
+	collisions map[string]struct{}
+	mu         sync.Mutex
+}
+
+// family is a registered family and the variable (or field) it belongs to.
+type family struct {
+	openmetrics.GaugeFamily
+	owner string
+}
+
+// New inits a new Collector.
+func New(opts ...Option) *Collector {
+	conf := config{
+		prefix:   "expvar",
+		mapLabel: "key",
+	}
+	for _, o := range opts {
+		o.update(&conf)
+	}
+
+	return &Collector{
+		conf:       conf,
+		fams:       make(map[string]family),
+		collisions: make(map[string]struct{}),
+	}
+}
+
+// Collect implements the openmetrics.Collector interface. It registers new
+// families on reg as variables are published.
+func (c *Collector) Collect(_ context.Context, reg *openmetrics.Registry) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var errs []error
+	expvar.Do(func(kv expvar.KeyValue) {
+		if fields, ok := c.conf.funcs[kv.Key]; ok {
+			for _, err := range c.collectJSON(reg, kv, fields) {
+				errs = append(errs, fmt.Errorf("omexpvar: %q: %w", kv.Key, err))
+			}
+		} else if err := c.collect(reg, kv); err != nil {
+			errs = append(errs, fmt.Errorf("omexpvar: %q: %w", kv.Key, err))
+		}
+	})
+	return errors.Join(errs...)
+}
+
+func (c *Collector) collect(reg *openmetrics.Registry, kv expvar.KeyValue) error {
+	switch v := kv.Value.(type) {
+	case *expvar.Int:
+		fam, err := c.family(reg, kv.Key, c.desc(kv.Key))
+		if fam != nil {
+			fam.With().Set(float64(v.Value()))
+		}
+		return err
+	case *expvar.Float:
+		fam, err := c.family(reg, kv.Key, c.desc(kv.Key))
+		if fam != nil {
+			fam.With().Set(v.Value())
+		}
+		return err
+	case *expvar.Map:
+		desc := c.desc(kv.Key)
+		desc.Labels = []string{c.conf.mapLabel}
+		fam, err := c.family(reg, kv.Key, desc)
+		if fam != nil {
+			v.Do(func(entry expvar.KeyValue) {
+				if val, ok := numericValue(entry.Value); ok {
+					fam.With(entry.Key).Set(val)
+				}
+			})
+		}
+		return err
+	}
+	return nil
+}
+
+func (c *Collector) collectJSON(reg *openmetrics.Registry, kv expvar.KeyValue, fields []Field) (errs []error) {
+	var doc any
+	if err := json.Unmarshal([]byte(kv.Value.String()), &doc); err != nil {
+		return []error{err}
+	}
+
+	for _, f := range fields {
+		if err := c.collectField(reg, kv.Key, doc, f); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+func (c *Collector) collectField(reg *openmetrics.Registry, key string, doc any, f Field) error {
+	if len(f.Desc.Labels) > 1 {
+		return fmt.Errorf("field %q declares more than one label", f.Path)
+	}
+
+	owner := key
+	if f.Path != "" {
+		owner += "." + f.Path
+	}
+	fam, err := c.family(reg, owner, f.Desc)
+	if fam == nil {
+		return err
+	}
+
+	val, ok := lookupPath(doc, f.Path)
+	if !ok {
+		return fmt.Errorf("field %q not found", f.Path)
+	}
+
+	scale := f.Scale
+	if scale == 0 {
+		scale = 1
+	}
+
+	if len(f.Desc.Labels) == 0 {
+		num, ok := jsonNumber(val)
+		if !ok {
+			return fmt.Errorf("field %q is not numeric", f.Path)
+		}
+		fam.With().Set(num * scale)
+		return nil
+	}
+
+	obj, ok := val.(map[string]any)
+	if !ok {
+		return fmt.Errorf("field %q is not an object", f.Path)
+	}
+	for key, entry := range obj {
+		if num, ok := jsonNumber(entry); ok {
+			fam.With(key).Set(num * scale)
+		}
+	}
+	return nil
+}
+
+func (c *Collector) desc(key string) openmetrics.Desc {
+	name := key
+	if c.conf.prefix != "" {
+		name = c.conf.prefix + "_" + key
+	}
+	if c.conf.escapeNames {
+		name = openmetrics.SanitizeMetricName(name)
+	} else {
+		name = sanitizeName(name)
+	}
+	return openmetrics.Desc{
+		Name: name,
+		Help: "Value of expvar variable " + key + ".",
+	}
+}
+
+// family returns the gauge family for desc, registering it on first use.
+// Failed registrations and families claimed by another owner are only reported
+// once, subsequent calls return nil.
+func (c *Collector) family(reg *openmetrics.Registry, owner string, desc openmetrics.Desc) (openmetrics.GaugeFamily, error) {
+	name := desc.FullName()
+	if fam, ok := c.fams[name]; ok && fam.owner == owner {
+		return fam.GaugeFamily, nil
+	} else if ok {
+		key := owner + "\xff" + name
+		if _, ok := c.collisions[key]; ok {
+			return nil, nil
+		}
+		c.collisions[key] = struct{}{}
+		return nil, fmt.Errorf("family %q is already used by %q", name, fam.owner)
+	}
+
+	fam, err := reg.AddGauge(desc)
+	c.fams[name] = family{GaugeFamily: fam, owner: owner}
+	return fam, err
+}
+
+// sanitizeName replaces characters which are not valid in metric names with
+// underscores.
+func sanitizeName(s string) string {
+	s = strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '_' || r == ':' {
+			return r
+		}
+		return '_'
+	}, s)
+	if s != "" && s[0] >= '0' && s[0] <= '9' {
+		s = "_" + s
+	}
+	return s
+}
+
+func numericValue(v expvar.Var) (float64, bool) {
+	switch v := v.(type) {
+	case *expvar.Int:
+		return float64(v.Value()), true
+	case *expvar.Float:
+		return v.Value(), true
+	}
+	return 0, false
+}
+
+func lookupPath(doc any, path string) (any, bool) {
+	if path == "" {
+		return doc, true
+	}
+
+	for _, key := range strings.Split(path, ".") {
+		obj, ok := doc.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		if doc, ok = obj[key]; !ok {
+			return nil, false
+		}
+	}
+	return doc, true
+}
+
+func jsonNumber(v any) (float64, bool) {
+	switch v := v.(type) {
+	case float64:
+		return v, true
+	case bool:
+		if v {
+			return 1, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// ----------------------------------------------------------------------------
+
+type config struct {
+	prefix      string
+	mapLabel    string
+	escapeNames bool
+	funcs       map[string][]Field
+}
+
+// An Option configures the Collector.
+type Option interface {
+	update(*config)
+}
+
+type inlineOption func(*config)
+
+func (f inlineOption) update(c *config) { f(c) }
+
+// Prefix sets the prefix of derived family names. Default: "expvar".
+func Prefix(prefix string) Option {
+	return inlineOption(func(c *config) { c.prefix = prefix })
+}
+
+// MapLabel sets the name of the label which holds the keys of *expvar.Map
+// entries. Default: "key".
+func MapLabel(name string) Option {
+	return inlineOption(func(c *config) { c.mapLabel = name })
+}
+
+// EscapeNames derives family names using openmetrics.SanitizeMetricName,
+// which avoids collisions between variables such as "load.avg" and
+// "load_avg", at the cost of less readable names.
+func EscapeNames() Option {
+	return inlineOption(func(c *config) { c.escapeNames = true })
+}
+
+// Func maps fields of a JSON-valued variable, typically an expvar.Func, to
+// gauges. Mapped variables are decoded from their JSON representation and
+// are not subject to the default mapping.
+func Func(name string, fields ...Field) Option {
+	return inlineOption(func(c *config) {
+		if c.funcs == nil {
+			c.funcs = make(map[string][]Field)
+		}
+		c.funcs[name] = append(c.funcs[name], fields...)
+	})
+}
@@ -0,0 +1,193 @@
+package omexpvar_test
+
+import (
+	"bytes"
+	"errors"
+	"expvar"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bsm/openmetrics"
+	"github.com/bsm/openmetrics/omexpvar"
+)
+
+var (
+	mockTime = time.Unix(1515151515, 757575757)
+	mockNow  = func() time.Time { return mockTime }
+)
+
+func init() {
+	expvar.NewInt("jobs").Set(3)
+	expvar.NewFloat("load.avg").Set(0.5)
+
+	// collide with "load.avg"
+	expvar.NewInt("load_avg").Set(1)
+	expvar.NewMap("load~avg").Add("x", 1)
+
+	hits := expvar.NewMap("hits")
+	hits.Add("GET", 7)
+	hits.AddFloat("POST", 1.5)
+	hits.Set("name", new(expvar.String))
+
+	expvar.Publish("stats", expvar.Func(func() any {
+		return map[string]any{
+			"pause_ns": 2500000000,
+			"ready":    true,
+			"pools":    map[string]int{"db": 4, "cache": 2},
+		}
+	}))
+}
+
+func TestCollector(t *testing.T) {
+	expvar.Get("jobs").(*expvar.Int).Set(3)
+
+	var errs []error
+	reg := openmetrics.NewConsistentRegistry(mockNow)
+	reg.OmitCreated = true
+	reg.OnError = func(err error) { errs = append(errs, err) }
+	reg.AddCollector(omexpvar.New(
+		omexpvar.Func("stats",
+			omexpvar.Field{Path: "pause_ns", Desc: openmetrics.Desc{Name: "stats_pause", Unit: "seconds"}, Scale: 1e-9},
+			omexpvar.Field{Path: "ready", Desc: openmetrics.Desc{Name: "stats_ready"}},
+			omexpvar.Field{Path: "pools", Desc: openmetrics.Desc{Name: "stats_pools", Labels: []string{"pool"}}},
+		),
+	))
+
+	checkOutput(t, reg, `
+		# TYPE expvar_hits gauge
+		# HELP expvar_hits Value of expvar variable hits.
+		expvar_hits{key="POST"} 1.5
+		expvar_hits{key="GET"} 7
+		# TYPE expvar_jobs gauge
+		# HELP expvar_jobs Value of expvar variable jobs.
+		expvar_jobs 3
+		# TYPE expvar_load_avg gauge
+		# HELP expvar_load_avg Value of expvar variable load.avg.
+		expvar_load_avg 0.5
+		# TYPE stats_pause_seconds gauge
+		# UNIT stats_pause_seconds seconds
+		stats_pause_seconds 2.5
+		# TYPE stats_ready gauge
+		stats_ready 1
+		# TYPE stats_pools gauge
+		stats_pools{pool="cache"} 2
+		stats_pools{pool="db"} 4
+		# EOF
+	`)
+	if exp, got := 1, len(errs); exp != got { // collisions, see below
+		t.Fatalf("expected %v, got %v (%v)", exp, got, errs)
+	}
+
+	// values are updated at scrape time
+	expvar.Get("jobs").(*expvar.Int).Add(2)
+	fams, err := reg.Snapshot()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if exp, got := 5.0, fams[1].Series[0].Points[0].Value; exp != got {
+		t.Fatalf("expected %v, got %v", exp, got)
+	}
+}
+
+func TestCollector_escapeNames(t *testing.T) {
+	reg := openmetrics.NewConsistentRegistry(mockNow)
+	reg.OmitCreated = true
+	c := omexpvar.New(omexpvar.Prefix(""), omexpvar.EscapeNames())
+	if err := c.Collect(t.Context(), reg); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	fams, err := reg.Snapshot()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	var names []string
+	for _, fam := range fams {
+		names = append(names, fam.Desc.Name)
+	}
+	if exp, got := "hits jobs U__load_2e_avg load_avg U__load_7e_avg", strings.Join(names, " "); exp != got {
+		t.Fatalf("expected %v, got %v", exp, got)
+	}
+}
+
+func TestCollector_collisions(t *testing.T) {
+	reg := openmetrics.NewConsistentRegistry(mockNow)
+	c := omexpvar.New()
+
+	err := c.Collect(t.Context(), reg)
+	for _, exp := range []string{
+		`omexpvar: "load_avg": family "expvar_load_avg" is already used by "load.avg"`,
+		`omexpvar: "load~avg": family "expvar_load_avg" is already used by "load.avg"`,
+	} {
+		if err == nil || !strings.Contains(err.Error(), exp) {
+			t.Errorf("expected error to contain %q, got %v", exp, err)
+		}
+	}
+
+	// collisions are only reported once
+	if err := c.Collect(t.Context(), reg); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	fams, err := reg.Snapshot()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	for _, fam := range fams {
+		if fam.Desc.Name == "expvar_load_avg" {
+			if exp, got := 0.5, fam.Series[0].Points[0].Value; exp != got {
+				t.Fatalf("expected %v, got %v", exp, got)
+			}
+		}
+	}
+}
+
+func TestCollector_errors(t *testing.T) {
+	var errs []error
+	reg := openmetrics.NewConsistentRegistry(mockNow)
+	reg.OnError = func(err error) { errs = append(errs, err) }
+	reg.Gauge(openmetrics.Desc{Name: "expvar_jobs"})
+
+	c := omexpvar.New(
+		omexpvar.Func("stats",
+			omexpvar.Field{Path: "missing", Desc: openmetrics.Desc{Name: "stats_missing"}},
+			omexpvar.Field{Path: "pools", Desc: openmetrics.Desc{Name: "stats_pools"}},
+		),
+	)
+
+	err := c.Collect(t.Context(), reg)
+	for _, exp := range []string{
+		`omexpvar: "jobs": metric "expvar_jobs" is already registered`,
+		`omexpvar: "stats": field "missing" not found`,
+		`omexpvar: "stats": field "pools" is not numeric`,
+	} {
+		if err == nil || !strings.Contains(err.Error(), exp) {
+			t.Errorf("expected error to contain %q, got %v", exp, err)
+		}
+	}
+	var conflict openmetrics.ErrAlreadyRegistered
+	if !errors.As(err, &conflict) {
+		t.Errorf("expected ErrAlreadyRegistered, got %v", err)
+	}
+
+	// conflicts are only reported once
+	err = c.Collect(t.Context(), reg)
+	if err == nil || strings.Contains(err.Error(), "already registered") {
+		t.Errorf("expected conflict to be omitted, got %v", err)
+	}
+}
+
+func checkOutput(t *testing.T, reg *openmetrics.Registry, exp string) {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if _, err := reg.WriteTo(&buf); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	exp = strings.ReplaceAll(exp, "\t", "")
+	exp = strings.TrimSpace(exp) + "\n"
+	if got := buf.String(); exp != got {
+		t.Fatalf("output mismatch:\n--> EXPECTED\n%s--> GOT\n%s", exp, got)
+	}
+}
@@ -0,0 +1,297 @@
+// Package omfederate aggregates metrics scraped from multiple targets and
+// re-exposes them as a single document.
+package omfederate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/bsm/openmetrics"
+	"github.com/bsm/openmetrics/omscrape"
+)
+
+// Target is a scrape target.
+type Target struct {
+	// URL of the target's metrics endpoint.
+	URL string
+	// Labels are added to all series scraped from the target and should
+	// uniquely identify it. Scraped labels with the same names are renamed
+	// with an "exported_" prefix. Default: instance=<host:port>.
+	Labels openmetrics.LabelSet
+}
+
+// Proxy periodically scrapes targets and re-exposes their metric families.
+// Families of the same name and type are merged. Targets which have not been
+// scraped successfully for a while are considered stale and dropped.
+type Proxy struct {
+	conf config
+
+	mu      sync.Mutex
+	targets []Target
+	states  map[string]*targetState
+}
+
+type targetState struct {
+	fams    []openmetrics.FamilySnapshot
+	updated time.Time
+}
+
+// New inits a new Proxy for the given targets.
+func New(targets []Target, opts ...Option) *Proxy {
+	conf := config{
+		interval: 15 * time.Second,
+		onError:  openmetrics.WarnOnError,
+	}
+	for _, o := range opts {
+		o.update(&conf)
+	}
+	if conf.staleAfter == 0 {
+		conf.staleAfter = 3 * conf.interval
+	}
+	if conf.scraper == nil {
+		conf.scraper = omscrape.New(openmetrics.NewRegistry())
+	}
+
+	p := &Proxy{conf: conf, states: make(map[string]*targetState)}
+	p.SetTargets(targets)
+	return p
+}
+
+// SetTargets replaces the scrape targets. Metrics of removed targets are
+// dropped immediately.
+func (p *Proxy) SetTargets(targets []Target) {
+	normalized := make([]Target, 0, len(targets))
+	for _, t := range targets {
+		if len(t.Labels) == 0 {
+			if u, err := url.Parse(t.URL); err == nil {
+				t.Labels = openmetrics.Labels("instance", u.Host)
+			}
+		}
+		normalized = append(normalized, t)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.targets = normalized
+	for u := range p.states {
+		if !slices.ContainsFunc(normalized, func(t Target) bool { return t.URL == u }) {
+			delete(p.states, u)
+		}
+	}
+}
+
+// Run scrapes all targets at the configured interval. It blocks until the
+// context is cancelled.
+func (p *Proxy) Run(ctx context.Context) error {
+	ticker := time.NewTicker(p.conf.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := p.Scrape(ctx); err != nil {
+			p.conf.onError(err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// Scrape scrapes all targets concurrently, once. It returns the scrape
+// errors of all failed targets as well as conflicts between families of the
+// same name, but different types.
+func (p *Proxy) Scrape(ctx context.Context) error {
+	p.mu.Lock()
+	targets := p.targets
+	p.mu.Unlock()
+
+	var (
+		wg   sync.WaitGroup
+		errs = make([]error, len(targets))
+	)
+	for i, t := range targets {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			fams, err := p.conf.scraper.Scrape(ctx, t.URL)
+			if err != nil {
+				errs[i] = err
+				return
+			}
+
+			p.mu.Lock()
+			defer p.mu.Unlock()
+
+			// skip targets which have been removed in the meantime
+			if slices.ContainsFunc(p.targets, func(tt Target) bool { return tt.URL == t.URL }) {
+				p.states[t.URL] = &targetState{fams: fams, updated: time.Now()}
+			}
+		}()
+	}
+	wg.Wait()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// drop stale targets
+	for u, st := range p.states {
+		if time.Since(st.updated) > p.conf.staleAfter {
+			delete(p.states, u)
+		}
+	}
+
+	_, conflicts := p.merge()
+	return errors.Join(append(errs, conflicts...)...)
+}
+
+// Snapshot returns the merged metric families of all targets.
+func (p *Proxy) Snapshot() []openmetrics.FamilySnapshot {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	fams, _ := p.merge()
+	return fams
+}
+
+// WriteTo implements io.WriterTo interface and writes the merged metric
+// families of all targets as an OpenMetrics text document.
+func (p *Proxy) WriteTo(w io.Writer) (int64, error) {
+	return openmetrics.WriteText(w, p.Snapshot())
+}
+
+// ServeHTTP implements http.Handler and serves the merged metric families of
+// all targets as an OpenMetrics text document. Write errors are passed to the
+// error handler.
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", openmetrics.ContentType)
+	if _, err := p.WriteTo(w); err != nil {
+		p.conf.onError(err)
+	}
+}
+
+// merge merges the families of all targets which are not stale. It must be
+// called while holding the lock.
+func (p *Proxy) merge() ([]openmetrics.FamilySnapshot, []error) {
+	var (
+		fams   []openmetrics.FamilySnapshot
+		index  = make(map[string]int)
+		errs   []error
+		cutoff = time.Now().Add(-p.conf.staleAfter)
+	)
+
+	for _, t := range p.targets {
+		st := p.states[t.URL]
+		if st == nil || st.updated.Before(cutoff) {
+			continue
+		}
+
+		for _, fam := range st.fams {
+			name := fam.Desc.FullName()
+			pos, ok := index[name]
+			if !ok {
+				pos = len(fams)
+				index[name] = pos
+				fams = append(fams, openmetrics.FamilySnapshot{
+					Desc: openmetrics.Desc{Name: fam.Desc.Name, Unit: fam.Desc.Unit},
+					Type: fam.Type,
+				})
+			}
+
+			merged := &fams[pos]
+			if merged.Type != fam.Type || merged.Desc.Unit != fam.Desc.Unit {
+				errs = append(errs, fmt.Errorf("omfederate: %s family %q from %s conflicts with %s family", fam.Type, name, t.URL, merged.Type))
+				continue
+			}
+			if merged.Desc.Help == "" {
+				merged.Desc.Help = fam.Desc.Help
+			}
+
+			for _, s := range fam.Series {
+				labels := withTargetLabels(t.Labels, s.Labels)
+				for _, l := range labels {
+					if !slices.Contains(merged.Desc.Labels, l.Name) {
+						merged.Desc.Labels = append(merged.Desc.Labels, l.Name)
+					}
+				}
+				merged.Series = append(merged.Series, openmetrics.SeriesSnapshot{
+					Labels: labels,
+					Points: slices.Clone(s.Points),
+				})
+			}
+		}
+	}
+	return fams, errs
+}
+
+// withTargetLabels prepends target labels to a series label set, renaming
+// conflicting series labels.
+func withTargetLabels(target, series openmetrics.LabelSet) openmetrics.LabelSet {
+	labels := make(openmetrics.LabelSet, 0, len(target)+len(series))
+	labels = append(labels, target...)
+	for _, l := range series {
+		if slices.ContainsFunc(target, func(tl openmetrics.Label) bool { return tl.Name == l.Name }) {
+			l.Name = "exported_" + l.Name
+		}
+		labels = append(labels, l)
+	}
+	return labels
+}
+
+// ----------------------------------------------------------------------------
+
+type config struct {
+	interval   time.Duration
+	staleAfter time.Duration
+	scraper    *omscrape.Scraper
+	onError    openmetrics.ErrorHandler
+}
+
+// An Option configures the Proxy.
+type Option interface {
+	update(*config)
+}
+
+type inlineOption func(*config)
+
+func (f inlineOption) update(c *config) { f(c) }
+
+// Interval sets the scrape interval used by Run. Default: 15s.
+// Non-positive values are ignored.
+func Interval(d time.Duration) Option {
+	return inlineOption(func(c *config) {
+		if d > 0 {
+			c.interval = d
+		}
+	})
+}
+
+// StaleAfter sets the duration after which targets without a successful
+// scrape are dropped. Until then, the results of their last successful scrape
+// are exposed. Default: three times the interval.
+func StaleAfter(d time.Duration) Option {
+	return inlineOption(func(c *config) { c.staleAfter = d })
+}
+
+// Scraper sets a custom scraper, e.g. to configure timeouts, authorization
+// headers or where scrape health is reported. Default: a scraper which
+// reports health on a private registry, see omscrape.New.
+func Scraper(s *omscrape.Scraper) Option {
+	return inlineOption(func(c *config) { c.scraper = s })
+}
+
+// OnError sets a custom error handler for errors during periodic scrapes and
+// while serving HTTP requests. Default: openmetrics.WarnOnError.
+func OnError(fn openmetrics.ErrorHandler) Option {
+	return inlineOption(func(c *config) { c.onError = fn })
+}
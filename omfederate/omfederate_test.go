@@ -0,0 +1,147 @@
+package omfederate_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bsm/openmetrics"
+	"github.com/bsm/openmetrics/omfederate"
+	"github.com/bsm/openmetrics/omscrape"
+)
+
+func TestProxy(t *testing.T) {
+	srv1 := newMockTarget(`# TYPE jobs counter
+# HELP jobs Jobs.
+jobs_total{kind="a"} 3
+# TYPE temp gauge
+temp{instance="x"} 21.5
+# EOF
+`)
+	defer srv1.Close()
+
+	srv2 := newMockTarget(`# TYPE jobs counter
+jobs_total{kind="b"} 4
+# TYPE temp counter
+temp_total 1
+# EOF
+`)
+	defer srv2.Close()
+
+	p := omfederate.New([]omfederate.Target{
+		{URL: srv1.URL, Labels: openmetrics.Labels("instance", "one")},
+		{URL: srv2.URL, Labels: openmetrics.Labels("instance", "two")},
+	}, omfederate.Scraper(omscrape.New(openmetrics.NewRegistry())), omfederate.StaleAfter(100*time.Millisecond))
+
+	err := p.Scrape(context.Background())
+	if err == nil || !strings.Contains(err.Error(), `counter family "temp" from `+srv2.URL+` conflicts with gauge family`) {
+		t.Fatalf("expected conflict error, got %v", err)
+	}
+
+	var buf bytes.Buffer
+	if _, err := p.WriteTo(&buf); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if exp, got := strings.Join([]string{
+		`# TYPE jobs counter`,
+		`# HELP jobs Jobs.`,
+		`jobs_total{instance="one",kind="a"} 3`,
+		`jobs_total{instance="two",kind="b"} 4`,
+		`# TYPE temp gauge`,
+		`temp{instance="one",exported_instance="x"} 21.5`,
+		`# EOF`,
+	}, "\n")+"\n", buf.String(); exp != got {
+		t.Fatalf("expected:\n%v\ngot:\n%v", exp, got)
+	}
+
+	if exp, got := []string{"instance", "kind"}, p.Snapshot()[0].Desc.Labels; !reflect.DeepEqual(exp, got) {
+		t.Fatalf("expected %v, got %v", exp, got)
+	}
+
+	// second target goes down, its metrics are kept until stale
+	srv2.down.Store(true)
+	if err := p.Scrape(context.Background()); err == nil {
+		t.Fatalf("expected error")
+	}
+	if exp, got := 2, len(p.Snapshot()[0].Series); exp != got {
+		t.Fatalf("expected %v, got %v", exp, got)
+	}
+
+	time.Sleep(150 * time.Millisecond)
+	_ = p.Scrape(context.Background())
+	if exp, got := 1, len(p.Snapshot()[0].Series); exp != got {
+		t.Fatalf("expected %v, got %v", exp, got)
+	}
+}
+
+func TestProxy_SetTargets(t *testing.T) {
+	srv := newMockTarget("# TYPE up gauge\nup 1\n# EOF\n")
+	defer srv.Close()
+
+	p := omfederate.New([]omfederate.Target{{URL: srv.URL}}, omfederate.Scraper(omscrape.New(openmetrics.NewRegistry())))
+	if err := p.Scrape(context.Background()); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	fams := p.Snapshot()
+	if exp, got := openmetrics.Labels("instance", strings.TrimPrefix(srv.URL, "http://")), fams[0].Series[0].Labels; !reflect.DeepEqual(exp, got) {
+		t.Fatalf("expected %v, got %v", exp, got)
+	}
+
+	p.SetTargets(nil)
+	if exp, got := 0, len(p.Snapshot()); exp != got {
+		t.Fatalf("expected %v, got %v", exp, got)
+	}
+}
+
+func TestProxy_ServeHTTP(t *testing.T) {
+	var errs []error
+	p1 := omfederate.New(nil, omfederate.OnError(func(err error) { errs = append(errs, err) }))
+	p2 := omfederate.New(nil)
+
+	w := httptest.NewRecorder()
+	p2.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	if exp, got := "# EOF\n", w.Body.String(); exp != got {
+		t.Fatalf("expected %q, got %q", exp, got)
+	}
+
+	p1.ServeHTTP(failingResponseWriter{w}, httptest.NewRequest("GET", "/metrics", nil))
+	if exp, got := 1, len(errs); exp != got {
+		t.Fatalf("expected %v, got %v", exp, got)
+	}
+}
+
+// ----------------------------------------------------------------------------
+
+type failingResponseWriter struct {
+	http.ResponseWriter
+}
+
+func (failingResponseWriter) Write([]byte) (int, error) {
+	return 0, io.ErrClosedPipe
+}
+
+type mockTarget struct {
+	*httptest.Server
+	down atomic.Bool
+}
+
+func newMockTarget(doc string) *mockTarget {
+	m := new(mockTarget)
+	m.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		if m.down.Load() {
+			http.Error(w, "Unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", openmetrics.ContentType)
+		_, _ = io.WriteString(w, doc)
+	}))
+	return m
+}
@@ -0,0 +1,193 @@
+// Package omgraphite renders metrics in the Graphite plaintext protocol.
+package omgraphite
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bsm/openmetrics"
+	"github.com/bsm/openmetrics/internal/netpush"
+)
+
+// Writer renders snapshots of a Registry as Graphite plaintext. Each point is
+// written as a dotted path built from the prefix, the metric name, unit,
+// suffix and a name and value segment for each label, followed by the value
+// and a timestamp.
+type Writer struct {
+	reg  *openmetrics.Registry
+	conf config
+}
+
+// NewWriter inits a new writer.
+func NewWriter(reg *openmetrics.Registry, opts ...Option) *Writer {
+	conf := config{
+		sanitize: Sanitize,
+		now:      time.Now,
+		interval: time.Minute,
+		onError:  openmetrics.WarnOnError,
+	}
+	for _, o := range opts {
+		o.update(&conf)
+	}
+
+	if reg == nil {
+		reg = openmetrics.DefaultRegistry()
+	}
+	return &Writer{reg: reg, conf: conf}
+}
+
+// WriteTo implements io.WriterTo interface.
+func (w *Writer) WriteTo(dst io.Writer) (int64, error) {
+	fams, err := w.reg.Snapshot()
+	if err != nil {
+		return 0, err
+	}
+
+	ts := strconv.FormatInt(w.conf.now().Unix(), 10)
+	bw := bufio.NewWriter(dst)
+	var total int64
+	var b []byte
+	for _, fam := range fams {
+		for _, s := range fam.Series {
+			for _, pt := range s.Points {
+				if math.IsNaN(pt.Value) || math.IsInf(pt.Value, 0) {
+					continue
+				}
+
+				b = w.appendPath(b[:0], &fam.Desc, s.Labels, &pt)
+				b = append(b, ' ')
+				b = strconv.AppendFloat(b, pt.Value, 'f', -1, 64)
+				b = append(b, ' ')
+				b = append(b, ts...)
+				b = append(b, '\n')
+
+				n, err := bw.Write(b)
+				total += int64(n)
+				if err != nil {
+					return total, err
+				}
+			}
+		}
+	}
+	return total, bw.Flush()
+}
+
+// Run connects to a Graphite server and pushes metrics at the configured
+// interval. It blocks until the context is cancelled. A new connection is
+// established for each push.
+func (w *Writer) Run(ctx context.Context, network, address string) error {
+	netpush.Run(ctx, w.conf.interval, network, address, w, w.conf.onError)
+	return nil
+}
+
+// Push connects to a Graphite server and pushes metrics once.
+func (w *Writer) Push(ctx context.Context, network, address string) error {
+	return netpush.Push(ctx, network, address, w)
+}
+
+func (w *Writer) appendPath(b []byte, desc *openmetrics.Desc, labels openmetrics.LabelSet, pt *openmetrics.MetricPoint) []byte {
+	b = append(b, w.conf.prefix...)
+	b = append(b, w.conf.sanitize(desc.Name)...)
+	if desc.Unit != "" {
+		b = append(b, '.')
+		b = append(b, w.conf.sanitize(desc.Unit)...)
+	}
+	if sfx := pt.Suffix.String(); sfx != "" {
+		b = append(b, '.')
+		b = append(b, sfx[1:]...)
+	}
+	for _, l := range labels {
+		b = w.appendLabel(b, l)
+	}
+	return w.appendLabel(b, pt.Label)
+}
+
+// appendLabel appends the label as name and value segments, empty labels are
+// omitted.
+func (w *Writer) appendLabel(b []byte, l openmetrics.Label) []byte {
+	if l.IsZero() {
+		return b
+	}
+	b = append(b, '.')
+	b = append(b, w.conf.sanitize(l.Name)...)
+	b = append(b, '.')
+	b = append(b, w.conf.sanitize(l.Value)...)
+	return b
+}
+
+// Sanitize is the default sanitization function. It replaces all characters
+// except letters, digits, hyphens and underscores with underscores.
+func Sanitize(s string) string {
+	isValid := func(r rune) bool {
+		return (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '-' || r == '_'
+	}
+
+	for _, r := range s {
+		if !isValid(r) {
+			return strings.Map(func(r rune) rune {
+				if isValid(r) {
+					return r
+				}
+				return '_'
+			}, s)
+		}
+	}
+	return s
+}
+
+// ----------------------------------------------------------------------------
+
+type config struct {
+	prefix   string
+	sanitize func(string) string
+	now      func() time.Time
+	interval time.Duration
+	onError  openmetrics.ErrorHandler
+}
+
+// An Option configures the Writer.
+type Option interface {
+	update(*config)
+}
+
+type inlineOption func(*config)
+
+func (f inlineOption) update(c *config) { f(c) }
+
+// Prefix adds a prefix to all paths, e.g. "servers.web1.".
+func Prefix(prefix string) Option {
+	return inlineOption(func(c *config) { c.prefix = prefix })
+}
+
+// Sanitizer sets a custom function to sanitize path segments.
+// Default: Sanitize.
+func Sanitizer(fn func(string) string) Option {
+	return inlineOption(func(c *config) { c.sanitize = fn })
+}
+
+// TimeFunc sets a custom time function for point timestamps.
+// Default: time.Now.
+func TimeFunc(fn func() time.Time) Option {
+	return inlineOption(func(c *config) { c.now = fn })
+}
+
+// Interval sets the push interval used by Run. Default: 1m.
+// Non-positive values are ignored.
+func Interval(d time.Duration) Option {
+	return inlineOption(func(c *config) {
+		if d > 0 {
+			c.interval = d
+		}
+	})
+}
+
+// OnError sets a custom error handler for errors during periodic pushes.
+// Default: openmetrics.WarnOnError.
+func OnError(fn openmetrics.ErrorHandler) Option {
+	return inlineOption(func(c *config) { c.onError = fn })
+}
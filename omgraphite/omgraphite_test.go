@@ -0,0 +1,120 @@
+package omgraphite_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bsm/openmetrics"
+	"github.com/bsm/openmetrics/omgraphite"
+)
+
+func TestWriter_WriteTo(t *testing.T) {
+	reg := openmetrics.NewConsistentRegistry(mockNow)
+	reg.Counter(openmetrics.Desc{Name: "http_requests", Labels: []string{"path", "status"}}).With("/about.html", "200").Add(3)
+	reg.Gauge(openmetrics.Desc{Name: "temp", Unit: "celsius"}).With().Set(21.5)
+	reg.Histogram(openmetrics.Desc{Name: "latency", Unit: "seconds"}, []float64{.1}).With().Observe(0.05)
+
+	w := omgraphite.NewWriter(reg, omgraphite.Prefix("app."), omgraphite.TimeFunc(mockNow))
+
+	var buf bytes.Buffer
+	if n, err := w.WriteTo(&buf); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	} else if exp, got := int64(buf.Len()), n; exp != got {
+		t.Fatalf("expected %v, got %v", exp, got)
+	}
+
+	if exp, got := strings.Join([]string{
+		"app.http_requests.total.path._about_html.status.200 3 1515151515",
+		"app.http_requests.created.path._about_html.status.200 1515151515.7575758 1515151515",
+		"app.temp.celsius 21.5 1515151515",
+		"app.latency.seconds.bucket.le.0_1 1 1515151515",
+		"app.latency.seconds.bucket.le._Inf 1 1515151515",
+		"app.latency.seconds.count 1 1515151515",
+		"app.latency.seconds.sum 0.05 1515151515",
+		"app.latency.seconds.created 1515151515.7575758 1515151515",
+	}, "\n")+"\n", buf.String(); exp != got {
+		t.Fatalf("expected:\n%s\ngot:\n%s", exp, got)
+	}
+}
+
+func TestWriter_WriteTo_labelNames(t *testing.T) {
+	reg := openmetrics.NewConsistentRegistry(mockNow)
+	gauge := reg.Gauge(openmetrics.Desc{Name: "temp", Labels: []string{"a", "b"}})
+	gauge.With("x", "").Set(1)
+	gauge.With("", "x").Set(2)
+
+	var buf bytes.Buffer
+	if _, err := omgraphite.NewWriter(reg, omgraphite.TimeFunc(mockNow)).WriteTo(&buf); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if exp, got := strings.Join([]string{
+		"temp.b.x 2 1515151515",
+		"temp.a.x 1 1515151515",
+	}, "\n")+"\n", buf.String(); exp != got {
+		t.Fatalf("expected:\n%s\ngot:\n%s", exp, got)
+	}
+}
+
+func TestWriter_Run(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer lis.Close()
+
+	received := make(chan string, 10)
+	go func() {
+		for {
+			conn, err := lis.Accept()
+			if err != nil {
+				return
+			}
+			data, _ := io.ReadAll(conn)
+			_ = conn.Close()
+			received <- string(data)
+		}
+	}()
+
+	reg := openmetrics.NewConsistentRegistry(mockNow)
+	reg.Gauge(openmetrics.Desc{Name: "temp"}).With().Set(1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	w := omgraphite.NewWriter(reg, omgraphite.Interval(time.Millisecond), omgraphite.TimeFunc(mockNow))
+	go func() { _ = w.Run(ctx, "tcp", lis.Addr().String()) }()
+
+	select {
+	case got := <-received:
+		if exp := "temp 1 1515151515\n"; exp != got {
+			t.Fatalf("expected %q, got %q", exp, got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout")
+	}
+}
+
+func TestSanitize(t *testing.T) {
+	examples := []struct{ S, Exp string }{
+		{"foo", "foo"},
+		{"foo-bar_1", "foo-bar_1"},
+		{"/about.html", "_about_html"},
+		{"käse", "k_se"},
+	}
+	for _, x := range examples {
+		if got := omgraphite.Sanitize(x.S); x.Exp != got {
+			t.Errorf("expected %q, got %q", x.Exp, got)
+		}
+	}
+}
+
+// ----------------------------------------------------------------------------
+
+var mockTime = time.Unix(1515151515, 757575757)
+
+func mockNow() time.Time { return mockTime }
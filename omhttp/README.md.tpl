@@ -23,7 +23,7 @@ import (
 func main() {{ "ExampleNewHandler" | code }}
 ```
 
-To instrument HTTP servers:
+To instrument HTTP servers with custom metrics:
 
 ```go
 package main
@@ -43,3 +43,7 @@ import (
 
 func main() {{ "ExampleInstrument" | code }}
 ```
+
+Alternatively, `omhttp.Middleware` registers a ready-made set of request count, duration, size and in-flight families, labeled by method, status class and `http.ServeMux` route pattern.
+
+To instrument outgoing requests, wrap an `http.RoundTripper` with `omhttp.NewTransport`.
@@ -0,0 +1,167 @@
+package omhttp
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"net"
+	"net/http"
+	"net/netip"
+	"slices"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+type authConfig struct {
+	basicAuth    map[string][]byte
+	bearerTokens [][sha256.Size]byte
+	clientCerts  []string
+	requireCert  bool
+	networks     []netip.Prefix
+}
+
+func (c *authConfig) enabled() bool {
+	return len(c.basicAuth) != 0 || len(c.bearerTokens) != 0 || c.requireCert || len(c.networks) != 0
+}
+
+// BasicAuth requires requests to authenticate via HTTP basic auth. Users maps
+// user names to bcrypt password hashes, e.g. as generated by
+// bcrypt.GenerateFromPassword or `htpasswd -nbB`. When combined with
+// BearerTokens, either form of authentication is accepted.
+func BasicAuth(users map[string]string) HandlerOption {
+	return inlineHandlerOption(func(c *handlerConfig) {
+		if c.auth.basicAuth == nil {
+			c.auth.basicAuth = make(map[string][]byte, len(users))
+		}
+		for user, hash := range users {
+			c.auth.basicAuth[user] = []byte(hash)
+		}
+	})
+}
+
+// BearerTokens requires requests to authenticate with one of the given tokens
+// via an "Authorization: Bearer <token>" header. When combined with BasicAuth,
+// either form of authentication is accepted.
+func BearerTokens(tokens ...string) HandlerOption {
+	return inlineHandlerOption(func(c *handlerConfig) {
+		for _, token := range tokens {
+			c.auth.bearerTokens = append(c.auth.bearerTokens, sha256.Sum256([]byte(token)))
+		}
+	})
+}
+
+// ClientCertificate requires requests to present a TLS client certificate
+// which has been verified by the server, see tls.Config.ClientAuth. If names
+// are given, the leaf certificate's common name or one of its DNS names must
+// match one of them.
+func ClientCertificate(names ...string) HandlerOption {
+	return inlineHandlerOption(func(c *handlerConfig) {
+		c.auth.requireCert = true
+		c.auth.clientCerts = append(c.auth.clientCerts, names...)
+	})
+}
+
+// AllowNetworks only permits requests from remote addresses within the given
+// networks, e.g. netip.MustParsePrefix("10.0.0.0/8").
+func AllowNetworks(prefixes ...netip.Prefix) HandlerOption {
+	return inlineHandlerOption(func(c *handlerConfig) {
+		c.auth.networks = append(c.auth.networks, prefixes...)
+	})
+}
+
+// ----------------------------------------------------------------------------
+
+// dummyHash is compared against when a basic auth user is unknown, so
+// response times do not reveal valid user names.
+var dummyHash = sync.OnceValue(func() []byte {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("dummy"), bcrypt.DefaultCost)
+	return hash
+})
+
+func withAuth(h http.Handler, c authConfig) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(c.networks) != 0 && !c.allowNetwork(r) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		if c.requireCert && !c.allowCertificate(r) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+
+		if len(c.basicAuth) != 0 || len(c.bearerTokens) != 0 {
+			if !c.allowCredentials(r) {
+				if len(c.basicAuth) != 0 {
+					w.Header().Set("WWW-Authenticate", `Basic realm="metrics", charset="UTF-8"`)
+				} else {
+					w.Header().Set("WWW-Authenticate", `Bearer realm="metrics"`)
+				}
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+		}
+
+		h.ServeHTTP(w, r)
+	})
+}
+
+func (c *authConfig) allowNetwork(r *http.Request) bool {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+
+	for _, prefix := range c.networks {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *authConfig) allowCertificate(r *http.Request) bool {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return false
+	}
+	if len(c.clientCerts) == 0 {
+		return true
+	}
+
+	leaf := r.TLS.VerifiedChains[0][0]
+	if slices.Contains(c.clientCerts, leaf.Subject.CommonName) {
+		return true
+	}
+	for _, name := range leaf.DNSNames {
+		if slices.Contains(c.clientCerts, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *authConfig) allowCredentials(r *http.Request) bool {
+	if user, pass, ok := r.BasicAuth(); ok && len(c.basicAuth) != 0 {
+		hash, known := c.basicAuth[user]
+		if !known {
+			hash = dummyHash()
+		}
+		return bcrypt.CompareHashAndPassword(hash, []byte(pass)) == nil && known
+	}
+
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok && len(c.bearerTokens) != 0 {
+		// compare digests of equal length in constant time
+		digest := sha256.Sum256([]byte(strings.TrimSpace(token)))
+		match := 0
+		for _, t := range c.bearerTokens {
+			match |= subtle.ConstantTimeCompare(digest[:], t[:])
+		}
+		return match == 1
+	}
+	return false
+}
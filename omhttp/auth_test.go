@@ -0,0 +1,117 @@
+package omhttp_test
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	"github.com/bsm/openmetrics"
+	"github.com/bsm/openmetrics/omhttp"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestBasicAuth(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("s3cret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	reg := openmetrics.NewConsistentRegistry(mockNow)
+	ep := omhttp.NewHandler(reg, omhttp.BasicAuth(map[string]string{"prom": string(hash)}), omhttp.BearerTokens("t0ken"))
+
+	examples := []struct {
+		User, Pass, Token string
+		Code              int
+	}{
+		{"", "", "", http.StatusUnauthorized},
+		{"prom", "s3cret", "", http.StatusOK},
+		{"prom", "wrong", "", http.StatusUnauthorized},
+		{"other", "s3cret", "", http.StatusUnauthorized},
+		{"", "", "t0ken", http.StatusOK},
+		{"", "", "wrong", http.StatusUnauthorized},
+	}
+	for _, x := range examples {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/metrics", nil)
+		if x.User != "" {
+			r.SetBasicAuth(x.User, x.Pass)
+		}
+		if x.Token != "" {
+			r.Header.Set("Authorization", "Bearer "+x.Token)
+		}
+		ep.ServeHTTP(w, r)
+
+		if exp, got := x.Code, w.Code; exp != got {
+			t.Fatalf("expected: %v, got: %v (%+v)", exp, got, x)
+		}
+		if x.Code == http.StatusUnauthorized && w.Header().Get("WWW-Authenticate") == "" {
+			t.Fatalf("expected WWW-Authenticate header (%+v)", x)
+		}
+	}
+}
+
+func TestClientCertificate(t *testing.T) {
+	reg := openmetrics.NewConsistentRegistry(mockNow)
+	ep := omhttp.NewHandler(reg, omhttp.ClientCertificate("prometheus"))
+
+	examples := []struct {
+		TLS  *tls.ConnectionState
+		Code int
+	}{
+		{nil, http.StatusForbidden},
+		{&tls.ConnectionState{}, http.StatusForbidden},
+		{&tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{
+			{Subject: pkix.Name{CommonName: "prometheus"}},
+		}}}, http.StatusOK},
+		{&tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{
+			{Subject: pkix.Name{CommonName: "client"}, DNSNames: []string{"prometheus"}},
+		}}}, http.StatusOK},
+		{&tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{
+			{Subject: pkix.Name{CommonName: "other"}},
+		}}}, http.StatusForbidden},
+	}
+	for i, x := range examples {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/metrics", nil)
+		r.TLS = x.TLS
+		ep.ServeHTTP(w, r)
+
+		if exp, got := x.Code, w.Code; exp != got {
+			t.Fatalf("expected: %v, got: %v (#%d)", exp, got, i)
+		}
+	}
+}
+
+func TestAllowNetworks(t *testing.T) {
+	reg := openmetrics.NewConsistentRegistry(mockNow)
+	ep := omhttp.NewHandler(reg, omhttp.AllowNetworks(
+		netip.MustParsePrefix("10.0.0.0/8"),
+		netip.MustParsePrefix("fd00::/8"),
+	))
+
+	examples := []struct {
+		RemoteAddr string
+		Code       int
+	}{
+		{"10.1.2.3:1234", http.StatusOK},
+		{"[::ffff:10.1.2.3]:1234", http.StatusOK},
+		{"[fd00::1]:1234", http.StatusOK},
+		{"192.0.2.1:1234", http.StatusForbidden},
+		{"[2001:db8::1]:1234", http.StatusForbidden},
+		{"invalid", http.StatusForbidden},
+	}
+	for _, x := range examples {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/metrics", nil)
+		r.RemoteAddr = x.RemoteAddr
+		ep.ServeHTTP(w, r)
+
+		if exp, got := x.Code, w.Code; exp != got {
+			t.Fatalf("expected: %v, got: %v (%s)", exp, got, x.RemoteAddr)
+		}
+	}
+}
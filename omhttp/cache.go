@@ -0,0 +1,109 @@
+package omhttp
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// document is a rendered and optionally compressed document.
+type document struct {
+	body        []byte
+	contentType string
+	encoding    string
+	etag        string
+}
+
+func (d *document) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	header := w.Header()
+	header.Set("ETag", d.etag)
+	if etagMatch(r.Header.Get("If-None-Match"), d.etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	header.Set("Content-Type", d.contentType)
+	if d.encoding != "" {
+		header.Set(headerContentEncoding, d.encoding)
+	}
+	_, _ = w.Write(d.body)
+}
+
+// etagMatch performs a weak comparison of an If-None-Match header against
+// an entity tag, as specified in RFC 9110, Section 13.1.2.
+func etagMatch(header, etag string) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == "*" || tag == etag {
+			return true
+		}
+	}
+	return false
+}
+
+type cacheKey struct {
+	json     bool
+	encoding string
+}
+
+type cacheEntry struct {
+	ready   chan struct{}
+	doc     *document
+	err     error
+	expires time.Time
+}
+
+// cache stores documents for a limited time. Concurrent requests for
+// a missing document wait for a single rendering.
+type cache struct {
+	ttl     time.Duration
+	entries map[cacheKey]*cacheEntry
+	mu      sync.Mutex
+}
+
+func newCache(ttl time.Duration) *cache {
+	return &cache{ttl: ttl, entries: make(map[cacheKey]*cacheEntry)}
+}
+
+// Get returns a cached document or builds one. Errors are returned to all
+// concurrent callers but are not cached. The document is built in the
+// background, callers stop waiting for it when their ctx is done.
+func (c *cache) Get(ctx context.Context, key cacheKey, build func() (*document, error)) (*document, error) {
+	c.mu.Lock()
+	e, ok := c.entries[key]
+	if ok {
+		select {
+		case <-e.ready:
+			ok = time.Now().Before(e.expires)
+		default:
+		}
+	}
+	if !ok {
+		e = &cacheEntry{ready: make(chan struct{})}
+		c.entries[key] = e
+		go c.fill(key, e, build)
+	}
+	c.mu.Unlock()
+
+	select {
+	case <-e.ready:
+		return e.doc, e.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (c *cache) fill(key cacheKey, e *cacheEntry, build func() (*document, error)) {
+	e.doc, e.err = build()
+	e.expires = time.Now().Add(c.ttl)
+	if e.err != nil {
+		c.mu.Lock()
+		if c.entries[key] == e {
+			delete(c.entries, key)
+		}
+		c.mu.Unlock()
+	}
+	close(e.ready)
+}
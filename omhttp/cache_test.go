@@ -0,0 +1,52 @@
+package omhttp
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCache_Get_cancel(t *testing.T) {
+	c := newCache(time.Minute)
+	key := cacheKey{encoding: "gzip"}
+	started, release := make(chan struct{}), make(chan struct{})
+	build := func() (*document, error) {
+		close(started)
+		<-release
+		return &document{body: []byte("data")}, nil
+	}
+
+	// the first caller is cancelled while the document is being built
+	ctx, cancel := context.WithCancel(context.Background())
+	first := make(chan error, 1)
+	go func() {
+		_, err := c.Get(ctx, key, build)
+		first <- err
+	}()
+	<-started
+
+	second := make(chan *document, 1)
+	go func() {
+		doc, _ := c.Get(context.Background(), key, func() (*document, error) {
+			t.Error("expected no second build")
+			return nil, nil
+		})
+		second <- doc
+	}()
+
+	cancel()
+	if err := <-first; !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+
+	// waiting callers still receive the document
+	close(release)
+	doc := <-second
+	if doc == nil {
+		t.Fatal("expected a document")
+	}
+	if exp, got := "data", string(doc.body); exp != got {
+		t.Fatalf("expected: %q, got: %q", exp, got)
+	}
+}
@@ -0,0 +1,109 @@
+package omhttp
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	encodingGzip     = "gzip"
+	encodingDeflate  = "deflate"
+	encodingZstd     = "zstd"
+	encodingIdentity = "identity"
+)
+
+// supportedEncodings lists supported content codings in order of preference.
+var supportedEncodings = []string{encodingZstd, encodingGzip, encodingDeflate}
+
+// negotiateEncoding selects a content coding based on an Accept-Encoding
+// header, as specified in RFC 9110, Section 12.5.3. It returns an empty string
+// if the response should not be encoded.
+func negotiateEncoding(header string) string {
+	if header == "" {
+		return ""
+	}
+
+	qs := make(map[string]float64, 4)
+	for _, qv := range parseQualityValues(header) {
+		if q, ok := qs[qv.value]; !ok || qv.q > q {
+			qs[qv.value] = qv.q
+		}
+	}
+	wildcard, hasWildcard := qs["*"]
+
+	var (
+		best  string
+		bestQ float64
+	)
+	for _, enc := range supportedEncodings {
+		q, ok := qs[enc]
+		if !ok && hasWildcard {
+			q, ok = wildcard, true
+		}
+		if ok && q > bestQ {
+			best, bestQ = enc, q
+		}
+	}
+	if best == "" {
+		return ""
+	}
+
+	// identity is acceptable unless explicitly excluded, but only preferred
+	// if it has a higher quality
+	if q, ok := qs[encodingIdentity]; ok && q > bestQ {
+		return ""
+	}
+	return best
+}
+
+// compressor is implemented by gzip.Writer, zlib.Writer and zstd.Encoder.
+type compressor interface {
+	io.WriteCloser
+	Reset(io.Writer)
+}
+
+// compressors maintains pools of compressors for each supported encoding.
+type compressors struct {
+	gzipLevel int
+	pools     map[string]*sync.Pool
+}
+
+func newCompressors(gzipLevel int) *compressors {
+	c := &compressors{gzipLevel: gzipLevel, pools: make(map[string]*sync.Pool, len(supportedEncodings))}
+	for _, enc := range supportedEncodings {
+		c.pools[enc] = &sync.Pool{New: func() any { return c.create(enc) }}
+	}
+	return c
+}
+
+func (c *compressors) create(encoding string) compressor {
+	switch encoding {
+	case encodingGzip:
+		z, _ := gzip.NewWriterLevel(nil, c.gzipLevel)
+		return z
+	case encodingDeflate:
+		z, _ := zlib.NewWriterLevel(nil, zlib.BestSpeed)
+		return z
+	case encodingZstd:
+		z, _ := zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedFastest), zstd.WithEncoderConcurrency(1))
+		return z
+	}
+	return nil
+}
+
+// Get returns a compressor for the given encoding, writing to w.
+func (c *compressors) Get(encoding string, w io.Writer) compressor {
+	z := c.pools[encoding].Get().(compressor)
+	z.Reset(w)
+	return z
+}
+
+// Put returns a closed compressor to the pool.
+func (c *compressors) Put(encoding string, z compressor) {
+	z.Reset(nil)
+	c.pools[encoding].Put(z)
+}
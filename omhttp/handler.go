@@ -1,13 +1,20 @@
 package omhttp
 
 import (
+	"bytes"
 	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
-	"strings"
+	"strconv"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/bsm/openmetrics"
+	"github.com/bsm/openmetrics/internal/metro"
 )
 
 // DefaultHandler is a short-cut for NewHandler(openmetrics.DefaultRegistry(), opts...).
@@ -16,12 +23,26 @@ func DefaultHandler(opts ...HandlerOption) http.Handler {
 }
 
 type handler struct {
-	reg *openmetrics.Registry
+	reg         *openmetrics.Registry
+	timeout     time.Duration
+	compressors *compressors // nil if compression is disabled
+	minCompress int
+	cache       *cache // nil if caching is disabled
 }
 
-// NewHandler inits a new handler.
+// NewHandler inits a new handler. Metrics are served in the OpenMetrics text
+// format or as JSON, if requested via an "Accept: application/json" header or
+// a "?format=json" query parameter.
+//
+// Documents are rendered in full before they are sent. Rendering is aborted
+// when the request context is cancelled or when the scrape timeout advertised
+// by Prometheus via the X-Prometheus-Scrape-Timeout-Seconds header has
+// elapsed, in which case the handler responds with 503 Service Unavailable.
+//
+// Unless disabled, responses are compressed with zstd, gzip or deflate,
+// as negotiated via the Accept-Encoding request header.
 func NewHandler(reg *openmetrics.Registry, opts ...HandlerOption) http.Handler {
-	var c handlerConfig
+	c := handlerConfig{gzipLevel: gzip.BestSpeed}
 	for _, o := range opts {
 		o.update(&c)
 	}
@@ -30,25 +51,168 @@ func NewHandler(reg *openmetrics.Registry, opts ...HandlerOption) http.Handler {
 		reg = openmetrics.DefaultRegistry()
 	}
 
-	var h http.Handler = handler{reg: reg}
+	hh := handler{reg: reg, timeout: c.timeout, minCompress: c.minCompressSize}
 	if skip := c.noCompression; !skip {
-		h = withCompression(h)
+		if c.gzipLevel < gzip.HuffmanOnly || c.gzipLevel > gzip.BestCompression {
+			c.gzipLevel = gzip.DefaultCompression
+		}
+		hh.compressors = newCompressors(c.gzipLevel)
+	}
+	if c.cacheTTL > 0 {
+		hh.cache = newCache(c.cacheTTL)
+	}
+
+	var h http.Handler = hh
+
+	var sm *selfMetrics
+	if c.selfMetrics != nil {
+		sm = newSelfMetrics(c.selfMetrics)
 	}
 	if n := c.limitConcurrency; n > 0 {
-		h = limitConcurrency(h, n)
+		h = limitConcurrency(h, n, sm)
+	}
+	if c.auth.enabled() {
+		h = withAuth(h, c.auth)
+	}
+	if sm != nil {
+		h = sm.instrument(h)
 	}
 	return h
 }
 
 func (h handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	header := w.Header()
-	header.Set("Content-Type", openmetrics.ContentType)
+	header.Add(headerVary, headerAccept)
+
+	var encoding string
+	if h.compressors != nil {
+		header.Add(headerVary, headerAcceptEncoding)
+		encoding = negotiateEncoding(r.Header.Get(headerAcceptEncoding))
+	}
+
+	ctx := r.Context()
+	if timeout := h.scrapeTimeout(r); timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	asJSON := wantsJSON(r)
+	if h.cache != nil {
+		doc, err := h.cache.Get(ctx, cacheKey{json: asJSON, encoding: encoding}, func() (*document, error) {
+			// shared by all waiting requests, only bound by the configured timeout
+			ctx := context.WithoutCancel(r.Context())
+			if h.timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, h.timeout)
+				defer cancel()
+			}
+			return h.build(ctx, asJSON, encoding)
+		})
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		doc.ServeHTTP(w, r)
+		return
+	}
+
+	buf := bufferPool.Get().(*bytes.Buffer)
+	defer bufferPool.Put(buf)
+	buf.Reset()
+
+	contentType, err := h.render(ctx, buf, asJSON)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	header.Set("Content-Type", contentType)
+	if encoding == "" || buf.Len() < h.minCompress {
+		_, _ = buf.WriteTo(w)
+		return
+	}
+
+	header.Set(headerContentEncoding, encoding)
+	_ = h.compress(w, buf, encoding)
+}
+
+// build renders and compresses a document for caching.
+func (h handler) build(ctx context.Context, asJSON bool, encoding string) (*document, error) {
+	buf := bufferPool.Get().(*bytes.Buffer)
+	defer bufferPool.Put(buf)
+	buf.Reset()
+
+	contentType, err := h.render(ctx, buf, asJSON)
+	if err != nil {
+		return nil, err
+	}
+
+	doc := &document{contentType: contentType}
+	if encoding == "" || buf.Len() < h.minCompress {
+		doc.body = bytes.Clone(buf.Bytes())
+	} else {
+		var out bytes.Buffer
+		if err := h.compress(&out, buf, encoding); err != nil {
+			return nil, err
+		}
+		doc.body = out.Bytes()
+		doc.encoding = encoding
+	}
+	doc.etag = fmt.Sprintf(`"%016x"`, metro.HashString(string(doc.body), 0))
+	return doc, nil
+}
+
+func (h handler) compress(w io.Writer, buf *bytes.Buffer, encoding string) error {
+	z := h.compressors.Get(encoding, w)
+	defer h.compressors.Put(encoding, z)
+
+	if _, err := buf.WriteTo(z); err != nil {
+		return err
+	}
+	return z.Close()
+}
+
+func (h handler) render(ctx context.Context, buf *bytes.Buffer, asJSON bool) (string, error) {
+	if asJSON {
+		fams, err := h.reg.SnapshotContext(ctx)
+		if err != nil {
+			return "", err
+		}
+		_, err = openmetrics.WriteJSON(buf, fams)
+		return openmetrics.JSONContentType, err
+	}
+
+	_, err := h.reg.WriteToContext(ctx, buf)
+	return openmetrics.ContentType, err
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+		http.Error(w, "Metrics collection was aborted: "+err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+
+	msg := "An internal error has occurred:\n\n" + err.Error()
+	http.Error(w, msg, http.StatusInternalServerError)
+}
 
-	n, err := h.reg.WriteTo(w)
-	if err != nil && n == 0 {
-		msg := "An internal error has occurred:\n\n" + err.Error()
-		http.Error(w, msg, http.StatusInternalServerError)
+// scrapeTimeout returns the effective timeout, the lower of the configured
+// timeout and the one advertised by the scraper.
+func (h handler) scrapeTimeout(r *http.Request) time.Duration {
+	timeout := h.timeout
+	if v := r.Header.Get(headerScrapeTimeout); v != "" {
+		if secs, err := strconv.ParseFloat(v, 64); err == nil && secs > 0 {
+			if d := time.Duration(secs * float64(time.Second)); timeout <= 0 || d < timeout {
+				timeout = d
+			}
+		}
 	}
+	return timeout
+}
+
+var bufferPool = sync.Pool{
+	New: func() any { return new(bytes.Buffer) },
 }
 
 // ----------------------------------------------------------------------------
@@ -56,6 +220,12 @@ func (h handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 type handlerConfig struct {
 	noCompression    bool
 	limitConcurrency int
+	timeout          time.Duration
+	selfMetrics      *openmetrics.Registry
+	gzipLevel        int
+	minCompressSize  int
+	cacheTTL         time.Duration
+	auth             authConfig
 }
 
 // A HandlerOption configures the handler.
@@ -73,6 +243,18 @@ func NoCompression() HandlerOption {
 	return inlineHandlerOption(func(c *handlerConfig) { c.noCompression = true })
 }
 
+// GzipLevel sets the gzip compression level, see compress/gzip.
+// Default: gzip.BestSpeed.
+func GzipLevel(level int) HandlerOption {
+	return inlineHandlerOption(func(c *handlerConfig) { c.gzipLevel = level })
+}
+
+// MinCompressSize sets the minimum size of a response body in bytes. Smaller
+// bodies are sent uncompressed. Default: 0.
+func MinCompressSize(n int) HandlerOption {
+	return inlineHandlerOption(func(c *handlerConfig) { c.minCompressSize = n })
+}
+
 // LimitConcurrency limits the number of concurrent requests that
 // can be made to the handler. The endpoint will start responding
 // with 503 Service Unavailable once this limit is exceeded.
@@ -80,9 +262,84 @@ func LimitConcurrency(n int) HandlerOption {
 	return inlineHandlerOption(func(c *handlerConfig) { c.limitConcurrency = n })
 }
 
+// Timeout sets a maximum duration for rendering a document. The scrape
+// timeout advertised by Prometheus takes precedence when it is lower.
+// Default: no timeout.
+func Timeout(d time.Duration) HandlerOption {
+	return inlineHandlerOption(func(c *handlerConfig) { c.timeout = d })
+}
+
+// SelfMetrics records metrics about the handler itself into reg, i.e.
+// the number of scrapes by response code, scrape durations, response sizes
+// and requests rejected by LimitConcurrency. Families are registered when
+// the handler is created and it panics if any of them conflicts with an
+// existing registration. reg may be the same registry that is being served,
+// scrapes are recorded after the response has been written and are therefore
+// only reflected in subsequent scrapes.
+func SelfMetrics(reg *openmetrics.Registry) HandlerOption {
+	return inlineHandlerOption(func(c *handlerConfig) { c.selfMetrics = reg })
+}
+
+// CacheTTL caches rendered (and compressed) documents for the given duration.
+// Concurrent requests share a single rendering and receive identical bytes,
+// along with an ETag header. Conditional requests with a matching
+// If-None-Match header receive a 304 Not Modified response. Default: 0
+// (no caching).
+func CacheTTL(d time.Duration) HandlerOption {
+	return inlineHandlerOption(func(c *handlerConfig) { c.cacheTTL = d })
+}
+
 // ----------------------------------------------------------------------------
 
-func limitConcurrency(h http.Handler, n int) http.Handler {
+type selfMetrics struct {
+	scrapes    openmetrics.CounterFamily
+	duration   openmetrics.HistogramFamily
+	size       openmetrics.HistogramFamily
+	rejections openmetrics.CounterFamily
+}
+
+func newSelfMetrics(reg *openmetrics.Registry) *selfMetrics {
+	return &selfMetrics{
+		scrapes: reg.Counter(openmetrics.Desc{
+			Name:   "omhttp_handler_scrapes",
+			Help:   "Total number of scrapes by HTTP status code.",
+			Labels: []string{"code"},
+		}),
+		duration: reg.Histogram(openmetrics.Desc{
+			Name: "omhttp_handler_scrape_duration",
+			Unit: "seconds",
+			Help: "Duration of scrapes.",
+		}, defaultDurationBuckets),
+		size: reg.Histogram(openmetrics.Desc{
+			Name: "omhttp_handler_response_size",
+			Unit: "bytes",
+			Help: "Size of scrape responses, after compression.",
+		}, defaultSizeBuckets),
+		rejections: reg.Counter(openmetrics.Desc{
+			Name: "omhttp_handler_rejections",
+			Help: "Total number of scrapes rejected due to concurrency limits.",
+		}),
+	}
+}
+
+func (m *selfMetrics) instrument(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ww := NewResponseWriter(w, r.ProtoMajor)
+		start := time.Now()
+		h.ServeHTTP(ww, r)
+		elapsed := time.Since(start)
+
+		code := ww.Status()
+		if code == 0 {
+			code = http.StatusOK
+		}
+		m.scrapes.With(strconv.Itoa(code)).Add(1)
+		m.duration.With().Observe(elapsed.Seconds())
+		m.size.With().Observe(float64(ww.BytesWritten()))
+	})
+}
+
+func limitConcurrency(h http.Handler, n int, sm *selfMetrics) http.Handler {
 	concurrentRequests := new(int32)
 
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -90,6 +347,9 @@ func limitConcurrency(h http.Handler, n int) http.Handler {
 		defer atomic.AddInt32(concurrentRequests, -1)
 
 		if n > 0 && numRequests > n {
+			if sm != nil {
+				sm.rejections.With().Add(1)
+			}
 			http.Error(w, "Number of concurrent requests was exceeded", http.StatusServiceUnavailable)
 			return
 		}
@@ -100,51 +360,8 @@ func limitConcurrency(h http.Handler, n int) http.Handler {
 
 const (
 	headerVary            = "Vary"
+	headerAccept          = "Accept"
 	headerAcceptEncoding  = "Accept-Encoding"
 	headerContentEncoding = "Content-Encoding"
+	headerScrapeTimeout   = "X-Prometheus-Scrape-Timeout-Seconds"
 )
-
-func withCompression(h http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Add(headerVary, headerAcceptEncoding)
-
-		if accept := r.Header.Get(headerAcceptEncoding); strings.Contains(accept, "gzip") {
-			w.Header().Set(headerContentEncoding, "gzip")
-
-			z := newGzipResponseWriter(w)
-			defer func() { _ = z.Close() }()
-
-			h.ServeHTTP(z, r)
-		} else {
-			h.ServeHTTP(w, r)
-		}
-	})
-}
-
-var gzipResponseWriterPool sync.Pool
-
-type gzipResponseWriter struct {
-	http.ResponseWriter
-	z *gzip.Writer
-}
-
-func newGzipResponseWriter(rw http.ResponseWriter) *gzipResponseWriter {
-	if v := gzipResponseWriterPool.Get(); v != nil {
-		w := v.(*gzipResponseWriter)
-		w.z.Reset(rw)
-		return w
-	}
-
-	z, _ := gzip.NewWriterLevel(rw, gzip.BestSpeed)
-	return &gzipResponseWriter{ResponseWriter: rw, z: z}
-}
-
-func (w *gzipResponseWriter) Write(b []byte) (int, error) {
-	return w.z.Write(b)
-}
-
-func (w *gzipResponseWriter) Close() error {
-	err := w.z.Close()
-	gzipResponseWriterPool.Put(w)
-	return err
-}
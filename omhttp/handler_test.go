@@ -1,42 +1,47 @@
 package omhttp_test
 
 import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
 	"fmt"
+	"io"
 	"math"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"sync"
-	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/bsm/openmetrics"
 	"github.com/bsm/openmetrics/omhttp"
+	"github.com/klauspost/compress/zstd"
 )
 
 func TestNewHandler_limitConcurrency(t *testing.T) {
 	reg := openmetrics.NewConsistentRegistry(mockNow)
 	ep := omhttp.NewHandler(reg, omhttp.LimitConcurrency(1))
 
-	code := int32(http.StatusOK)
-	wg := new(sync.WaitGroup)
-	for i := 0; i < 1000; i++ {
-		wg.Add(1)
-
-		go func() {
-			defer wg.Done()
+	// hold the only slot until the second request has been served
+	blocked := newBlockingResponseWriter()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ep.ServeHTTP(blocked, httptest.NewRequest("GET", "/metrics", nil))
+	}()
+	<-blocked.writing
 
-			w := httptest.NewRecorder()
-			ep.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
-			atomic.CompareAndSwapInt32(&code, 200, int32(w.Code))
-		}()
+	w := httptest.NewRecorder()
+	ep.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	close(blocked.release)
+	<-done
 
-		if atomic.LoadInt32(&code) != 200 {
-			break
-		}
+	if exp, got := http.StatusServiceUnavailable, w.Code; exp != got {
+		t.Fatalf("expected: %v, got: %v", exp, got)
 	}
-	wg.Wait()
-
-	if exp, got := http.StatusServiceUnavailable, int(code); exp != got {
+	if exp, got := http.StatusOK, blocked.Code; exp != got {
 		t.Fatalf("expected: %v, got: %v", exp, got)
 	}
 }
@@ -73,3 +78,293 @@ func TestNewHandler_compression(t *testing.T) {
 		t.Fatalf("expected: %v, got: %v", exp, got)
 	}
 }
+
+func TestNewHandler_json(t *testing.T) {
+	reg := openmetrics.NewConsistentRegistry(mockNow)
+	reg.Gauge(openmetrics.Desc{Name: "temp"}).With().Set(21.5)
+	ep := omhttp.NewHandler(reg)
+
+	examples := []struct {
+		Target, Accept, ContentType string
+	}{
+		{"/metrics", "", openmetrics.ContentType},
+		{"/metrics", "application/openmetrics-text;version=1.0.0,application/json;q=0.5", openmetrics.ContentType},
+		{"/metrics", "application/json", openmetrics.JSONContentType},
+		{"/metrics", "text/html;q=0.9, application/json, */*;q=0.8", openmetrics.JSONContentType},
+		{"/metrics?format=json", "", openmetrics.JSONContentType},
+	}
+	for _, x := range examples {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", x.Target, nil)
+		if x.Accept != "" {
+			r.Header.Set("Accept", x.Accept)
+		}
+		ep.ServeHTTP(w, r)
+
+		if exp, got := x.ContentType, w.Header().Get("Content-Type"); exp != got {
+			t.Errorf("expected: %v, got: %v (%s %q)", exp, got, x.Target, x.Accept)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	ep.ServeHTTP(w, httptest.NewRequest("GET", "/metrics?format=json", nil))
+	if exp, got := `{"families":[{"name":"temp","type":"gauge","series":[{"points":[{"name":"temp","value":21.5}]}]}]}`+"\n", w.Body.String(); exp != got {
+		t.Fatalf("expected: %v, got: %v", exp, got)
+	}
+}
+
+func TestNewHandler_scrapeTimeout(t *testing.T) {
+	reg := openmetrics.NewConsistentRegistry(mockNow)
+	reg.Gauge(openmetrics.Desc{Name: "temp"}).With().Set(21.5)
+	ep := omhttp.NewHandler(reg, omhttp.NoCompression())
+
+	// scrape timeout advertised
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/metrics", nil)
+	r.Header.Set("X-Prometheus-Scrape-Timeout-Seconds", "10")
+	ep.ServeHTTP(w, r)
+
+	if exp, got := http.StatusOK, w.Code; exp != got {
+		t.Fatalf("expected: %v, got: %v", exp, got)
+	}
+	if exp, got := "# TYPE temp gauge\ntemp 21.5\n# EOF\n", w.Body.String(); exp != got {
+		t.Fatalf("expected: %q, got: %q", exp, got)
+	}
+
+	// request cancelled
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	w = httptest.NewRecorder()
+	ep.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil).WithContext(ctx))
+
+	if exp, got := http.StatusServiceUnavailable, w.Code; exp != got {
+		t.Fatalf("expected: %v, got: %v", exp, got)
+	}
+	if body := w.Body.String(); strings.Contains(body, "temp") {
+		t.Fatalf("expected no metrics, got: %q", body)
+	}
+}
+
+func TestNewHandler_selfMetrics(t *testing.T) {
+	reg := openmetrics.NewConsistentRegistry(mockNow)
+	ep := omhttp.NewHandler(reg, omhttp.NoCompression(), omhttp.LimitConcurrency(1), omhttp.SelfMetrics(reg))
+
+	// first scrape does not include itself
+	w := httptest.NewRecorder()
+	ep.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	if body := w.Body.String(); strings.Contains(body, "omhttp_handler_scrapes_total") {
+		t.Fatalf("expected no scrapes, got:\n%s", body)
+	}
+
+	// reject a concurrent scrape
+	blocked := newBlockingResponseWriter()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ep.ServeHTTP(blocked, httptest.NewRequest("GET", "/metrics", nil))
+	}()
+	<-blocked.writing
+	ep.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/metrics", nil))
+	close(blocked.release)
+	<-done
+
+	w = httptest.NewRecorder()
+	ep.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	for _, exp := range []string{
+		`omhttp_handler_scrapes_total{code="200"} 2`,
+		`omhttp_handler_scrapes_total{code="503"} 1`,
+		`omhttp_handler_scrape_duration_seconds_count 3`,
+		`omhttp_handler_response_size_bytes_count 3`,
+		`omhttp_handler_rejections_total 1`,
+	} {
+		if body := w.Body.String(); !strings.Contains(body, exp+"\n") {
+			t.Fatalf("expected output to contain:\n\t%s\ngot:\n%s", exp, body)
+		}
+	}
+}
+
+// blockingResponseWriter blocks on the first write until released.
+type blockingResponseWriter struct {
+	*httptest.ResponseRecorder
+	writing, release chan struct{}
+	once             sync.Once
+}
+
+func newBlockingResponseWriter() *blockingResponseWriter {
+	return &blockingResponseWriter{
+		ResponseRecorder: httptest.NewRecorder(),
+		writing:          make(chan struct{}),
+		release:          make(chan struct{}),
+	}
+}
+
+func (w *blockingResponseWriter) Write(p []byte) (int, error) {
+	w.once.Do(func() {
+		close(w.writing)
+		<-w.release
+	})
+	return w.ResponseRecorder.Write(p)
+}
+
+func TestNewHandler_encodings(t *testing.T) {
+	reg := openmetrics.NewConsistentRegistry(mockNow)
+	cnt := reg.Counter(openmetrics.Desc{Name: "http_requests", Labels: []string{"path"}})
+	for i := 0; i < 100; i++ {
+		cnt.With(fmt.Sprintf("/i%d", i)).Add(1)
+	}
+
+	var plain bytes.Buffer
+	if _, err := reg.WriteTo(&plain); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	decoders := map[string]func(io.Reader) (io.Reader, error){
+		"":        func(r io.Reader) (io.Reader, error) { return r, nil },
+		"gzip":    func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) },
+		"deflate": func(r io.Reader) (io.Reader, error) { return zlib.NewReader(r) },
+		"zstd":    func(r io.Reader) (io.Reader, error) { return zstd.NewReader(r) },
+	}
+
+	examples := []struct {
+		AcceptEncoding, Encoding string
+	}{
+		{"", ""},
+		{"gzip", "gzip"},
+		{"GZIP;q=0.8", "gzip"},
+		{"deflate, gzip;q=0.5", "deflate"},
+		{"gzip, deflate, br, zstd", "zstd"},
+		{"gzip;q=0.5, zstd;q=0.5", "zstd"},
+		{"zstd;q=0, gzip;q=0.1", "gzip"},
+		{"gzip;q=0", ""},
+		{"br", ""},
+		{"*", "zstd"},
+		{"*, zstd;q=0", "gzip"},
+		{"identity, gzip;q=0.5", ""},
+	}
+	for _, x := range examples {
+		ep := omhttp.NewHandler(reg)
+		for i := 0; i < 2; i++ { // exercise pooled compressors
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest("GET", "/metrics", nil)
+			r.Header.Set("Accept-Encoding", x.AcceptEncoding)
+			ep.ServeHTTP(w, r)
+
+			if exp, got := x.Encoding, w.Header().Get("Content-Encoding"); exp != got {
+				t.Fatalf("expected: %q, got: %q (%q)", exp, got, x.AcceptEncoding)
+			}
+			if exp, got := "Accept, Accept-Encoding", strings.Join(w.Header().Values("Vary"), ", "); exp != got {
+				t.Fatalf("expected: %q, got: %q", exp, got)
+			}
+
+			rd, err := decoders[x.Encoding](w.Body)
+			if err != nil {
+				t.Fatalf("expected no error, got %v (%q)", err, x.AcceptEncoding)
+			}
+			body, err := io.ReadAll(rd)
+			if err != nil {
+				t.Fatalf("expected no error, got %v (%q)", err, x.AcceptEncoding)
+			}
+			if exp, got := plain.String(), string(body); exp != got {
+				t.Fatalf("expected: %q, got: %q (%q)", exp, got, x.AcceptEncoding)
+			}
+		}
+	}
+}
+
+func TestNewHandler_minCompressSize(t *testing.T) {
+	reg := openmetrics.NewConsistentRegistry(mockNow)
+	reg.Gauge(openmetrics.Desc{Name: "temp"}).With().Set(21.5)
+
+	for _, x := range []struct {
+		MinSize  int
+		Encoding string
+	}{
+		{0, "gzip"},
+		{1024, ""},
+	} {
+		ep := omhttp.NewHandler(reg, omhttp.MinCompressSize(x.MinSize), omhttp.GzipLevel(gzip.BestCompression))
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/metrics", nil)
+		r.Header.Set("Accept-Encoding", "gzip")
+		ep.ServeHTTP(w, r)
+
+		if exp, got := x.Encoding, w.Header().Get("Content-Encoding"); exp != got {
+			t.Fatalf("expected: %q, got: %q", exp, got)
+		}
+	}
+}
+
+func TestNewHandler_cache(t *testing.T) {
+	reg := openmetrics.NewConsistentRegistry(mockNow)
+	gauge := reg.Gauge(openmetrics.Desc{Name: "temp"}).With()
+	gauge.Set(1)
+	ep := omhttp.NewHandler(reg, omhttp.CacheTTL(50*time.Millisecond))
+
+	get := func(acceptEncoding, ifNoneMatch string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/metrics", nil)
+		r.Header.Set("Accept-Encoding", acceptEncoding)
+		r.Header.Set("If-None-Match", ifNoneMatch)
+		ep.ServeHTTP(w, r)
+		return w
+	}
+
+	// concurrent requests share the same document
+	var wg sync.WaitGroup
+	responses := make([]*httptest.ResponseRecorder, 10)
+	for i := range responses {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			responses[i] = get("", "")
+		}()
+	}
+	wg.Wait()
+
+	etag := responses[0].Header().Get("ETag")
+	if etag == "" {
+		t.Fatal("expected ETag header")
+	}
+	for _, w := range responses {
+		if exp, got := "# TYPE temp gauge\ntemp 1\n# EOF\n", w.Body.String(); exp != got {
+			t.Fatalf("expected: %q, got: %q", exp, got)
+		}
+		if exp, got := etag, w.Header().Get("ETag"); exp != got {
+			t.Fatalf("expected: %q, got: %q", exp, got)
+		}
+	}
+
+	// cached until expired
+	gauge.Set(2)
+	if exp, got := "# TYPE temp gauge\ntemp 1\n# EOF\n", get("", "").Body.String(); exp != got {
+		t.Fatalf("expected: %q, got: %q", exp, got)
+	}
+
+	// conditional requests
+	if w := get("", `W/"other", `+etag); w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+		t.Fatalf("expected 304 without body, got %d %q", w.Code, w.Body.String())
+	}
+
+	// cached separately per encoding
+	w := get("gzip", etag)
+	if exp, got := http.StatusOK, w.Code; exp != got {
+		t.Fatalf("expected: %v, got: %v", exp, got)
+	}
+	if exp, got := "gzip", w.Header().Get("Content-Encoding"); exp != got {
+		t.Fatalf("expected: %q, got: %q", exp, got)
+	}
+	if got := w.Header().Get("ETag"); got == etag || got == "" {
+		t.Fatalf("expected a different ETag, got %q", got)
+	}
+
+	// re-rendered after expiry
+	time.Sleep(60 * time.Millisecond)
+	w = get("", etag)
+	if exp, got := "# TYPE temp gauge\ntemp 2\n# EOF\n", w.Body.String(); exp != got {
+		t.Fatalf("expected: %q, got: %q", exp, got)
+	}
+	if got := w.Header().Get("ETag"); got == etag {
+		t.Fatalf("expected a new ETag, got %q", got)
+	}
+}
@@ -0,0 +1,202 @@
+package omhttp
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/bsm/openmetrics"
+)
+
+// Middleware returns a batteries-included HTTP server instrumentation
+// middleware. It registers the following families on reg:
+//
+//	http_server_requests_total{method,code,route}
+//	http_server_request_duration_seconds{method,code,route}
+//	http_server_request_size_bytes{method,code,route}
+//	http_server_response_size_bytes{method,code,route}
+//	http_server_requests_in_flight{method}
+//
+// The code label contains the status class, e.g. "2xx". The route label
+// contains the pattern of the matched http.ServeMux route (see
+// http.Request.Pattern) and is empty for unmatched requests, so that the
+// number of series is not driven by request paths. Methods not defined by
+// RFC 9110 are reported as "OTHER".
+//
+// It panics if any of the families conflicts with an existing registration.
+func Middleware(reg *openmetrics.Registry, opts ...MiddlewareOption) func(http.Handler) http.Handler {
+	c := middlewareConfig{
+		prefix:          "http_server",
+		durationBuckets: defaultDurationBuckets,
+		sizeBuckets:     defaultSizeBuckets,
+	}
+	for _, o := range opts {
+		o.update(&c)
+	}
+
+	if reg == nil {
+		reg = openmetrics.DefaultRegistry()
+	}
+
+	labels := []string{"method", "code", "route"}
+	m := &middleware{
+		requests: reg.Counter(openmetrics.Desc{
+			Name:   c.prefix + "_requests",
+			Help:   "Total number of HTTP requests.",
+			Labels: labels,
+		}),
+		duration: reg.Histogram(openmetrics.Desc{
+			Name:   c.prefix + "_request_duration",
+			Unit:   "seconds",
+			Help:   "Duration of HTTP requests.",
+			Labels: labels,
+		}, c.durationBuckets),
+		requestSize: reg.Histogram(openmetrics.Desc{
+			Name:   c.prefix + "_request_size",
+			Unit:   "bytes",
+			Help:   "Size of HTTP request bodies.",
+			Labels: labels,
+		}, c.sizeBuckets),
+		responseSize: reg.Histogram(openmetrics.Desc{
+			Name:   c.prefix + "_response_size",
+			Unit:   "bytes",
+			Help:   "Size of HTTP response bodies.",
+			Labels: labels,
+		}, c.sizeBuckets),
+		inFlight: reg.Gauge(openmetrics.Desc{
+			Name:   c.prefix + "_requests_in_flight",
+			Help:   "Number of HTTP requests currently being served.",
+			Labels: []string{"method"},
+		}),
+		exemplar: c.exemplar,
+	}
+	return m.wrap
+}
+
+var (
+	defaultDurationBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+	defaultSizeBuckets     = []float64{100, 1000, 10000, 100000, 1000000, 10000000}
+)
+
+type middleware struct {
+	requests     openmetrics.CounterFamily
+	duration     openmetrics.HistogramFamily
+	requestSize  openmetrics.HistogramFamily
+	responseSize openmetrics.HistogramFamily
+	inFlight     openmetrics.GaugeFamily
+	exemplar     func(context.Context) openmetrics.LabelSet
+}
+
+func (m *middleware) wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method := normalizeMethod(r.Method)
+		inFlight := m.inFlight.With(method)
+		inFlight.Add(1)
+		defer inFlight.Add(-1)
+
+		body := &countingReadCloser{ReadCloser: r.Body}
+		if r.Body != nil {
+			r.Body = body
+		}
+
+		ww := NewResponseWriter(w, r.ProtoMajor)
+		start := time.Now()
+		next.ServeHTTP(ww, r)
+		elapsed := time.Since(start)
+
+		// r.Pattern is populated by http.ServeMux while serving.
+		code := statusClass(ww.Status())
+		m.observe(r.Context(), method, code, r.Pattern, elapsed, body.n, ww.BytesWritten())
+	})
+}
+
+func (m *middleware) observe(ctx context.Context, method, code, route string, elapsed time.Duration, reqBytes int64, respBytes int) {
+	var exemplar openmetrics.LabelSet
+	if m.exemplar != nil {
+		exemplar = m.exemplar(ctx)
+	}
+
+	if len(exemplar) != 0 {
+		m.requests.With(method, code, route).AddExemplar(&openmetrics.Exemplar{Value: 1, Labels: exemplar})
+		m.duration.With(method, code, route).ObserveExemplar(&openmetrics.Exemplar{Value: elapsed.Seconds(), Labels: exemplar})
+	} else {
+		m.requests.With(method, code, route).Add(1)
+		m.duration.With(method, code, route).Observe(elapsed.Seconds())
+	}
+	m.requestSize.With(method, code, route).Observe(float64(reqBytes))
+	m.responseSize.With(method, code, route).Observe(float64(respBytes))
+}
+
+func normalizeMethod(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace:
+		return method
+	case "":
+		return http.MethodGet
+	}
+	return "OTHER"
+}
+
+func statusClass(code int) string {
+	if code == 0 {
+		code = http.StatusOK
+	}
+	return strconv.Itoa(code/100) + "xx"
+}
+
+type countingReadCloser struct {
+	io.ReadCloser
+	n int64
+}
+
+func (r *countingReadCloser) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.n += int64(n)
+	return n, err
+}
+
+// ----------------------------------------------------------------------------
+
+type middlewareConfig struct {
+	prefix          string
+	durationBuckets []float64
+	sizeBuckets     []float64
+	exemplar        func(context.Context) openmetrics.LabelSet
+}
+
+// A MiddlewareOption configures the Middleware.
+type MiddlewareOption interface {
+	update(*middlewareConfig)
+}
+
+type inlineMiddlewareOption func(*middlewareConfig)
+
+func (f inlineMiddlewareOption) update(c *middlewareConfig) { f(c) }
+
+// WithPrefix sets the prefix of the registered family names.
+// Default: "http_server".
+func WithPrefix(prefix string) MiddlewareOption {
+	return inlineMiddlewareOption(func(c *middlewareConfig) { c.prefix = prefix })
+}
+
+// WithDurationBuckets sets custom request duration histogram bounds in
+// seconds. Default: .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10.
+func WithDurationBuckets(bounds ...float64) MiddlewareOption {
+	return inlineMiddlewareOption(func(c *middlewareConfig) { c.durationBuckets = bounds })
+}
+
+// WithSizeBuckets sets custom request and response size histogram bounds in
+// bytes. Default: 100, 1k, 10k, 100k, 1M, 10M.
+func WithSizeBuckets(bounds ...float64) MiddlewareOption {
+	return inlineMiddlewareOption(func(c *middlewareConfig) { c.sizeBuckets = bounds })
+}
+
+// WithExemplar attaches exemplars with labels extracted from the request
+// context, e.g. a trace ID, to the request count and duration metrics.
+// Exemplars are skipped when fn returns an empty label set.
+func WithExemplar(fn func(context.Context) openmetrics.LabelSet) MiddlewareOption {
+	return inlineMiddlewareOption(func(c *middlewareConfig) { c.exemplar = fn })
+}
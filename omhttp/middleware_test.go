@@ -0,0 +1,58 @@
+package omhttp_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bsm/openmetrics"
+	"github.com/bsm/openmetrics/omhttp"
+)
+
+func TestMiddleware(t *testing.T) {
+	type traceKey struct{}
+
+	reg := openmetrics.NewConsistentRegistry(mockNow)
+	mw := omhttp.Middleware(reg, omhttp.WithExemplar(func(ctx context.Context) openmetrics.LabelSet {
+		if id, ok := ctx.Value(traceKey{}).(string); ok {
+			return openmetrics.Labels("trace_id", id)
+		}
+		return nil
+	}))
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /items/{id}", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+		w.WriteHeader(http.StatusCreated)
+		_, _ = io.WriteString(w, "created")
+	})
+	handler := mw(mux)
+
+	for _, id := range []string{"1", "2"} {
+		r := httptest.NewRequest("POST", "/items/"+id, strings.NewReader("payload"))
+		r = r.WithContext(context.WithValue(r.Context(), traceKey{}, "abc"+id))
+		handler.ServeHTTP(httptest.NewRecorder(), r)
+	}
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("PROPFIND", "/missing", nil))
+
+	var buf strings.Builder
+	if _, err := reg.WriteTo(&buf); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	for _, exp := range []string{
+		`http_server_requests_total{method="POST",code="2xx",route="POST /items/{id}"} 2 # {trace_id="abc2"} 1`,
+		`http_server_requests_total{method="OTHER",code="4xx"} 1`,
+		`http_server_request_duration_seconds_count{method="POST",code="2xx",route="POST /items/{id}"} 2`,
+		`http_server_request_size_bytes_sum{method="POST",code="2xx",route="POST /items/{id}"} 14`,
+		`http_server_response_size_bytes_sum{method="POST",code="2xx",route="POST /items/{id}"} 14`,
+		`http_server_requests_in_flight{method="POST"} 0`,
+	} {
+		if !strings.Contains(buf.String(), exp+"\n") {
+			t.Fatalf("expected output to contain:\n\t%s\ngot:\n%s", exp, buf.String())
+		}
+	}
+}
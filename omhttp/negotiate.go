@@ -0,0 +1,60 @@
+package omhttp
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// qualityValue is a value of a comma-separated header list with an optional
+// q-value, such as "Accept" and "Accept-Encoding".
+type qualityValue struct {
+	value string
+	q     float64
+}
+
+// parseQualityValues parses a list header. Values without q-values default to
+// a quality of 1.
+func parseQualityValues(header string) []qualityValue {
+	var values []qualityValue
+	for _, part := range strings.Split(header, ",") {
+		value, params, _ := strings.Cut(part, ";")
+		value = strings.ToLower(strings.TrimSpace(value))
+		if value == "" {
+			continue
+		}
+
+		q := 1.0
+		for _, param := range strings.Split(params, ";") {
+			name, v, _ := strings.Cut(param, "=")
+			if strings.TrimSpace(name) == "q" {
+				if f, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil && f >= 0 && f <= 1 {
+					q = f
+				}
+			}
+		}
+		values = append(values, qualityValue{value: value, q: q})
+	}
+	return values
+}
+
+const formatJSON = "json"
+
+// wantsJSON returns true if the request prefers a JSON response, either via a
+// ?format=json query parameter or via the Accept header.
+func wantsJSON(r *http.Request) bool {
+	if r.URL.Query().Get("format") == formatJSON {
+		return true
+	}
+
+	var qJSON, qText float64
+	for _, qv := range parseQualityValues(r.Header.Get("Accept")) {
+		switch qv.value {
+		case "application/json":
+			qJSON = max(qJSON, qv.q)
+		case "application/openmetrics-text", "text/plain", "text/*", "*/*":
+			qText = max(qText, qv.q)
+		}
+	}
+	return qJSON > 0 && qJSON > qText
+}
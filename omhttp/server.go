@@ -0,0 +1,85 @@
+package omhttp
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+)
+
+// ServerOptions configure a dedicated metrics server.
+type ServerOptions struct {
+	// TLSConfig enables TLS. Set ClientAuth and ClientCAs to verify client
+	// certificates, see ClientCertificate.
+	TLSConfig *tls.Config
+	// ReadHeaderTimeout limits the time to read request headers.
+	// Default: 10s.
+	ReadHeaderTimeout time.Duration
+	// ShutdownTimeout limits the time to wait for active requests to
+	// complete on shutdown. Default: 5s.
+	ShutdownTimeout time.Duration
+}
+
+func (o *ServerOptions) norm() *ServerOptions {
+	var oo ServerOptions
+	if o != nil {
+		oo = *o
+	}
+	if oo.ReadHeaderTimeout <= 0 {
+		oo.ReadHeaderTimeout = 10 * time.Second
+	}
+	if oo.ShutdownTimeout <= 0 {
+		oo.ShutdownTimeout = 5 * time.Second
+	}
+	return &oo
+}
+
+// ListenAndServe starts a dedicated HTTP server on addr, serving handler until
+// ctx is cancelled. It then gracefully shuts down the server and returns nil.
+func ListenAndServe(ctx context.Context, addr string, handler http.Handler, opts *ServerOptions) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return Serve(ctx, ln, handler, opts)
+}
+
+// Serve is like ListenAndServe but accepts connections on an existing
+// listener. The listener is closed on return.
+func Serve(ctx context.Context, ln net.Listener, handler http.Handler, opts *ServerOptions) error {
+	opts = opts.norm()
+
+	srv := &http.Server{
+		Handler:           handler,
+		TLSConfig:         opts.TLSConfig,
+		ReadHeaderTimeout: opts.ReadHeaderTimeout,
+		// requests in flight on shutdown must not be aborted
+		BaseContext: func(net.Listener) context.Context { return context.WithoutCancel(ctx) },
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		if srv.TLSConfig != nil {
+			done <- srv.ServeTLS(ln, "", "")
+		} else {
+			done <- srv.Serve(ln)
+		}
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+	}
+
+	sctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), opts.ShutdownTimeout)
+	defer cancel()
+
+	err := srv.Shutdown(sctx)
+	if serr := <-done; !errors.Is(serr, http.ErrServerClosed) {
+		err = errors.Join(err, serr)
+	}
+	return err
+}
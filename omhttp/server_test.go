@@ -0,0 +1,107 @@
+package omhttp_test
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bsm/openmetrics"
+	"github.com/bsm/openmetrics/omhttp"
+)
+
+func TestServe(t *testing.T) {
+	// borrow a TLS config and a trusting client from httptest
+	ts := httptest.NewUnstartedServer(nil)
+	ts.StartTLS()
+	tlsConfig, client := ts.TLS.Clone(), ts.Client()
+	ts.Close()
+
+	reg := openmetrics.NewConsistentRegistry(mockNow)
+	reg.Gauge(openmetrics.Desc{Name: "temp"}).With().Set(21.5)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- omhttp.Serve(ctx, ln, omhttp.NewHandler(reg), &omhttp.ServerOptions{TLSConfig: tlsConfig})
+	}()
+
+	resp, err := client.Get("https://" + ln.Addr().String() + "/metrics")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+
+	if exp, got := http.StatusOK, resp.StatusCode; exp != got {
+		t.Fatalf("expected: %v, got: %v", exp, got)
+	}
+	if exp, got := "# TYPE temp gauge\ntemp 21.5\n# EOF\n", string(body); exp != got {
+		t.Fatalf("expected: %q, got: %q", exp, got)
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if _, err := client.Get("https://" + ln.Addr().String() + "/metrics"); err == nil {
+		t.Fatal("expected error after shutdown")
+	}
+}
+
+func TestServe_shutdown(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	reg := openmetrics.NewConsistentRegistry(mockNow)
+	reg.Gauge(openmetrics.Desc{Name: "temp"}).With().Set(21.5)
+	metrics := omhttp.NewHandler(reg)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		metrics.ServeHTTP(w, r)
+	})
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- omhttp.Serve(ctx, ln, handler, nil)
+	}()
+
+	type result struct {
+		resp *http.Response
+		err  error
+	}
+	res := make(chan result, 1)
+	go func() {
+		resp, err := http.Get("http://" + ln.Addr().String() + "/metrics")
+		res <- result{resp, err}
+	}()
+
+	// slow scrapes complete after the server was stopped
+	<-started
+	cancel()
+	close(release)
+
+	r := <-res
+	if r.err != nil {
+		t.Fatalf("expected no error, got %v", r.err)
+	}
+	_ = r.resp.Body.Close()
+	if exp, got := http.StatusOK, r.resp.StatusCode; exp != got {
+		t.Fatalf("expected: %v, got: %v", exp, got)
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+}
@@ -0,0 +1,220 @@
+package omhttp
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+
+	"github.com/bsm/openmetrics"
+)
+
+// NewTransport wraps an http.RoundTripper with instrumentation. It registers
+// the following families on reg:
+//
+//	http_client_requests_total{host,method,code}
+//	http_client_request_duration_seconds{host,method,code}
+//	http_client_requests_in_flight{host,method}
+//	http_client_request_phase_duration_seconds{host,method,phase}
+//
+// The code label contains the status class, e.g. "2xx", or "error" if the
+// round trip failed. Phases are traced via net/http/httptrace and include
+// "dns", "connect", "tls" and "ttfb" (time to first response byte). Labels
+// other than code and phase can be customized with TransportLabels.
+//
+// If next is nil, http.DefaultTransport is used. It panics if any of the
+// families conflicts with an existing registration.
+func NewTransport(reg *openmetrics.Registry, next http.RoundTripper, opts ...TransportOption) http.RoundTripper {
+	c := transportConfig{
+		prefix:          "http_client",
+		durationBuckets: defaultDurationBuckets,
+		labelNames:      []string{"host", "method"},
+		labelValues: func(r *http.Request) []string {
+			return []string{r.URL.Host, normalizeMethod(r.Method)}
+		},
+	}
+	for _, o := range opts {
+		o.update(&c)
+	}
+
+	if reg == nil {
+		reg = openmetrics.DefaultRegistry()
+	}
+	if next == nil {
+		next = http.DefaultTransport
+	}
+
+	labels := append(c.labelNames[:len(c.labelNames):len(c.labelNames)], "code")
+	phaseLabels := append(c.labelNames[:len(c.labelNames):len(c.labelNames)], "phase")
+	return &transport{
+		next:        next,
+		labelValues: c.labelValues,
+		requests: reg.Counter(openmetrics.Desc{
+			Name:   c.prefix + "_requests",
+			Help:   "Total number of outgoing HTTP requests.",
+			Labels: labels,
+		}),
+		duration: reg.Histogram(openmetrics.Desc{
+			Name:   c.prefix + "_request_duration",
+			Unit:   "seconds",
+			Help:   "Duration of outgoing HTTP requests.",
+			Labels: labels,
+		}, c.durationBuckets),
+		inFlight: reg.Gauge(openmetrics.Desc{
+			Name:   c.prefix + "_requests_in_flight",
+			Help:   "Number of outgoing HTTP requests currently in flight.",
+			Labels: c.labelNames,
+		}),
+		phases: reg.Histogram(openmetrics.Desc{
+			Name:   c.prefix + "_request_phase_duration",
+			Unit:   "seconds",
+			Help:   "Duration of outgoing HTTP request phases.",
+			Labels: phaseLabels,
+		}, c.durationBuckets),
+	}
+}
+
+type transport struct {
+	next        http.RoundTripper
+	labelValues func(*http.Request) []string
+	requests    openmetrics.CounterFamily
+	duration    openmetrics.HistogramFamily
+	inFlight    openmetrics.GaugeFamily
+	phases      openmetrics.HistogramFamily
+}
+
+func (t *transport) RoundTrip(r *http.Request) (*http.Response, error) {
+	lvs := t.labelValues(r)
+
+	inFlight := t.inFlight.With(lvs...)
+	inFlight.Add(1)
+	defer inFlight.Add(-1)
+
+	start := time.Now()
+	tr := &roundTripTrace{start: start, lvs: lvs, phases: t.phases}
+	r = r.WithContext(httptrace.WithClientTrace(r.Context(), tr.ClientTrace()))
+
+	resp, err := t.next.RoundTrip(r)
+	elapsed := time.Since(start)
+
+	code := "error"
+	if err == nil {
+		code = statusClass(resp.StatusCode)
+	}
+	lvs = append(lvs[:len(lvs):len(lvs)], code)
+	t.requests.With(lvs...).Add(1)
+	t.duration.With(lvs...).Observe(elapsed.Seconds())
+
+	return resp, err
+}
+
+// roundTripTrace records phase durations of a single round trip.
+type roundTripTrace struct {
+	start  time.Time
+	lvs    []string
+	phases openmetrics.HistogramFamily
+
+	mu           sync.Mutex
+	dnsStart     time.Time
+	connectStart time.Time
+	tlsStart     time.Time
+	connected    bool
+}
+
+func (t *roundTripTrace) ClientTrace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) {
+			t.mu.Lock()
+			t.dnsStart = time.Now()
+			t.mu.Unlock()
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			t.mu.Lock()
+			t.observe("dns", t.dnsStart)
+			t.mu.Unlock()
+		},
+		ConnectStart: func(_, _ string) {
+			t.mu.Lock()
+			if t.connectStart.IsZero() {
+				t.connectStart = time.Now()
+			}
+			t.mu.Unlock()
+		},
+		ConnectDone: func(_, _ string, err error) {
+			t.mu.Lock()
+			// with dual-stack dialing, only the first successful
+			// connection counts
+			if err == nil && !t.connected {
+				t.connected = true
+				t.observe("connect", t.connectStart)
+			}
+			t.mu.Unlock()
+		},
+		TLSHandshakeStart: func() {
+			t.mu.Lock()
+			t.tlsStart = time.Now()
+			t.mu.Unlock()
+		},
+		TLSHandshakeDone: func(_ tls.ConnectionState, err error) {
+			t.mu.Lock()
+			if err == nil {
+				t.observe("tls", t.tlsStart)
+			}
+			t.mu.Unlock()
+		},
+		GotFirstResponseByte: func() {
+			t.mu.Lock()
+			t.observe("ttfb", t.start)
+			t.mu.Unlock()
+		},
+	}
+}
+
+func (t *roundTripTrace) observe(phase string, start time.Time) {
+	if start.IsZero() {
+		return
+	}
+	lvs := append(t.lvs[:len(t.lvs):len(t.lvs)], phase)
+	t.phases.With(lvs...).Observe(time.Since(start).Seconds())
+}
+
+// ----------------------------------------------------------------------------
+
+type transportConfig struct {
+	prefix          string
+	durationBuckets []float64
+	labelNames      []string
+	labelValues     func(*http.Request) []string
+}
+
+// A TransportOption configures the instrumented transport.
+type TransportOption interface {
+	update(*transportConfig)
+}
+
+type inlineTransportOption func(*transportConfig)
+
+func (f inlineTransportOption) update(c *transportConfig) { f(c) }
+
+// TransportPrefix sets the prefix of the registered family names.
+// Default: "http_client".
+func TransportPrefix(prefix string) TransportOption {
+	return inlineTransportOption(func(c *transportConfig) { c.prefix = prefix })
+}
+
+// TransportDurationBuckets sets custom request and phase duration histogram
+// bounds in seconds. Default: .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10.
+func TransportDurationBuckets(bounds ...float64) TransportOption {
+	return inlineTransportOption(func(c *transportConfig) { c.durationBuckets = bounds })
+}
+
+// TransportLabels sets custom label names and a function which extracts
+// the respective values from each request, allowing callers to control
+// cardinality. Default: host and method.
+func TransportLabels(names []string, fn func(*http.Request) []string) TransportOption {
+	return inlineTransportOption(func(c *transportConfig) {
+		c.labelNames = names
+		c.labelValues = fn
+	})
+}
@@ -0,0 +1,63 @@
+package omhttp_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bsm/openmetrics"
+	"github.com/bsm/openmetrics/omhttp"
+)
+
+func TestNewTransport(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = io.WriteString(w, "ok")
+	}))
+	defer srv.Close()
+
+	reg := openmetrics.NewConsistentRegistry(mockNow)
+	client := &http.Client{
+		Transport: omhttp.NewTransport(reg, srv.Client().Transport, omhttp.TransportLabels(
+			[]string{"method"},
+			func(r *http.Request) []string { return []string{r.Method} },
+		)),
+	}
+
+	for _, path := range []string{"/", "/", "/missing"} {
+		resp, err := client.Get(srv.URL + path)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		_, _ = io.Copy(io.Discard, resp.Body)
+		_ = resp.Body.Close()
+	}
+	if _, err := client.Get("http://127.0.0.1:1/"); err == nil {
+		t.Fatal("expected error")
+	}
+
+	var buf strings.Builder
+	if _, err := reg.WriteTo(&buf); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	for _, exp := range []string{
+		`http_client_requests_total{method="GET",code="2xx"} 2`,
+		`http_client_requests_total{method="GET",code="4xx"} 1`,
+		`http_client_requests_total{method="GET",code="error"} 1`,
+		`http_client_request_duration_seconds_count{method="GET",code="2xx"} 2`,
+		`http_client_requests_in_flight{method="GET"} 0`,
+		`http_client_request_phase_duration_seconds_count{method="GET",phase="connect"} 1`,
+		`http_client_request_phase_duration_seconds_count{method="GET",phase="tls"} 1`,
+		`http_client_request_phase_duration_seconds_count{method="GET",phase="ttfb"} 3`,
+	} {
+		if !strings.Contains(buf.String(), exp+"\n") {
+			t.Fatalf("expected output to contain:\n\t%s\ngot:\n%s", exp, buf.String())
+		}
+	}
+}
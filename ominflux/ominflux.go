@@ -0,0 +1,225 @@
+// Package ominflux renders metrics in the InfluxDB line protocol.
+package ominflux
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bsm/openmetrics"
+	"github.com/bsm/openmetrics/internal/netpush"
+)
+
+// Writer renders snapshots of a Registry in the InfluxDB line protocol. Each
+// metric family is written as a measurement, labels as tags and points as
+// fields, named after their suffix. Points with additional labels, such as
+// histogram buckets, are written as separate lines.
+type Writer struct {
+	reg  *openmetrics.Registry
+	conf config
+}
+
+// NewWriter inits a new writer.
+func NewWriter(reg *openmetrics.Registry, opts ...Option) *Writer {
+	conf := config{
+		now:      time.Now,
+		interval: time.Minute,
+		onError:  openmetrics.WarnOnError,
+	}
+	for _, o := range opts {
+		o.update(&conf)
+	}
+
+	if reg == nil {
+		reg = openmetrics.DefaultRegistry()
+	}
+	return &Writer{reg: reg, conf: conf}
+}
+
+// WriteTo implements io.WriterTo interface.
+func (w *Writer) WriteTo(dst io.Writer) (int64, error) {
+	fams, err := w.reg.Snapshot()
+	if err != nil {
+		return 0, err
+	}
+
+	ts := strconv.FormatInt(w.conf.now().UnixNano(), 10)
+	bw := bufio.NewWriter(dst)
+
+	var (
+		total  int64
+		b      []byte
+		tags   openmetrics.LabelSet
+		groups []pointGroup
+	)
+	for _, fam := range fams {
+		measurement := w.conf.prefix + fam.Desc.FullName()
+
+		for _, s := range fam.Series {
+			groups = groupPoints(groups[:0], s.Points)
+			for _, g := range groups {
+				tags = s.Labels.AppendTo(tags[:0])
+				if !g.label.IsZero() {
+					tags = append(tags, g.label)
+				}
+				sort.Slice(tags, func(i, j int) bool { return tags[i].Name < tags[j].Name })
+
+				b = appendLine(b[:0], measurement, tags, g.points, ts)
+				if b == nil {
+					continue
+				}
+
+				n, err := bw.Write(b)
+				total += int64(n)
+				if err != nil {
+					return total, err
+				}
+			}
+		}
+	}
+	return total, bw.Flush()
+}
+
+// Run connects to an InfluxDB line protocol listener and pushes metrics at the
+// configured interval. It blocks until the context is cancelled. A new
+// connection is established for each push.
+func (w *Writer) Run(ctx context.Context, network, address string) error {
+	netpush.Run(ctx, w.conf.interval, network, address, w, w.conf.onError)
+	return nil
+}
+
+// Push connects to an InfluxDB line protocol listener and pushes metrics once.
+func (w *Writer) Push(ctx context.Context, network, address string) error {
+	return netpush.Push(ctx, network, address, w)
+}
+
+// ----------------------------------------------------------------------------
+
+type pointGroup struct {
+	label  openmetrics.Label
+	points []openmetrics.MetricPoint
+}
+
+// groupPoints groups points by their additional label.
+func groupPoints(groups []pointGroup, points []openmetrics.MetricPoint) []pointGroup {
+Outer:
+	for _, pt := range points {
+		for i := range groups {
+			if groups[i].label == pt.Label {
+				groups[i].points = append(groups[i].points, pt)
+				continue Outer
+			}
+		}
+		groups = append(groups, pointGroup{label: pt.Label, points: []openmetrics.MetricPoint{pt}})
+	}
+	return groups
+}
+
+// appendLine appends a line, it returns nil if no valid fields were found.
+func appendLine(b []byte, measurement string, tags openmetrics.LabelSet, points []openmetrics.MetricPoint, ts string) []byte {
+	b = appendEscaped(b, measurement, ", ")
+	for _, t := range tags {
+		b = append(b, ',')
+		b = appendEscaped(b, t.Name, ",= ")
+		b = append(b, '=')
+		b = appendEscaped(b, t.Value, ",= ")
+	}
+
+	first := true
+	for _, pt := range points {
+		if math.IsNaN(pt.Value) || math.IsInf(pt.Value, 0) {
+			continue
+		}
+
+		if first {
+			b = append(b, ' ')
+			first = false
+		} else {
+			b = append(b, ',')
+		}
+
+		if sfx := pt.Suffix.String(); sfx != "" {
+			b = append(b, sfx[1:]...)
+		} else {
+			b = append(b, "value"...)
+		}
+		b = append(b, '=')
+		b = strconv.AppendFloat(b, pt.Value, 'f', -1, 64)
+	}
+	if first {
+		return nil
+	}
+
+	b = append(b, ' ')
+	b = append(b, ts...)
+	b = append(b, '\n')
+	return b
+}
+
+func appendEscaped(b []byte, s, special string) []byte {
+	if !strings.ContainsAny(s, special+"\\\n") {
+		return append(b, s...)
+	}
+
+	for _, r := range s {
+		switch {
+		case r == '\n':
+			b = append(b, `\n`...)
+		case r == '\\' || strings.ContainsRune(special, r):
+			b = append(b, '\\', byte(r))
+		default:
+			b = append(b, string(r)...)
+		}
+	}
+	return b
+}
+
+// ----------------------------------------------------------------------------
+
+type config struct {
+	prefix   string
+	now      func() time.Time
+	interval time.Duration
+	onError  openmetrics.ErrorHandler
+}
+
+// An Option configures the Writer.
+type Option interface {
+	update(*config)
+}
+
+type inlineOption func(*config)
+
+func (f inlineOption) update(c *config) { f(c) }
+
+// Prefix adds a prefix to all measurement names.
+func Prefix(prefix string) Option {
+	return inlineOption(func(c *config) { c.prefix = prefix })
+}
+
+// TimeFunc sets a custom time function for point timestamps.
+// Default: time.Now.
+func TimeFunc(fn func() time.Time) Option {
+	return inlineOption(func(c *config) { c.now = fn })
+}
+
+// Interval sets the push interval used by Run. Default: 1m.
+// Non-positive values are ignored.
+func Interval(d time.Duration) Option {
+	return inlineOption(func(c *config) {
+		if d > 0 {
+			c.interval = d
+		}
+	})
+}
+
+// OnError sets a custom error handler for errors during periodic pushes.
+// Default: openmetrics.WarnOnError.
+func OnError(fn openmetrics.ErrorHandler) Option {
+	return inlineOption(func(c *config) { c.onError = fn })
+}
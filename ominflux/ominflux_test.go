@@ -0,0 +1,87 @@
+package ominflux_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bsm/openmetrics"
+	"github.com/bsm/openmetrics/ominflux"
+)
+
+func TestWriter_WriteTo(t *testing.T) {
+	reg := openmetrics.NewConsistentRegistry(mockNow)
+	reg.Counter(openmetrics.Desc{Name: "http_requests", Labels: []string{"path", "status"}}).With("/a b,c", "200").Add(3)
+	reg.Gauge(openmetrics.Desc{Name: "temp", Unit: "celsius"}).With().Set(21.5)
+	reg.Histogram(openmetrics.Desc{Name: "latency", Unit: "seconds"}, []float64{.1}).With().Observe(0.05)
+	reg.StateSet(openmetrics.Desc{Name: "mode"}, []string{"on"}).With().Set("on", true)
+
+	w := ominflux.NewWriter(reg, ominflux.TimeFunc(mockNow))
+
+	var buf bytes.Buffer
+	if n, err := w.WriteTo(&buf); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	} else if exp, got := int64(buf.Len()), n; exp != got {
+		t.Fatalf("expected %v, got %v", exp, got)
+	}
+
+	if exp, got := strings.Join([]string{
+		`http_requests,path=/a\ b\,c,status=200 total=3,created=1515151515.7575758 1515151515757575757`,
+		`temp_celsius value=21.5 1515151515757575757`,
+		`latency_seconds,le=0.1 bucket=1 1515151515757575757`,
+		`latency_seconds,le=+Inf bucket=1 1515151515757575757`,
+		`latency_seconds count=1,sum=0.05,created=1515151515.7575758 1515151515757575757`,
+		`mode,mode=on value=1 1515151515757575757`,
+	}, "\n")+"\n", buf.String(); exp != got {
+		t.Fatalf("expected:\n%s\ngot:\n%s", exp, got)
+	}
+}
+
+func TestWriter_Run(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer lis.Close()
+
+	received := make(chan string, 10)
+	go func() {
+		for {
+			conn, err := lis.Accept()
+			if err != nil {
+				return
+			}
+			data, _ := io.ReadAll(conn)
+			_ = conn.Close()
+			received <- string(data)
+		}
+	}()
+
+	reg := openmetrics.NewConsistentRegistry(mockNow)
+	reg.Gauge(openmetrics.Desc{Name: "temp"}).With().Set(1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	w := ominflux.NewWriter(reg, ominflux.Interval(time.Millisecond), ominflux.TimeFunc(mockNow), ominflux.Prefix("app_"))
+	go func() { _ = w.Run(ctx, "tcp", lis.Addr().String()) }()
+
+	select {
+	case got := <-received:
+		if exp := "app_temp value=1 1515151515757575757\n"; exp != got {
+			t.Fatalf("expected %q, got %q", exp, got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout")
+	}
+}
+
+// ----------------------------------------------------------------------------
+
+var mockTime = time.Unix(1515151515, 757575757)
+
+func mockNow() time.Time { return mockTime }
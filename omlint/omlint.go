@@ -0,0 +1,252 @@
+// Package omlint checks metric families for violations of naming conventions
+// and best practices.
+package omlint
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/bsm/openmetrics"
+)
+
+// Rule identifies a lint rule.
+type Rule string
+
+// Lint rules.
+const (
+	// RuleBaseUnit reports units which are not base units, e.g.
+	// "milliseconds" instead of "seconds".
+	RuleBaseUnit Rule = "base-unit"
+	// RuleMissingHelp reports families without HELP text.
+	RuleMissingHelp Rule = "missing-help"
+	// RuleCounterName reports counters with names that are not meaningful,
+	// such as names ending in "_count" or "_counter".
+	RuleCounterName Rule = "counter-name"
+	// RuleLabelName reports label names which duplicate the metric name.
+	RuleLabelName Rule = "label-name"
+	// RuleCardinality reports labels and families which hint at high
+	// cardinality.
+	RuleCardinality Rule = "cardinality"
+	// RuleUnitSuffix reports names with unit suffixes which are inconsistent
+	// with the declared unit.
+	RuleUnitSuffix Rule = "unit-suffix"
+)
+
+// Diagnostic describes a single issue.
+type Diagnostic struct {
+	// Family is the full name of the family.
+	Family string
+	// Rule is the violated rule.
+	Rule Rule
+	// Message describes the issue.
+	Message string
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%s: %s (%s)", d.Family, d.Message, d.Rule)
+}
+
+// Options configure the linter.
+type Options struct {
+	// MaxSeries is the maximum number of series per family.
+	// Default: 1000.
+	MaxSeries int
+	// MaxLabelValues is the maximum number of distinct values per label.
+	// Default: 100.
+	MaxLabelValues int
+	// Disable disables rules.
+	Disable []Rule
+}
+
+func (o *Options) norm() *Options {
+	var oo Options
+	if o != nil {
+		oo = *o
+	}
+	if oo.MaxSeries <= 0 {
+		oo.MaxSeries = 1000
+	}
+	if oo.MaxLabelValues <= 0 {
+		oo.MaxLabelValues = 100
+	}
+	return &oo
+}
+
+// LintRegistry lints all families registered on a registry.
+func LintRegistry(reg *openmetrics.Registry, opts *Options) ([]Diagnostic, error) {
+	fams, err := reg.Snapshot()
+	if err != nil {
+		return nil, err
+	}
+	return Lint(fams, opts), nil
+}
+
+// LintDocument parses and lints an OpenMetrics text document. Documents which
+// cannot be parsed return an *openmetrics.ParseError.
+func LintDocument(r io.Reader, opts *Options) ([]Diagnostic, error) {
+	fams, err := openmetrics.Parse(r)
+	if err != nil {
+		return nil, err
+	}
+	return Lint(fams, opts), nil
+}
+
+// Lint lints metric families.
+func Lint(fams []openmetrics.FamilySnapshot, opts *Options) []Diagnostic {
+	l := &linter{opts: opts.norm()}
+	for i := range fams {
+		l.lint(&fams[i])
+	}
+	return l.diags
+}
+
+// ----------------------------------------------------------------------------
+
+type linter struct {
+	opts  *Options
+	fam   string
+	diags []Diagnostic
+}
+
+func (l *linter) report(rule Rule, format string, args ...any) {
+	if slices.Contains(l.opts.Disable, rule) {
+		return
+	}
+	l.diags = append(l.diags, Diagnostic{Family: l.fam, Rule: rule, Message: fmt.Sprintf(format, args...)})
+}
+
+func (l *linter) lint(fam *openmetrics.FamilySnapshot) {
+	desc := &fam.Desc
+	l.fam = desc.FullName()
+
+	// units
+	if base, ok := nonBaseUnits[desc.Unit]; ok {
+		l.report(RuleBaseUnit, "unit %q should be %q", desc.Unit, base)
+	}
+	if unit := unitSuffix(desc.Name); unit != "" {
+		if desc.Unit == "" {
+			l.report(RuleUnitSuffix, "name ends with unit %q, but declares no unit", unit)
+		} else if unit != desc.Unit {
+			l.report(RuleUnitSuffix, "name ends with unit %q, but declares unit %q", unit, desc.Unit)
+		}
+	}
+
+	// help
+	if strings.TrimSpace(desc.Help) == "" {
+		l.report(RuleMissingHelp, "missing help text")
+	}
+
+	// counter names
+	if fam.Type == openmetrics.CounterType {
+		last := desc.Name[strings.LastIndexByte(desc.Name, '_')+1:]
+		switch {
+		case strings.HasSuffix(desc.Name, "_count"), strings.HasSuffix(desc.Name, "_counter"), strings.HasSuffix(desc.Name, "_total"):
+			l.report(RuleCounterName, "counter name should not end with %q", "_"+last)
+		case slices.Contains(genericNames, desc.Name):
+			l.report(RuleCounterName, "counter name %q is not meaningful", desc.Name)
+		}
+	}
+
+	// label names
+	names := labelNames(fam)
+	for _, name := range names {
+		if name == desc.Name || name == l.fam || strings.HasSuffix(desc.Name, "_"+name) {
+			l.report(RuleLabelName, "label %q duplicates the metric name", name)
+		}
+		if slices.Contains(highCardinalityLabels, name) {
+			l.report(RuleCardinality, "label %q hints at high cardinality", name)
+		}
+	}
+
+	// observed cardinality
+	if n := len(fam.Series); n > l.opts.MaxSeries {
+		l.report(RuleCardinality, "family has %d series, exceeding %d", n, l.opts.MaxSeries)
+	}
+	for _, name := range names {
+		if n := countLabelValues(fam, name); n > l.opts.MaxLabelValues {
+			l.report(RuleCardinality, "label %q has %d distinct values, exceeding %d", name, n, l.opts.MaxLabelValues)
+		}
+	}
+}
+
+// labelNames returns declared and observed label names.
+func labelNames(fam *openmetrics.FamilySnapshot) []string {
+	names := slices.Clone(fam.Desc.Labels)
+	for _, s := range fam.Series {
+		for _, l := range s.Labels {
+			if !slices.Contains(names, l.Name) {
+				names = append(names, l.Name)
+			}
+		}
+	}
+	return names
+}
+
+func countLabelValues(fam *openmetrics.FamilySnapshot, name string) int {
+	values := make(map[string]struct{})
+	for _, s := range fam.Series {
+		for _, l := range s.Labels {
+			if l.Name == name {
+				values[l.Value] = struct{}{}
+			}
+		}
+	}
+	return len(values)
+}
+
+// unitSuffix returns the unit if name ends with a known unit.
+func unitSuffix(name string) string {
+	for _, unit := range knownUnits {
+		if strings.HasSuffix(name, "_"+unit) {
+			return unit
+		}
+	}
+	return ""
+}
+
+var nonBaseUnits = map[string]string{
+	"nanoseconds":  "seconds",
+	"microseconds": "seconds",
+	"milliseconds": "seconds",
+	"minutes":      "seconds",
+	"hours":        "seconds",
+	"days":         "seconds",
+	"bits":         "bytes",
+	"kilobytes":    "bytes",
+	"megabytes":    "bytes",
+	"gigabytes":    "bytes",
+	"terabytes":    "bytes",
+	"kibibytes":    "bytes",
+	"mebibytes":    "bytes",
+	"gibibytes":    "bytes",
+	"tebibytes":    "bytes",
+	"percent":      "ratio",
+	"fahrenheit":   "celsius",
+	"millimeters":  "meters",
+	"centimeters":  "meters",
+	"kilometers":   "meters",
+	"milligrams":   "grams",
+	"kilograms":    "grams",
+	"millivolts":   "volts",
+	"milliamperes": "amperes",
+	"kilowatts":    "watts",
+}
+
+var knownUnits = func() []string {
+	units := []string{"seconds", "bytes", "ratio", "celsius", "meters", "grams", "volts", "amperes", "watts", "joules", "hertz", "kelvin"}
+	for unit := range nonBaseUnits {
+		units = append(units, unit)
+	}
+	// check longer units first, e.g. "milliseconds" before "seconds"
+	slices.SortFunc(units, func(a, b string) int { return len(b) - len(a) })
+	return units
+}()
+
+var genericNames = []string{"count", "counter", "events", "metric", "total", "value"}
+
+var highCardinalityLabels = []string{
+	"email", "id", "ip", "path", "query", "request_id", "session_id",
+	"span_id", "timestamp", "trace_id", "uid", "uri", "url", "user", "user_id", "uuid",
+}
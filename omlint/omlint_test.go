@@ -0,0 +1,99 @@
+package omlint_test
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/bsm/openmetrics"
+	"github.com/bsm/openmetrics/omlint"
+)
+
+func TestLintRegistry(t *testing.T) {
+	reg := openmetrics.NewRegistry()
+	reg.Counter(openmetrics.Desc{Name: "http_requests", Help: "Requests.", Labels: []string{"method"}}).With("GET").Add(1)
+	reg.Histogram(openmetrics.Desc{Name: "latency", Unit: "milliseconds", Help: "Latency."}, []float64{1, 10}).With().Observe(2)
+	reg.Counter(openmetrics.Desc{Name: "jobs_counter", Help: "Jobs."}).With().Add(1)
+	reg.Gauge(openmetrics.Desc{Name: "queue_size"}).With().Set(1)
+
+	diags, err := omlint.LintRegistry(reg, nil)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if exp, got := strings.Join([]string{
+		`latency_milliseconds: unit "milliseconds" should be "seconds" (base-unit)`,
+		`jobs_counter: counter name should not end with "_counter" (counter-name)`,
+		`queue_size: missing help text (missing-help)`,
+	}, "\n"), join(diags); exp != got {
+		t.Fatalf("expected:\n%v\ngot:\n%v", exp, got)
+	}
+}
+
+func TestLintDocument(t *testing.T) {
+	diags, err := omlint.LintDocument(strings.NewReader(`# TYPE latency_seconds gauge
+# HELP latency_seconds Latency.
+latency_seconds 0.1
+# TYPE size_bytes_seconds gauge
+# UNIT size_bytes_seconds seconds
+# HELP size_bytes_seconds Size.
+size_bytes_seconds 1
+# TYPE http_requests_method counter
+# HELP http_requests_method Requests.
+http_requests_method_total{method="GET",user_id="1"} 1
+# TYPE events counter
+# HELP events Events.
+events_total 1
+# EOF
+`), nil)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if exp, got := strings.Join([]string{
+		`latency_seconds: name ends with unit "seconds", but declares no unit (unit-suffix)`,
+		`size_bytes_seconds: name ends with unit "bytes", but declares unit "seconds" (unit-suffix)`,
+		`http_requests_method: label "method" duplicates the metric name (label-name)`,
+		`http_requests_method: label "user_id" hints at high cardinality (cardinality)`,
+		`events: counter name "events" is not meaningful (counter-name)`,
+	}, "\n"), join(diags); exp != got {
+		t.Fatalf("expected:\n%v\ngot:\n%v", exp, got)
+	}
+
+	_, err = omlint.LintDocument(strings.NewReader("foo 1\n"), nil)
+	var perr *openmetrics.ParseError
+	if !errors.As(err, &perr) {
+		t.Fatalf("expected parse error, got %v", err)
+	}
+}
+
+func TestLint_options(t *testing.T) {
+	reg := openmetrics.NewRegistry()
+	gauge := reg.Gauge(openmetrics.Desc{Name: "temp", Unit: "celsius", Labels: []string{"room"}})
+	for i := 0; i < 5; i++ {
+		gauge.With(strconv.Itoa(i)).Set(20)
+	}
+	fams, err := reg.Snapshot()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	diags := omlint.Lint(fams, &omlint.Options{
+		MaxSeries:      4,
+		MaxLabelValues: 3,
+		Disable:        []omlint.Rule{omlint.RuleMissingHelp},
+	})
+	if exp, got := strings.Join([]string{
+		`temp_celsius: family has 5 series, exceeding 4 (cardinality)`,
+		`temp_celsius: label "room" has 5 distinct values, exceeding 3 (cardinality)`,
+	}, "\n"), join(diags); exp != got {
+		t.Fatalf("expected:\n%v\ngot:\n%v", exp, got)
+	}
+}
+
+func join(diags []omlint.Diagnostic) string {
+	lines := make([]string, 0, len(diags))
+	for _, d := range diags {
+		lines = append(lines, d.String())
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,282 @@
+package omotlp
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/bsm/openmetrics"
+	"github.com/bsm/openmetrics/internal/protowire"
+)
+
+const scopeName = "github.com/bsm/openmetrics/omotlp"
+
+// aggregationTemporalityCumulative as defined by
+// opentelemetry.proto.metrics.v1.AggregationTemporality.
+const aggregationTemporalityCumulative = 2
+
+// encodeRequest encodes an ExportMetricsServiceRequest with a single resource
+// and instrumentation scope.
+func encodeRequest(b []byte, fams []openmetrics.FamilySnapshot, conf *config, now time.Time) []byte {
+	ts := uint64(now.UnixNano())
+
+	return protowire.AppendMessage(b, 1, func(b []byte) []byte { // ResourceMetrics
+		b = protowire.AppendMessage(b, 1, func(b []byte) []byte { // Resource
+			return encodeAttributes(b, 1, resourceAttributes(fams, conf))
+		})
+		b = protowire.AppendMessage(b, 2, func(b []byte) []byte { // ScopeMetrics
+			b = protowire.AppendMessage(b, 1, func(b []byte) []byte { // InstrumentationScope
+				return protowire.AppendString(b, 1, scopeName)
+			})
+			for i := range fams {
+				fam := &fams[i]
+				if fam.Type == openmetrics.InfoType && fam.Desc.Name == conf.resourceInfo {
+					continue
+				}
+				b = protowire.AppendMessage(b, 2, func(b []byte) []byte {
+					return encodeMetric(b, fam, ts)
+				})
+			}
+			return b
+		})
+		return b
+	})
+}
+
+// resourceAttributes combines constant attributes with the labels of the
+// resource info family.
+func resourceAttributes(fams []openmetrics.FamilySnapshot, conf *config) openmetrics.LabelSet {
+	attrs := append(openmetrics.LabelSet(nil), conf.resource...)
+	if conf.resourceInfo == "" {
+		return attrs
+	}
+
+	for _, fam := range fams {
+		if fam.Type != openmetrics.InfoType || fam.Desc.Name != conf.resourceInfo {
+			continue
+		}
+		for _, s := range fam.Series {
+			attrs = s.Labels.AppendTo(attrs)
+		}
+	}
+	return attrs
+}
+
+// encodeMetric encodes a Metric message.
+func encodeMetric(b []byte, fam *openmetrics.FamilySnapshot, ts uint64) []byte {
+	b = protowire.AppendString(b, 1, fam.Desc.FullName())
+	b = protowire.AppendString(b, 2, fam.Desc.Help)
+	b = protowire.AppendString(b, 3, fam.Desc.Unit)
+
+	switch fam.Type {
+	case openmetrics.CounterType:
+		b = protowire.AppendMessage(b, 7, func(b []byte) []byte { // Sum
+			for _, s := range fam.Series {
+				b = protowire.AppendMessage(b, 1, func(b []byte) []byte {
+					return encodeNumberDataPoint(b, s.Labels, s.Points, ts)
+				})
+			}
+			b = protowire.AppendVarint(b, 2, aggregationTemporalityCumulative)
+			b = protowire.AppendVarint(b, 3, 1)
+			return b
+		})
+	case openmetrics.HistogramType:
+		b = protowire.AppendMessage(b, 9, func(b []byte) []byte { // Histogram
+			for _, s := range fam.Series {
+				b = protowire.AppendMessage(b, 1, func(b []byte) []byte {
+					return encodeHistogramDataPoint(b, s.Labels, s.Points, ts)
+				})
+			}
+			b = protowire.AppendVarint(b, 2, aggregationTemporalityCumulative)
+			return b
+		})
+	case openmetrics.SummaryType:
+		b = protowire.AppendMessage(b, 11, func(b []byte) []byte { // Summary
+			for _, s := range fam.Series {
+				b = protowire.AppendMessage(b, 1, func(b []byte) []byte {
+					return encodeSummaryDataPoint(b, s.Labels, s.Points, ts)
+				})
+			}
+			return b
+		})
+	default:
+		// gauges, unknowns, statesets and infos are exported as gauges with
+		// one data point per metric point.
+		b = protowire.AppendMessage(b, 5, func(b []byte) []byte { // Gauge
+			var attrs openmetrics.LabelSet
+			for _, s := range fam.Series {
+				for i, pt := range s.Points {
+					attrs = s.Labels.AppendTo(attrs[:0])
+					if !pt.Label.IsZero() {
+						attrs = append(attrs, pt.Label)
+					}
+					b = protowire.AppendMessage(b, 1, func(b []byte) []byte {
+						return encodeNumberDataPoint(b, attrs, s.Points[i:i+1], ts)
+					})
+				}
+			}
+			return b
+		})
+	}
+	return b
+}
+
+// encodeNumberDataPoint encodes a NumberDataPoint message.
+func encodeNumberDataPoint(b []byte, attrs openmetrics.LabelSet, pts []openmetrics.MetricPoint, ts uint64) []byte {
+	var (
+		value    float64
+		exemplar *openmetrics.Exemplar
+	)
+	for _, pt := range pts {
+		switch pt.Suffix {
+		case openmetrics.SuffixCreated:
+			b = protowire.AppendFixed64(b, 2, epochNanos(pt.Value))
+		default:
+			value, exemplar = pt.Value, pt.Exemplar
+		}
+	}
+
+	b = protowire.AppendFixed64(b, 3, ts)
+	b = protowire.AppendFixed64(b, 4, math.Float64bits(value))
+	if exemplar != nil {
+		b = protowire.AppendMessage(b, 5, func(b []byte) []byte {
+			return encodeExemplar(b, exemplar, ts)
+		})
+	}
+	b = encodeAttributes(b, 7, attrs)
+	return b
+}
+
+// encodeHistogramDataPoint encodes a HistogramDataPoint message, converting
+// cumulative bucket counts into per-bucket counts.
+func encodeHistogramDataPoint(b []byte, attrs openmetrics.LabelSet, pts []openmetrics.MetricPoint, ts uint64) []byte {
+	var (
+		count, sum float64
+		counts     []uint64
+		bounds     []float64
+		exemplars  []*openmetrics.Exemplar
+		cumulative float64
+	)
+	for _, pt := range pts {
+		switch pt.Suffix {
+		case openmetrics.SuffixBucket:
+			counts = append(counts, uint64(pt.Value-cumulative))
+			cumulative = pt.Value
+			if bound, err := strconv.ParseFloat(pt.Label.Value, 64); err == nil && !math.IsInf(bound, 1) {
+				bounds = append(bounds, bound)
+			}
+			if pt.Exemplar != nil {
+				exemplars = append(exemplars, pt.Exemplar)
+			}
+		case openmetrics.SuffixCount:
+			count = pt.Value
+		case openmetrics.SuffixSum:
+			sum = pt.Value
+		case openmetrics.SuffixCreated:
+			b = protowire.AppendFixed64(b, 2, epochNanos(pt.Value))
+		}
+	}
+
+	b = protowire.AppendFixed64(b, 3, ts)
+	b = protowire.AppendFixed64(b, 4, uint64(count))
+	b = protowire.AppendFixed64(b, 5, math.Float64bits(sum))
+	b = protowire.AppendMessage(b, 6, func(b []byte) []byte {
+		for _, n := range counts {
+			b = binary.LittleEndian.AppendUint64(b, n)
+		}
+		return b
+	})
+	b = protowire.AppendMessage(b, 7, func(b []byte) []byte {
+		for _, v := range bounds {
+			b = binary.LittleEndian.AppendUint64(b, math.Float64bits(v))
+		}
+		return b
+	})
+	for _, x := range exemplars {
+		b = protowire.AppendMessage(b, 8, func(b []byte) []byte {
+			return encodeExemplar(b, x, ts)
+		})
+	}
+	b = encodeAttributes(b, 9, attrs)
+	return b
+}
+
+// encodeSummaryDataPoint encodes a SummaryDataPoint message.
+func encodeSummaryDataPoint(b []byte, attrs openmetrics.LabelSet, pts []openmetrics.MetricPoint, ts uint64) []byte {
+	var count, sum float64
+	for _, pt := range pts {
+		switch pt.Suffix {
+		case openmetrics.SuffixCount:
+			count = pt.Value
+		case openmetrics.SuffixSum:
+			sum = pt.Value
+		case openmetrics.SuffixCreated:
+			b = protowire.AppendFixed64(b, 2, epochNanos(pt.Value))
+		}
+	}
+
+	b = protowire.AppendFixed64(b, 3, ts)
+	b = protowire.AppendFixed64(b, 4, uint64(count))
+	b = protowire.AppendFixed64(b, 5, math.Float64bits(sum))
+	b = encodeAttributes(b, 7, attrs)
+	return b
+}
+
+// encodeExemplar encodes an Exemplar message. Hex-encoded trace_id and span_id
+// labels are mapped to the respective fields, all other labels are exported
+// as filtered attributes.
+func encodeExemplar(b []byte, x *openmetrics.Exemplar, ts uint64) []byte {
+	if !x.Timestamp.IsZero() {
+		ts = uint64(x.Timestamp.UnixNano())
+	}
+	b = protowire.AppendFixed64(b, 2, ts)
+	b = protowire.AppendFixed64(b, 3, math.Float64bits(x.Value))
+
+	var attrs openmetrics.LabelSet
+	for _, l := range x.Labels {
+		switch {
+		case l.Name == "span_id" && isHexID(l.Value, 8):
+			id, _ := hex.DecodeString(l.Value)
+			b = protowire.AppendBytes(b, 4, id)
+		case l.Name == "trace_id" && isHexID(l.Value, 16):
+			id, _ := hex.DecodeString(l.Value)
+			b = protowire.AppendBytes(b, 5, id)
+		default:
+			attrs = append(attrs, l)
+		}
+	}
+	b = encodeAttributes(b, 7, attrs)
+	return b
+}
+
+// encodeAttributes encodes labels as KeyValue messages with string values.
+func encodeAttributes(b []byte, num int, attrs openmetrics.LabelSet) []byte {
+	for _, l := range attrs {
+		if l.IsZero() {
+			continue
+		}
+		b = protowire.AppendMessage(b, num, func(b []byte) []byte {
+			b = protowire.AppendString(b, 1, l.Name)
+			b = protowire.AppendMessage(b, 2, func(b []byte) []byte { // AnyValue
+				return protowire.AppendBytes(b, 1, []byte(l.Value))
+			})
+			return b
+		})
+	}
+	return b
+}
+
+func isHexID(s string, size int) bool {
+	if len(s) != 2*size {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
+
+// epochNanos converts epoch seconds into nanoseconds, rounded to microseconds.
+func epochNanos(e float64) uint64 {
+	return uint64(math.Round(e*1e6)) * 1e3
+}
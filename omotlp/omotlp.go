@@ -0,0 +1,188 @@
+// Package omotlp exports metrics to OpenTelemetry collectors via OTLP/HTTP.
+package omotlp
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/bsm/openmetrics"
+)
+
+// Exporter periodically converts the families of a Registry into OTLP metrics
+// and sends them to an OTLP/HTTP endpoint using the protobuf encoding.
+//
+// Counters are exported as cumulative monotonic sums, gauges, unknowns and
+// statesets as gauges, histograms as explicit-bucket histograms and summaries
+// as summaries. Creation times are used as start times. Info families are
+// exported as gauges, unless they are used as resource attributes.
+type Exporter struct {
+	reg  *openmetrics.Registry
+	url  string
+	conf config
+}
+
+// NewExporter inits a new exporter for the given endpoint URL, e.g.
+// "http://otel-collector:4318/v1/metrics".
+func NewExporter(reg *openmetrics.Registry, url string, opts ...Option) *Exporter {
+	conf := config{
+		client:   http.DefaultClient,
+		interval: time.Minute,
+		now:      time.Now,
+		onError:  openmetrics.WarnOnError,
+	}
+	for _, o := range opts {
+		o.update(&conf)
+	}
+
+	if reg == nil {
+		reg = openmetrics.DefaultRegistry()
+	}
+	return &Exporter{reg: reg, url: url, conf: conf}
+}
+
+// Run exports metrics at the configured interval. It blocks until the context
+// is cancelled.
+func (e *Exporter) Run(ctx context.Context) error {
+	ticker := time.NewTicker(e.conf.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			if err := e.Export(ctx); err != nil {
+				e.conf.onError(err)
+			}
+		}
+	}
+}
+
+// Export takes a snapshot of the registry and sends it once.
+func (e *Exporter) Export(ctx context.Context) error {
+	fams, err := e.reg.Snapshot()
+	if err != nil {
+		return err
+	}
+
+	msg := encodeRequest(nil, fams, &e.conf, e.conf.now())
+
+	var body bytes.Buffer
+	if e.conf.noCompression {
+		body.Write(msg)
+	} else {
+		z := gzip.NewWriter(&body)
+		if _, err := z.Write(msg); err != nil {
+			return err
+		}
+		if err := z.Close(); err != nil {
+			return err
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.url, &body)
+	if err != nil {
+		return err
+	}
+	for name, values := range e.conf.header {
+		req.Header[name] = values
+	}
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	if !e.conf.noCompression {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+
+	resp, err := e.conf.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("omotlp: unexpected status code %d from %s: %s", resp.StatusCode, e.url, bytes.TrimSpace(msg))
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return nil
+}
+
+// ----------------------------------------------------------------------------
+
+type config struct {
+	client        *http.Client
+	header        http.Header
+	resource      openmetrics.LabelSet
+	resourceInfo  string
+	interval      time.Duration
+	now           func() time.Time
+	noCompression bool
+	onError       openmetrics.ErrorHandler
+}
+
+// An Option configures the Exporter.
+type Option interface {
+	update(*config)
+}
+
+type inlineOption func(*config)
+
+func (f inlineOption) update(c *config) { f(c) }
+
+// Client sets a custom HTTP client. Default: http.DefaultClient.
+func Client(client *http.Client) Option {
+	return inlineOption(func(c *config) { c.client = client })
+}
+
+// Header sets a custom request header, e.g. for authorization.
+func Header(name, value string) Option {
+	return inlineOption(func(c *config) {
+		if c.header == nil {
+			c.header = make(http.Header)
+		}
+		c.header.Set(name, value)
+	})
+}
+
+// ResourceAttributes adds constant resource attributes, e.g.
+// ResourceAttributes("service.name", "api").
+func ResourceAttributes(nameValuePairs ...string) Option {
+	return inlineOption(func(c *config) { c.resource = openmetrics.Labels(nameValuePairs...) })
+}
+
+// ResourceInfo uses the labels of the Info family with the given name, e.g.
+// "target", as resource attributes. The family is not exported as a metric.
+func ResourceInfo(name string) Option {
+	return inlineOption(func(c *config) { c.resourceInfo = name })
+}
+
+// Interval sets the export interval used by Run. Default: 1m.
+// Non-positive values are ignored.
+func Interval(d time.Duration) Option {
+	return inlineOption(func(c *config) {
+		if d > 0 {
+			c.interval = d
+		}
+	})
+}
+
+// TimeFunc sets a custom time function for data point timestamps.
+// Default: time.Now.
+func TimeFunc(fn func() time.Time) Option {
+	return inlineOption(func(c *config) { c.now = fn })
+}
+
+// NoCompression disables default gzip compression of the request body.
+func NoCompression() Option {
+	return inlineOption(func(c *config) { c.noCompression = true })
+}
+
+// OnError sets a custom error handler for errors during periodic exports.
+// Default: openmetrics.WarnOnError.
+func OnError(fn openmetrics.ErrorHandler) Option {
+	return inlineOption(func(c *config) { c.onError = fn })
+}
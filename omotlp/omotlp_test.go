@@ -0,0 +1,336 @@
+package omotlp_test
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bsm/openmetrics"
+	"github.com/bsm/openmetrics/internal/protowire"
+	"github.com/bsm/openmetrics/omotlp"
+)
+
+func TestExporter_Export(t *testing.T) {
+	rcv := newMockReceiver()
+	defer rcv.Close()
+
+	reg := openmetrics.NewConsistentRegistry(mockNow)
+	reg.Info(openmetrics.Desc{Name: "target", Labels: []string{"host"}}).With("h1")
+	cnt := reg.Counter(openmetrics.Desc{Name: "http_requests", Help: "Requests.", Labels: []string{"path"}})
+	cnt.With("/").AddExemplar(&openmetrics.Exemplar{
+		Value:     2,
+		Timestamp: mockTime,
+		Labels:    openmetrics.Labels("trace_id", "0102030405060708090a0b0c0d0e0f10", "user", "bob"),
+	})
+	hist := reg.Histogram(openmetrics.Desc{Name: "http_request", Unit: "seconds"}, []float64{.1, 1})
+	hist.With().Observe(0.05)
+	hist.With().Observe(0.5)
+	hist.With().Observe(5)
+	reg.Summary(openmetrics.Desc{Name: "payload"}).With().Observe(12)
+	reg.Gauge(openmetrics.Desc{Name: "temp"}).With().Set(0)
+	reg.StateSet(openmetrics.Desc{Name: "mode"}, []string{"a", "b"}).With().Set("b", true)
+
+	exp := omotlp.NewExporter(reg, rcv.URL+"/v1/metrics",
+		omotlp.ResourceAttributes("service.name", "api"),
+		omotlp.ResourceInfo("target"),
+		omotlp.Header("Authorization", "Bearer secret"),
+		omotlp.TimeFunc(func() time.Time { return mockTime.Add(time.Second) }),
+	)
+	if err := exp.Export(context.Background()); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if exp, got := []string{
+		`resource {service.name="api", host="h1"}`,
+		`scope github.com/bsm/openmetrics/omotlp`,
+		`sum http_requests "Requests." "" temporality=2 monotonic=1`,
+		`  {path="/"} 2 start=1515151515757576000 time=1515151516757575757`,
+		`    exemplar 2 time=1515151515757575757 trace=0102030405060708090a0b0c0d0e0f10 {user="bob"}`,
+		`histogram http_request_seconds "" "seconds" temporality=2`,
+		`  {} count=3 sum=5.55 buckets=[1 1 1] bounds=[0.1 1] start=1515151515757576000`,
+		`summary payload "" ""`,
+		`  {} count=1 sum=12 start=1515151515757576000`,
+		`gauge temp "" ""`,
+		`  {} 0 start=0 time=1515151516757575757`,
+		`gauge mode "" ""`,
+		`  {mode="a"} 0 start=0 time=1515151516757575757`,
+		`  {mode="b"} 1 start=0 time=1515151516757575757`,
+	}, rcv.Lines(); !reflect.DeepEqual(exp, got) {
+		t.Fatalf("expected:\n\t%s\ngot:\n\t%s", strings.Join(exp, "\n\t"), strings.Join(got, "\n\t"))
+	}
+}
+
+func TestExporter_Export_error(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		http.Error(w, "quota exceeded", http.StatusTooManyRequests)
+	}))
+	defer srv.Close()
+
+	reg := openmetrics.NewConsistentRegistry(mockNow)
+	exp := omotlp.NewExporter(reg, srv.URL, omotlp.NoCompression())
+	err := exp.Export(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "unexpected status code 429") || !strings.Contains(err.Error(), "quota exceeded") {
+		t.Fatalf("expected error, got %v", err)
+	}
+}
+
+// ----------------------------------------------------------------------------
+
+var mockTime = time.Unix(1515151515, 757575757)
+
+func mockNow() time.Time { return mockTime }
+
+type mockReceiver struct {
+	*httptest.Server
+
+	lines []string
+	mu    sync.Mutex
+}
+
+func newMockReceiver() *mockReceiver {
+	rcv := new(mockReceiver)
+	rcv.Server = httptest.NewServer(rcv)
+	return rcv
+}
+
+func (rcv *mockReceiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/v1/metrics" || r.Method != http.MethodPost ||
+		r.Header.Get("Content-Type") != "application/x-protobuf" ||
+		r.Header.Get("Content-Encoding") != "gzip" ||
+		r.Header.Get("Authorization") != "Bearer secret" {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+
+	z, err := gzip.NewReader(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	msg, err := io.ReadAll(z)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var lines []string
+	if err := decodeMessage(msg, map[int]func([]byte) error{
+		1: func(p []byte) error { // ResourceMetrics
+			return decodeResourceMetrics(p, &lines)
+		},
+	}); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	rcv.mu.Lock()
+	rcv.lines = append(rcv.lines, lines...)
+	rcv.mu.Unlock()
+}
+
+func (rcv *mockReceiver) Lines() []string {
+	rcv.mu.Lock()
+	defer rcv.mu.Unlock()
+
+	return rcv.lines
+}
+
+// decodeMessage decodes embedded message fields with the given handlers.
+func decodeMessage(b []byte, fns map[int]func([]byte) error) error {
+	return protowire.Range(b, func(num int, typ protowire.Type, _ uint64, p []byte) error {
+		if fn, ok := fns[num]; ok && typ == protowire.BytesType {
+			return fn(p)
+		}
+		return nil
+	})
+}
+
+func decodeResourceMetrics(b []byte, lines *[]string) error {
+	return decodeMessage(b, map[int]func([]byte) error{
+		1: func(p []byte) error {
+			attrs, err := decodeAttributes(p, 1)
+			*lines = append(*lines, "resource "+attrs)
+			return err
+		},
+		2: func(p []byte) error {
+			return decodeMessage(p, map[int]func([]byte) error{
+				1: func(p []byte) error {
+					return protowire.Range(p, func(num int, _ protowire.Type, _ uint64, p []byte) error {
+						if num == 1 {
+							*lines = append(*lines, "scope "+string(p))
+						}
+						return nil
+					})
+				},
+				2: func(p []byte) error { return decodeMetric(p, lines) },
+			})
+		},
+	})
+}
+
+func decodeMetric(b []byte, lines *[]string) error {
+	var name, help, unit string
+	var data []string
+	err := protowire.Range(b, func(num int, _ protowire.Type, _ uint64, p []byte) error {
+		switch num {
+		case 1:
+			name = string(p)
+		case 2:
+			help = string(p)
+		case 3:
+			unit = string(p)
+		case 5, 7, 9, 11:
+			kind := map[int]string{5: "gauge", 7: "sum", 9: "histogram", 11: "summary"}[num]
+			var opts string
+			var points []string
+			if err := protowire.Range(p, func(num int, _ protowire.Type, v uint64, p []byte) error {
+				switch num {
+				case 1:
+					s, err := decodeDataPoint(kind, p)
+					points = append(points, strings.Split(s, "\n")...)
+					return err
+				case 2:
+					opts += fmt.Sprintf(" temporality=%d", v)
+				case 3:
+					opts += fmt.Sprintf(" monotonic=%d", v)
+				}
+				return nil
+			}); err != nil {
+				return err
+			}
+			data = append([]string{kind + " %s" + opts}, points...)
+		}
+		return nil
+	})
+
+	data[0] = fmt.Sprintf(data[0], fmt.Sprintf("%s %q %q", name, help, unit))
+	*lines = append(*lines, data...)
+	return err
+}
+
+func decodeDataPoint(kind string, b []byte) (string, error) {
+	var (
+		start, ts  uint64
+		value      string
+		exemplars  []string
+		attrsField = map[string]int{"histogram": 9}[kind]
+	)
+	if attrsField == 0 {
+		attrsField = 7
+	}
+
+	attrs, err := decodeAttributes(b, attrsField)
+	if err != nil {
+		return "", err
+	}
+
+	var count, sum, buckets, bounds string
+	err = protowire.Range(b, func(num int, _ protowire.Type, v uint64, p []byte) error {
+		switch {
+		case num == 2:
+			start = v
+		case num == 3:
+			ts = v
+		case kind == "gauge" || kind == "sum":
+			switch num {
+			case 4:
+				value = fmt.Sprint(math.Float64frombits(v))
+			case 5:
+				s, err := decodeExemplar(p)
+				exemplars = append(exemplars, s)
+				return err
+			}
+		default:
+			switch num {
+			case 4:
+				count = fmt.Sprint(v)
+			case 5:
+				sum = fmt.Sprint(math.Float64frombits(v))
+			case 6:
+				buckets = fmt.Sprint(decodeFixed64s(p))
+			case 7:
+				var fs []float64
+				for _, n := range decodeFixed64s(p) {
+					fs = append(fs, math.Float64frombits(n))
+				}
+				bounds = fmt.Sprint(fs)
+			}
+		}
+		return nil
+	})
+	switch kind {
+	case "histogram":
+		return fmt.Sprintf("  %s count=%s sum=%s buckets=%s bounds=%s start=%d", attrs, count, sum, buckets, bounds, start), err
+	case "summary":
+		return fmt.Sprintf("  %s count=%s sum=%s start=%d", attrs, count, sum, start), err
+	}
+	return strings.Join(append([]string{fmt.Sprintf("  %s %s start=%d time=%d", attrs, value, start, ts)}, exemplars...), "\n"), err
+}
+
+func decodeExemplar(b []byte) (string, error) {
+	attrs, err := decodeAttributes(b, 7)
+	if err != nil {
+		return "", err
+	}
+
+	var ts uint64
+	var value, trace string
+	err = protowire.Range(b, func(num int, _ protowire.Type, v uint64, p []byte) error {
+		switch num {
+		case 2:
+			ts = v
+		case 3:
+			value = fmt.Sprint(math.Float64frombits(v))
+		case 5:
+			trace = hex.EncodeToString(p)
+		}
+		return nil
+	})
+	return fmt.Sprintf("    exemplar %s time=%d trace=%s %s", value, ts, trace, attrs), err
+}
+
+// decodeAttributes decodes repeated KeyValue messages from field num of b.
+func decodeAttributes(b []byte, num int) (string, error) {
+	var pairs []string
+	decodeKV := func(p []byte) error {
+		var key, value string
+		err := protowire.Range(p, func(num int, _ protowire.Type, _ uint64, p []byte) error {
+			switch num {
+			case 1:
+				key = string(p)
+			case 2:
+				return protowire.Range(p, func(num int, _ protowire.Type, _ uint64, p []byte) error {
+					if num == 1 {
+						value = string(p)
+					}
+					return nil
+				})
+			}
+			return nil
+		})
+		pairs = append(pairs, fmt.Sprintf("%s=%q", key, value))
+		return err
+	}
+
+	err := decodeMessage(b, map[int]func([]byte) error{num: decodeKV})
+	return "{" + strings.Join(pairs, ", ") + "}", err
+}
+
+func decodeFixed64s(b []byte) []uint64 {
+	var vs []uint64
+	for ; len(b) >= 8; b = b[8:] {
+		vs = append(vs, binary.LittleEndian.Uint64(b))
+	}
+	return vs
+}
@@ -0,0 +1,238 @@
+// Package ompush pushes metrics to a Prometheus Pushgateway-compatible
+// endpoint. It is intended for short-lived jobs which cannot be scraped.
+package ompush
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/bsm/openmetrics"
+)
+
+// Pusher pushes metrics to a Pushgateway.
+type Pusher struct {
+	endpoint string
+	job      string
+	conf     config
+}
+
+// New inits a new Pusher for the given Pushgateway endpoint URL, e.g.
+// "http://pushgateway:9091", and job name.
+func New(endpoint, job string, opts ...Option) *Pusher {
+	conf := config{
+		client:  http.DefaultClient,
+		backoff: 100 * time.Millisecond,
+	}
+	for _, o := range opts {
+		o.update(&conf)
+	}
+
+	return &Pusher{
+		endpoint: strings.TrimSuffix(endpoint, "/"),
+		job:      job,
+		conf:     conf,
+	}
+}
+
+// Push pushes all metrics of the registry with PUT semantics, replacing all
+// metrics of the grouping key. Metrics are encoded in the Prometheus text
+// format, as expected by the Pushgateway, see Registry.WritePrometheus.
+func (p *Pusher) Push(ctx context.Context, reg *openmetrics.Registry) error {
+	return p.push(ctx, http.MethodPut, reg)
+}
+
+// Add pushes all metrics of the registry with POST semantics, replacing only
+// metrics with the same names within the grouping key.
+func (p *Pusher) Add(ctx context.Context, reg *openmetrics.Registry) error {
+	return p.push(ctx, http.MethodPost, reg)
+}
+
+// Delete deletes all metrics of the grouping key.
+func (p *Pusher) Delete(ctx context.Context) error {
+	target, err := p.url()
+	if err != nil {
+		return err
+	}
+
+	return p.do(ctx, http.MethodDelete, target, nil)
+}
+
+func (p *Pusher) push(ctx context.Context, method string, reg *openmetrics.Registry) error {
+	target, err := p.url()
+	if err != nil {
+		return err
+	}
+
+	if reg == nil {
+		reg = openmetrics.DefaultRegistry()
+	}
+
+	var body bytes.Buffer
+	if p.conf.noCompression {
+		if _, err := reg.WritePrometheus(&body, nil); err != nil {
+			return err
+		}
+	} else {
+		z := gzip.NewWriter(&body)
+		if _, err := reg.WritePrometheus(z, nil); err != nil {
+			return err
+		}
+		if err := z.Close(); err != nil {
+			return err
+		}
+	}
+
+	return p.do(ctx, method, target, body.Bytes())
+}
+
+func (p *Pusher) do(ctx context.Context, method, target string, body []byte) error {
+	backoff := p.conf.backoff
+	for attempt := 0; ; attempt++ {
+		retry, err := p.attempt(ctx, method, target, body)
+		if err == nil || !retry || attempt >= p.conf.retries {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+			backoff *= 2
+		}
+	}
+}
+
+func (p *Pusher) attempt(ctx context.Context, method, target string, body []byte) (bool, error) {
+	var rd io.Reader
+	if body != nil {
+		rd = bytes.NewReader(body)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, target, rd)
+	if err != nil {
+		return false, err
+	}
+	for name, values := range p.conf.header {
+		req.Header[name] = values
+	}
+	if method != http.MethodDelete {
+		req.Header.Set("Content-Type", openmetrics.PrometheusContentType)
+		if !p.conf.noCompression {
+			req.Header.Set("Content-Encoding", "gzip")
+		}
+	}
+
+	resp, err := p.conf.client.Do(req)
+	if err != nil {
+		return ctx.Err() == nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 == 2 {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return false, nil
+	}
+
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	err = fmt.Errorf("ompush: unexpected status code %d from %s: %s", resp.StatusCode, target, bytes.TrimSpace(msg))
+	return resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests, err
+}
+
+func (p *Pusher) url() (string, error) {
+	if p.job == "" {
+		return "", fmt.Errorf("ompush: job name must not be empty")
+	}
+
+	var sb strings.Builder
+	sb.WriteString(p.endpoint)
+	sb.WriteString("/metrics")
+	writeGroupingPair(&sb, "job", p.job)
+	for _, l := range p.conf.grouping {
+		if l.Name == "job" || !(openmetrics.Label{Name: l.Name, Value: "x"}).IsValid() {
+			return "", fmt.Errorf("ompush: grouping label name %q is invalid", l.Name)
+		}
+		writeGroupingPair(&sb, l.Name, l.Value)
+	}
+	return sb.String(), nil
+}
+
+// writeGroupingPair appends a grouping key pair to the path, using base64
+// encoding for values which cannot be represented as a path segment.
+func writeGroupingPair(sb *strings.Builder, name, value string) {
+	sb.WriteByte('/')
+	sb.WriteString(name)
+	if value == "" || strings.Contains(value, "/") {
+		sb.WriteString("@base64/")
+		if value == "" {
+			sb.WriteByte('=')
+		} else {
+			sb.WriteString(base64.RawURLEncoding.EncodeToString([]byte(value)))
+		}
+		return
+	}
+	sb.WriteByte('/')
+	sb.WriteString(url.PathEscape(value))
+}
+
+// ----------------------------------------------------------------------------
+
+type config struct {
+	client        *http.Client
+	grouping      openmetrics.LabelSet
+	header        http.Header
+	retries       int
+	backoff       time.Duration
+	noCompression bool
+}
+
+// An Option configures the Pusher.
+type Option interface {
+	update(*config)
+}
+
+type inlineOption func(*config)
+
+func (f inlineOption) update(c *config) { f(c) }
+
+// Grouping adds a grouping key label, in addition to the job name.
+func Grouping(name, value string) Option {
+	return inlineOption(func(c *config) { c.grouping = c.grouping.Append(name, value) })
+}
+
+// Client sets a custom HTTP client. Default: http.DefaultClient.
+func Client(client *http.Client) Option {
+	return inlineOption(func(c *config) { c.client = client })
+}
+
+// Header sets a custom request header, e.g. for authorization.
+func Header(name, value string) Option {
+	return inlineOption(func(c *config) {
+		if c.header == nil {
+			c.header = make(http.Header)
+		}
+		c.header.Set(name, value)
+	})
+}
+
+// Retries enables retries of failed requests, up to n times. The initial
+// backoff between attempts is doubled after each failure. Only network errors,
+// 5xx and 429 responses are retried.
+func Retries(n int, backoff time.Duration) Option {
+	return inlineOption(func(c *config) {
+		c.retries = n
+		c.backoff = backoff
+	})
+}
+
+// NoCompression disables default gzip compression of the request body.
+func NoCompression() Option {
+	return inlineOption(func(c *config) { c.noCompression = true })
+}
@@ -0,0 +1,25 @@
+package ompush_test
+
+import (
+	"context"
+
+	"github.com/bsm/openmetrics"
+	"github.com/bsm/openmetrics/ompush"
+)
+
+func ExamplePusher_Push() {
+	reg := openmetrics.NewRegistry()
+	processed := reg.Counter(openmetrics.Desc{
+		Name: "batch_records_processed",
+		Help: "Number of records processed by the batch job.",
+	})
+
+	// Run the job.
+	processed.With().Add(1234)
+
+	// Push metrics on completion.
+	pusher := ompush.New("http://pushgateway:9091", "batch", ompush.Grouping("instance", "worker-1"))
+	if err := pusher.Push(context.Background(), reg); err != nil {
+		panic(err)
+	}
+}
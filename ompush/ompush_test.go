@@ -0,0 +1,213 @@
+package ompush_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bsm/openmetrics"
+	"github.com/bsm/openmetrics/ompush"
+)
+
+func TestPusher_Push(t *testing.T) {
+	gw := newMockGateway()
+	defer gw.Close()
+
+	reg := openmetrics.NewConsistentRegistry(mockNow)
+	reg.Counter(openmetrics.Desc{Name: "jobs"}).With().AddExemplar(&openmetrics.Exemplar{Value: 1, Labels: openmetrics.Labels("trace_id", "abc")})
+
+	p := ompush.New(gw.URL, "batch", ompush.Grouping("instance", "host/1"), ompush.Grouping("zone", ""))
+	if err := p.Push(context.Background(), reg); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	req := gw.Last()
+	if exp, got := "PUT", req.Method; exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+	if exp, got := "/metrics/job/batch/instance@base64/aG9zdC8x/zone@base64/=", req.Path; exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+	if exp, got := "gzip", req.Encoding; exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+	if exp, got := openmetrics.PrometheusContentType, req.ContentType; exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+	if exp, got := "# TYPE jobs_total counter\njobs_total 1\n", req.Body; exp != got {
+		t.Errorf("expected %q, got %q", exp, got)
+	}
+}
+
+func TestPusher_Add(t *testing.T) {
+	gw := newMockGateway()
+	defer gw.Close()
+
+	reg := openmetrics.NewConsistentRegistry(mockNow)
+	p := ompush.New(gw.URL, "batch", ompush.NoCompression(), ompush.Header("Authorization", "Bearer s3cret"))
+	if err := p.Add(context.Background(), reg); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	req := gw.Last()
+	if exp, got := "POST", req.Method; exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+	if exp, got := "", req.Encoding; exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+	if exp, got := "Bearer s3cret", req.Authorization; exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+	if exp, got := "", req.Body; exp != got {
+		t.Errorf("expected %q, got %q", exp, got)
+	}
+}
+
+func TestPusher_Delete(t *testing.T) {
+	gw := newMockGateway()
+	defer gw.Close()
+
+	p := ompush.New(gw.URL, "batch", ompush.Grouping("instance", "a"))
+	if err := p.Delete(context.Background()); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	req := gw.Last()
+	if exp, got := "DELETE", req.Method; exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+	if exp, got := "/metrics/job/batch/instance/a", req.Path; exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+}
+
+func TestPusher_retries(t *testing.T) {
+	gw := newMockGateway()
+	defer gw.Close()
+
+	gw.Fail(2, http.StatusServiceUnavailable)
+	p := ompush.New(gw.URL, "batch", ompush.Retries(2, time.Millisecond))
+	if err := p.Delete(context.Background()); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if exp, got := 3, gw.NumRequests(); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+
+	gw.Fail(3, http.StatusServiceUnavailable)
+	if err := p.Delete(context.Background()); err == nil {
+		t.Fatalf("expected error")
+	}
+
+	gw.Fail(1, http.StatusBadRequest)
+	if err := p.Delete(context.Background()); err == nil {
+		t.Fatalf("expected error")
+	}
+	if exp, got := 7, gw.NumRequests(); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+}
+
+func TestPusher_invalid(t *testing.T) {
+	p := ompush.New("http://localhost", "batch", ompush.Grouping("bad name", "x"))
+	if err := p.Delete(context.Background()); err == nil || err.Error() != `ompush: grouping label name "bad name" is invalid` {
+		t.Fatalf("expected error, got %v", err)
+	}
+}
+
+// ----------------------------------------------------------------------------
+
+var mockTime = time.Unix(1515151515, 757575757)
+
+func mockNow() time.Time { return mockTime }
+
+type mockRequest struct {
+	Method, Path, Body                   string
+	ContentType, Encoding, Authorization string
+}
+
+type mockGateway struct {
+	*httptest.Server
+
+	reqs     []mockRequest
+	failures int
+	status   int
+	mu       sync.Mutex
+}
+
+func newMockGateway() *mockGateway {
+	gw := new(mockGateway)
+	gw.Server = httptest.NewServer(gw)
+	return gw
+}
+
+func (gw *mockGateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var rd io.Reader = r.Body
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		z, err := gzip.NewReader(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		rd = z
+	}
+	body, _ := io.ReadAll(rd)
+
+	// like the Pushgateway, only accept the Prometheus text format
+	if r.Method != http.MethodDelete {
+		if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType != "text/plain" {
+			http.Error(w, "unsupported content type", http.StatusUnsupportedMediaType)
+			return
+		}
+		if bytes.Contains(body, []byte("# EOF")) || bytes.Contains(body, []byte(" # {")) {
+			http.Error(w, "unexpected OpenMetrics syntax", http.StatusBadRequest)
+			return
+		}
+	}
+
+	gw.mu.Lock()
+	defer gw.mu.Unlock()
+
+	gw.reqs = append(gw.reqs, mockRequest{
+		Method:        r.Method,
+		Path:          r.URL.EscapedPath(),
+		Body:          string(body),
+		ContentType:   r.Header.Get("Content-Type"),
+		Encoding:      r.Header.Get("Content-Encoding"),
+		Authorization: r.Header.Get("Authorization"),
+	})
+
+	if gw.failures > 0 {
+		gw.failures--
+		http.Error(w, "failed", gw.status)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (gw *mockGateway) Fail(n, status int) {
+	gw.mu.Lock()
+	gw.failures = n
+	gw.status = status
+	gw.mu.Unlock()
+}
+
+func (gw *mockGateway) Last() mockRequest {
+	gw.mu.Lock()
+	defer gw.mu.Unlock()
+	return gw.reqs[len(gw.reqs)-1]
+}
+
+func (gw *mockGateway) NumRequests() int {
+	gw.mu.Lock()
+	defer gw.mu.Unlock()
+	return len(gw.reqs)
+}
@@ -0,0 +1,161 @@
+package omremote
+
+import (
+	"sort"
+	"time"
+
+	"github.com/bsm/openmetrics"
+	"github.com/bsm/openmetrics/internal/metro"
+	"github.com/bsm/openmetrics/internal/protowire"
+)
+
+// timeSeries is an encoded prometheus.TimeSeries message.
+type timeSeries struct {
+	hash uint64
+	data []byte
+}
+
+// collect takes a snapshot of the registry and converts it into time series
+// and an encoded metadata-only write request. Created points are skipped, as
+// they are not ingested by Prometheus.
+func (e *Exporter) collect(now time.Time) ([]timeSeries, []byte, error) {
+	fams, err := e.reg.Snapshot()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var (
+		series []timeSeries
+		meta   []byte
+		labels openmetrics.LabelSet
+	)
+	ts := now.UnixMilli()
+	for _, fam := range fams {
+		meta = protowire.AppendMessage(meta, 3, func(b []byte) []byte {
+			return encodeMetadata(b, &fam)
+		})
+
+		name := fam.Desc.FullName()
+		for _, s := range fam.Series {
+			for _, pt := range s.Points {
+				if pt.Suffix == openmetrics.SuffixCreated {
+					continue
+				}
+
+				labels = append(labels[:0], openmetrics.Label{Name: "__name__", Value: name + pt.Suffix.String()})
+				labels = s.Labels.AppendTo(labels)
+				if !pt.Label.IsZero() {
+					labels = append(labels, pt.Label)
+				}
+				labels = appendExternalLabels(labels, e.conf.externalLabels)
+				sort.Slice(labels, func(i, j int) bool { return labels[i].Name < labels[j].Name })
+
+				series = append(series, timeSeries{
+					hash: hashLabels(labels),
+					data: encodeTimeSeries(nil, labels, pt.Value, ts, pt.Exemplar),
+				})
+			}
+		}
+	}
+	return series, meta, nil
+}
+
+// appendExternalLabels appends external labels unless already present.
+func appendExternalLabels(labels, external openmetrics.LabelSet) openmetrics.LabelSet {
+	n := len(labels)
+
+Outer:
+	for _, el := range external {
+		for _, l := range labels[:n] {
+			if l.Name == el.Name {
+				continue Outer
+			}
+		}
+		if !el.IsZero() {
+			labels = append(labels, el)
+		}
+	}
+	return labels
+}
+
+func hashLabels(labels openmetrics.LabelSet) (id uint64) {
+	for _, l := range labels {
+		id = metro.HashString(l.Name, id)
+		id = metro.HashByte(255, id)
+		id = metro.HashString(l.Value, id)
+		id = metro.HashByte(255, id)
+	}
+	return
+}
+
+func hashBytes(b []byte) uint64 {
+	return metro.HashString(string(b), 0)
+}
+
+// ----------------------------------------------------------------------------
+
+// Metric types, as defined by prometheus.MetricMetadata.MetricType.
+var metadataTypes = map[openmetrics.MetricType]uint64{
+	openmetrics.UnknownType:   0,
+	openmetrics.CounterType:   1,
+	openmetrics.GaugeType:     2,
+	openmetrics.HistogramType: 3,
+	openmetrics.SummaryType:   5,
+	openmetrics.InfoType:      6,
+	openmetrics.StateSetType:  7,
+}
+
+// encodeWriteRequest encodes a prometheus.WriteRequest from encoded
+// time series.
+func encodeWriteRequest(b []byte, series [][]byte) []byte {
+	for _, data := range series {
+		b = protowire.AppendBytes(b, 1, data)
+	}
+	return b
+}
+
+// encodeTimeSeries encodes a prometheus.TimeSeries with a single sample.
+func encodeTimeSeries(b []byte, labels openmetrics.LabelSet, value float64, ts int64, ex *openmetrics.Exemplar) []byte {
+	b = encodeLabels(b, 1, labels)
+	b = protowire.AppendMessage(b, 2, func(b []byte) []byte {
+		b = protowire.AppendDouble(b, 1, value)
+		b = protowire.AppendInt64(b, 2, ts)
+		return b
+	})
+	if ex != nil {
+		b = protowire.AppendMessage(b, 3, func(b []byte) []byte {
+			b = encodeLabels(b, 1, ex.Labels)
+			b = protowire.AppendDouble(b, 2, ex.Value)
+			if !ex.Timestamp.IsZero() {
+				b = protowire.AppendInt64(b, 3, ex.Timestamp.UnixMilli())
+			} else {
+				b = protowire.AppendInt64(b, 3, ts)
+			}
+			return b
+		})
+	}
+	return b
+}
+
+// encodeMetadata encodes a prometheus.MetricMetadata.
+func encodeMetadata(b []byte, fam *openmetrics.FamilySnapshot) []byte {
+	b = protowire.AppendVarint(b, 1, metadataTypes[fam.Type])
+	b = protowire.AppendString(b, 2, fam.Desc.FullName())
+	b = protowire.AppendString(b, 4, fam.Desc.Help)
+	b = protowire.AppendString(b, 5, fam.Desc.Unit)
+	return b
+}
+
+func encodeLabels(b []byte, num int, labels openmetrics.LabelSet) []byte {
+	for _, l := range labels {
+		if l.IsZero() {
+			continue
+		}
+		b = protowire.AppendMessage(b, num, func(b []byte) []byte {
+			b = protowire.AppendString(b, 1, l.Name)
+			b = protowire.AppendString(b, 2, l.Value)
+			return b
+		})
+	}
+	return b
+}
@@ -0,0 +1,367 @@
+// Package omremote exports metrics to Prometheus remote-write receivers. It is
+// intended for environments where metrics cannot be scraped.
+package omremote
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/bsm/openmetrics"
+	"github.com/klauspost/compress/snappy"
+)
+
+// Exporter periodically exports the metrics of a Registry to a remote-write
+// endpoint. Series are distributed across shards by their labels, each shard
+// queues and sends series in batches.
+type Exporter struct {
+	reg  *openmetrics.Registry
+	url  string
+	conf config
+
+	metaHash uint64
+	mu       sync.Mutex
+}
+
+// NewExporter inits a new exporter for the given remote-write endpoint URL.
+func NewExporter(reg *openmetrics.Registry, url string, opts ...Option) *Exporter {
+	conf := config{
+		client:        http.DefaultClient,
+		interval:      15 * time.Second,
+		shards:        1,
+		queueSize:     10_000,
+		batchSize:     500,
+		batchDeadline: 5 * time.Second,
+		minBackoff:    30 * time.Millisecond,
+		maxBackoff:    5 * time.Second,
+		maxRetries:    5,
+		flushTimeout:  5 * time.Second,
+		onError:       openmetrics.WarnOnError,
+	}
+	for _, o := range opts {
+		o.update(&conf)
+	}
+	if conf.shards < 1 {
+		conf.shards = 1
+	}
+	if conf.batchSize < 1 {
+		conf.batchSize = 1
+	}
+
+	if reg == nil {
+		reg = openmetrics.DefaultRegistry()
+	}
+	return &Exporter{reg: reg, url: url, conf: conf}
+}
+
+// Export takes a snapshot of the registry and synchronously sends all series,
+// bypassing the queue.
+func (e *Exporter) Export(ctx context.Context) error {
+	series, meta, err := e.collect(time.Now())
+	if err != nil {
+		return err
+	}
+	if err := e.sendMetadata(ctx, meta); err != nil {
+		return err
+	}
+
+	batch := make([][]byte, 0, e.conf.batchSize)
+	for i, ts := range series {
+		batch = append(batch, ts.data)
+		if len(batch) == e.conf.batchSize || i == len(series)-1 {
+			if err := e.send(ctx, encodeWriteRequest(nil, batch)); err != nil {
+				return err
+			}
+			batch = batch[:0]
+		}
+	}
+	return nil
+}
+
+// Run exports metrics at the configured interval. It blocks until the context
+// is cancelled and then attempts to flush all queued series.
+func (e *Exporter) Run(ctx context.Context) error {
+	queues := make([]chan []byte, e.conf.shards)
+	var wg sync.WaitGroup
+	for i := range queues {
+		queues[i] = make(chan []byte, e.conf.queueSize)
+
+		wg.Add(1)
+		go func(queue <-chan []byte) {
+			defer wg.Done()
+			e.runShard(ctx, queue)
+		}(queues[i])
+	}
+	defer func() {
+		for _, queue := range queues {
+			close(queue)
+		}
+		wg.Wait()
+	}()
+
+	ticker := time.NewTicker(e.conf.interval)
+	defer ticker.Stop()
+
+	for {
+		e.enqueue(ctx, queues)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func (e *Exporter) enqueue(ctx context.Context, queues []chan []byte) {
+	series, meta, err := e.collect(time.Now())
+	if err != nil {
+		e.conf.onError(err)
+		return
+	}
+	if err := e.sendMetadata(ctx, meta); err != nil {
+		e.conf.onError(err)
+	}
+
+	dropped := 0
+	for _, ts := range series {
+		select {
+		case queues[ts.hash%uint64(len(queues))] <- ts.data:
+		default:
+			dropped++
+		}
+	}
+	if dropped != 0 {
+		e.conf.onError(fmt.Errorf("omremote: queue is full, dropped %d series", dropped))
+	}
+}
+
+func (e *Exporter) runShard(ctx context.Context, queue <-chan []byte) {
+	// once ctx is done, all remaining batches are sent within the flush timeout
+	var (
+		drainCtx    context.Context
+		cancelDrain context.CancelFunc
+	)
+	defer func() {
+		if cancelDrain != nil {
+			cancelDrain()
+		}
+	}()
+	sendCtx := func() context.Context {
+		if ctx.Err() == nil {
+			return ctx
+		}
+		if drainCtx == nil {
+			drainCtx, cancelDrain = context.WithTimeout(context.WithoutCancel(ctx), e.conf.flushTimeout)
+		}
+		return drainCtx
+	}
+
+	batch := make([][]byte, 0, e.conf.batchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := e.send(sendCtx(), encodeWriteRequest(nil, batch)); err != nil {
+			e.conf.onError(err)
+		}
+		batch = batch[:0]
+	}
+
+	timer := time.NewTimer(e.conf.batchDeadline)
+	defer timer.Stop()
+
+	for {
+		select {
+		case data, ok := <-queue:
+			if !ok {
+				flush()
+				return
+			}
+
+			batch = append(batch, data)
+			if len(batch) >= e.conf.batchSize {
+				flush()
+			}
+		case <-timer.C:
+			flush()
+			timer.Reset(e.conf.batchDeadline)
+		}
+	}
+}
+
+// sendMetadata sends metadata only if it changed since the last call.
+func (e *Exporter) sendMetadata(ctx context.Context, meta []byte) error {
+	hash := hashBytes(meta)
+
+	e.mu.Lock()
+	changed := e.metaHash != hash
+	e.mu.Unlock()
+	if !changed || len(meta) == 0 {
+		return nil
+	}
+
+	if err := e.send(ctx, meta); err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	e.metaHash = hash
+	e.mu.Unlock()
+	return nil
+}
+
+func (e *Exporter) send(ctx context.Context, msg []byte) error {
+	body := snappy.Encode(nil, msg)
+	backoff := e.conf.minBackoff
+	for attempt := 0; ; attempt++ {
+		retry, err := e.attempt(ctx, body)
+		if err == nil || !retry || attempt >= e.conf.maxRetries {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+			backoff = min(2*backoff, e.conf.maxBackoff)
+		}
+	}
+}
+
+func (e *Exporter) attempt(ctx context.Context, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	for name, values := range e.conf.header {
+		req.Header[name] = values
+	}
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+
+	resp, err := e.conf.client.Do(req)
+	if err != nil {
+		return ctx.Err() == nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 == 2 {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return false, nil
+	}
+
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	err = fmt.Errorf("omremote: unexpected status code %d from %s: %s", resp.StatusCode, e.url, bytes.TrimSpace(msg))
+	return resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests, err
+}
+
+// ----------------------------------------------------------------------------
+
+type config struct {
+	client         *http.Client
+	header         http.Header
+	externalLabels openmetrics.LabelSet
+	interval       time.Duration
+	shards         int
+	queueSize      int
+	batchSize      int
+	batchDeadline  time.Duration
+	minBackoff     time.Duration
+	maxBackoff     time.Duration
+	maxRetries     int
+	flushTimeout   time.Duration
+	onError        openmetrics.ErrorHandler
+}
+
+// An Option configures the Exporter.
+type Option interface {
+	update(*config)
+}
+
+type inlineOption func(*config)
+
+func (f inlineOption) update(c *config) { f(c) }
+
+// Client sets a custom HTTP client. Default: http.DefaultClient.
+func Client(client *http.Client) Option {
+	return inlineOption(func(c *config) { c.client = client })
+}
+
+// Header sets a custom request header, e.g. for authorization.
+func Header(name, value string) Option {
+	return inlineOption(func(c *config) {
+		if c.header == nil {
+			c.header = make(http.Header)
+		}
+		c.header.Set(name, value)
+	})
+}
+
+// ExternalLabels adds labels to all exported series.
+func ExternalLabels(nameValuePairs ...string) Option {
+	return inlineOption(func(c *config) { c.externalLabels = openmetrics.Labels(nameValuePairs...) })
+}
+
+// Interval sets the interval at which the registry is snapshotted. Default: 15s.
+// Non-positive values are ignored.
+func Interval(d time.Duration) Option {
+	return inlineOption(func(c *config) {
+		if d > 0 {
+			c.interval = d
+		}
+	})
+}
+
+// Shards sets the number of concurrent shards. Default: 1.
+func Shards(n int) Option {
+	return inlineOption(func(c *config) { c.shards = n })
+}
+
+// QueueSize sets the maximum number of queued series per shard. Series are
+// dropped when the queue is full. Default: 10,000.
+func QueueSize(n int) Option {
+	return inlineOption(func(c *config) { c.queueSize = n })
+}
+
+// BatchSize sets the maximum number of series per request. Default: 500.
+func BatchSize(n int) Option {
+	return inlineOption(func(c *config) { c.batchSize = n })
+}
+
+// BatchDeadline sets the maximum time series wait in a shard before they are
+// sent. Default: 5s.
+func BatchDeadline(d time.Duration) Option {
+	return inlineOption(func(c *config) { c.batchDeadline = d })
+}
+
+// Backoff sets the minimum and maximum backoff between retries. Default: 30ms, 5s.
+func Backoff(initial, limit time.Duration) Option {
+	return inlineOption(func(c *config) {
+		c.minBackoff = initial
+		c.maxBackoff = limit
+	})
+}
+
+// MaxRetries sets the maximum number of retries of failed requests. Only
+// network errors, 5xx and 429 responses are retried. Default: 5.
+func MaxRetries(n int) Option {
+	return inlineOption(func(c *config) { c.maxRetries = n })
+}
+
+// FlushTimeout sets the time allowed to flush queued series after Run's
+// context is cancelled. Default: 5s.
+func FlushTimeout(d time.Duration) Option {
+	return inlineOption(func(c *config) { c.flushTimeout = d })
+}
+
+// OnError sets a custom error handler for asynchronous errors.
+// Default: openmetrics.WarnOnError.
+func OnError(fn openmetrics.ErrorHandler) Option {
+	return inlineOption(func(c *config) { c.onError = fn })
+}
@@ -0,0 +1,407 @@
+package omremote_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bsm/openmetrics"
+	"github.com/bsm/openmetrics/internal/protowire"
+	"github.com/bsm/openmetrics/omremote"
+	"github.com/klauspost/compress/snappy"
+)
+
+func TestExporter_Export(t *testing.T) {
+	rcv := newMockReceiver()
+	defer rcv.Close()
+
+	reg := openmetrics.NewConsistentRegistry(mockNow)
+	cnt := reg.Counter(openmetrics.Desc{Name: "http_requests", Help: "Requests.", Labels: []string{"path"}})
+	cnt.With("/").AddExemplar(&openmetrics.Exemplar{Value: 2, Timestamp: mockTime, Labels: openmetrics.Labels("trace_id", "abc")})
+	hist := reg.Histogram(openmetrics.Desc{Name: "http_request", Unit: "seconds"}, []float64{.1, 1})
+	hist.With().Observe(0.5)
+	reg.Gauge(openmetrics.Desc{Name: "temp"}).With().Set(0)
+
+	exp := omremote.NewExporter(reg, rcv.URL, omremote.ExternalLabels("region", "eu", "path", "none"), omremote.BatchSize(3))
+	if err := exp.Export(context.Background()); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if exp, got := []string{
+		`http_request_seconds_bucket{le="+Inf",path="none",region="eu"} 1`,
+		`http_request_seconds_bucket{le="0.1",path="none",region="eu"} 0`,
+		`http_request_seconds_bucket{le="1",path="none",region="eu"} 1`,
+		`http_request_seconds_count{path="none",region="eu"} 1`,
+		`http_request_seconds_sum{path="none",region="eu"} 0.5`,
+		`http_requests_total{path="/",region="eu"} 2 # {trace_id="abc"} 2 1515151515757`,
+		`temp{path="none",region="eu"} 0`,
+	}, rcv.Series(); !reflect.DeepEqual(exp, got) {
+		t.Fatalf("expected:\n\t%+v, got:\n\t%+v", strings.Join(exp, "\n\t"), strings.Join(got, "\n\t"))
+	}
+
+	if exp, got := []string{
+		`counter http_requests "Requests." ""`,
+		`histogram http_request_seconds "" "seconds"`,
+		`gauge temp "" ""`,
+	}, rcv.Metadata(); !reflect.DeepEqual(exp, got) {
+		t.Fatalf("expected:\n\t%+v, got:\n\t%+v", exp, got)
+	}
+
+	// 1 metadata request + 7 series in batches of 3
+	if exp, got := 4, rcv.NumRequests(); exp != got {
+		t.Fatalf("expected %v, got %v", exp, got)
+	}
+
+	// metadata is not re-sent unless changed
+	if err := exp.Export(context.Background()); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if exp, got := 7, rcv.NumRequests(); exp != got {
+		t.Fatalf("expected %v, got %v", exp, got)
+	}
+}
+
+func TestExporter_Export_retries(t *testing.T) {
+	rcv := newMockReceiver()
+	defer rcv.Close()
+
+	reg := openmetrics.NewConsistentRegistry(mockNow)
+	reg.Gauge(openmetrics.Desc{Name: "temp"}).With().Set(1)
+
+	rcv.Fail(2, http.StatusServiceUnavailable)
+	exp := omremote.NewExporter(reg, rcv.URL, omremote.Backoff(time.Millisecond, time.Millisecond), omremote.MaxRetries(2))
+	if err := exp.Export(context.Background()); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	rcv.Fail(1, http.StatusBadRequest)
+	reg.Gauge(openmetrics.Desc{Name: "other"})
+	if err := exp.Export(context.Background()); err == nil || !strings.Contains(err.Error(), "unexpected status code 400") {
+		t.Fatalf("expected error, got %v", err)
+	}
+}
+
+func TestExporter_Run(t *testing.T) {
+	rcv := newMockReceiver()
+	defer rcv.Close()
+
+	reg := openmetrics.NewConsistentRegistry(mockNow)
+	cnt := reg.Counter(openmetrics.Desc{Name: "jobs", Labels: []string{"id"}})
+	for i := 0; i < 10; i++ {
+		cnt.With(fmt.Sprint(i)).Add(1)
+	}
+
+	var errs []error
+	var errsMu sync.Mutex
+	exp := omremote.NewExporter(reg, rcv.URL,
+		omremote.Interval(time.Hour),
+		omremote.Shards(3),
+		omremote.BatchSize(2),
+		omremote.BatchDeadline(time.Millisecond),
+		omremote.OnError(func(err error) {
+			// the last response may still be in flight when Run is stopped
+			if errors.Is(err, context.Canceled) {
+				return
+			}
+
+			errsMu.Lock()
+			errs = append(errs, err)
+			errsMu.Unlock()
+		}),
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- exp.Run(ctx) }()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(rcv.Series()) < 10 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+
+	if err := <-done; err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(errs) != 0 {
+		t.Fatalf("expected no errors, got %v", errs)
+	}
+	if exp, got := 10, len(rcv.Series()); exp != got {
+		t.Fatalf("expected %v, got %v", exp, got)
+	}
+}
+
+func TestExporter_Run_flush(t *testing.T) {
+	rcv := newMockReceiver()
+	defer rcv.Close()
+
+	// hold the first batch of series until the exporter is stopped
+	started := make(chan struct{})
+	var once sync.Once
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		if hasSeries(body) {
+			hold := false
+			once.Do(func() { hold = true })
+			if hold {
+				close(started)
+				<-r.Context().Done()
+				return
+			}
+		}
+		rcv.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	reg := openmetrics.NewConsistentRegistry(mockNow)
+	cnt := reg.Counter(openmetrics.Desc{Name: "jobs", Labels: []string{"id"}})
+	for i := 0; i < 6; i++ {
+		cnt.With(fmt.Sprint(i)).Add(1)
+	}
+
+	var errs []error
+	var errsMu sync.Mutex
+	exp := omremote.NewExporter(reg, srv.URL,
+		omremote.Interval(time.Hour),
+		omremote.BatchSize(2),
+		omremote.BatchDeadline(time.Hour),
+		omremote.MaxRetries(0),
+		omremote.OnError(func(err error) {
+			errsMu.Lock()
+			errs = append(errs, err)
+			errsMu.Unlock()
+		}),
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- exp.Run(ctx) }()
+
+	<-started
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	// the held batch is aborted, both queued batches are flushed
+	if exp, got := 1, len(errs); exp != got {
+		t.Fatalf("expected %v, got %v (%v)", exp, got, errs)
+	}
+	if exp, got := 4, len(rcv.Series()); exp != got {
+		t.Fatalf("expected %v, got %v", exp, got)
+	}
+}
+
+func hasSeries(body []byte) bool {
+	msg, err := snappy.Decode(nil, body)
+	if err != nil {
+		return false
+	}
+
+	found := false
+	_ = protowire.Range(msg, func(num int, _ protowire.Type, _ uint64, _ []byte) error {
+		found = found || num == 1
+		return nil
+	})
+	return found
+}
+
+// ----------------------------------------------------------------------------
+
+var mockTime = time.Unix(1515151515, 757575757)
+
+func mockNow() time.Time { return mockTime }
+
+type mockReceiver struct {
+	*httptest.Server
+
+	series   map[string]struct{}
+	metadata []string
+	requests int
+	failures int
+	status   int
+	mu       sync.Mutex
+}
+
+func newMockReceiver() *mockReceiver {
+	rcv := &mockReceiver{series: make(map[string]struct{})}
+	rcv.Server = httptest.NewServer(rcv)
+	return rcv
+}
+
+func (rcv *mockReceiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rcv.mu.Lock()
+	defer rcv.mu.Unlock()
+
+	rcv.requests++
+	if rcv.failures > 0 {
+		rcv.failures--
+		http.Error(w, "failed", rcv.status)
+		return
+	}
+
+	if r.Header.Get("Content-Encoding") != "snappy" || r.Header.Get("X-Prometheus-Remote-Write-Version") != "0.1.0" {
+		http.Error(w, "bad headers", http.StatusBadRequest)
+		return
+	}
+
+	body, _ := io.ReadAll(r.Body)
+	msg, err := snappy.Decode(nil, body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := protowire.Range(msg, func(num int, _ protowire.Type, _ uint64, p []byte) error {
+		switch num {
+		case 1:
+			s, err := decodeTimeSeries(p)
+			if err != nil {
+				return err
+			}
+			rcv.series[s] = struct{}{}
+		case 3:
+			s, err := decodeMetadata(p)
+			if err != nil {
+				return err
+			}
+			rcv.metadata = append(rcv.metadata, s)
+		}
+		return nil
+	}); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (rcv *mockReceiver) Fail(n, status int) {
+	rcv.mu.Lock()
+	rcv.failures = n
+	rcv.status = status
+	rcv.mu.Unlock()
+}
+
+func (rcv *mockReceiver) NumRequests() int {
+	rcv.mu.Lock()
+	defer rcv.mu.Unlock()
+	return rcv.requests
+}
+
+func (rcv *mockReceiver) Metadata() []string {
+	rcv.mu.Lock()
+	defer rcv.mu.Unlock()
+	return append([]string(nil), rcv.metadata...)
+}
+
+func (rcv *mockReceiver) Series() []string {
+	rcv.mu.Lock()
+	defer rcv.mu.Unlock()
+
+	series := make([]string, 0, len(rcv.series))
+	for s := range rcv.series {
+		series = append(series, s)
+	}
+	sort.Strings(series)
+	return series
+}
+
+func decodeTimeSeries(b []byte) (string, error) {
+	var (
+		name     string
+		labels   []string
+		value    float64
+		exemplar string
+	)
+	err := protowire.Range(b, func(num int, _ protowire.Type, _ uint64, p []byte) error {
+		switch num {
+		case 1:
+			n, v, err := decodeLabel(p)
+			if err != nil {
+				return err
+			}
+			if n == "__name__" {
+				name = v
+			} else {
+				labels = append(labels, fmt.Sprintf("%s=%q", n, v))
+			}
+		case 2:
+			return protowire.Range(p, func(num int, _ protowire.Type, v uint64, _ []byte) error {
+				if num == 1 {
+					value = math.Float64frombits(v)
+				}
+				return nil
+			})
+		case 3:
+			var xls []string
+			var xv float64
+			var xts int64
+			if err := protowire.Range(p, func(num int, _ protowire.Type, v uint64, p []byte) error {
+				switch num {
+				case 1:
+					n, v, err := decodeLabel(p)
+					if err != nil {
+						return err
+					}
+					xls = append(xls, fmt.Sprintf("%s=%q", n, v))
+				case 2:
+					xv = math.Float64frombits(v)
+				case 3:
+					xts = int64(v)
+				}
+				return nil
+			}); err != nil {
+				return err
+			}
+			exemplar = fmt.Sprintf(" # {%s} %v %d", strings.Join(xls, ","), xv, xts)
+		}
+		return nil
+	})
+	return fmt.Sprintf("%s{%s} %v%s", name, strings.Join(labels, ","), value, exemplar), err
+}
+
+func decodeLabel(b []byte) (name, value string, err error) {
+	err = protowire.Range(b, func(num int, _ protowire.Type, _ uint64, p []byte) error {
+		switch num {
+		case 1:
+			name = string(p)
+		case 2:
+			value = string(p)
+		}
+		return nil
+	})
+	return
+}
+
+func decodeMetadata(b []byte) (string, error) {
+	var typ uint64
+	var name, help, unit string
+	err := protowire.Range(b, func(num int, _ protowire.Type, v uint64, p []byte) error {
+		switch num {
+		case 1:
+			typ = v
+		case 2:
+			name = string(p)
+		case 4:
+			help = string(p)
+		case 5:
+			unit = string(p)
+		}
+		return nil
+	})
+	types := []string{"unknown", "counter", "gauge", "histogram", "gaugehistogram", "summary", "info", "stateset"}
+	return fmt.Sprintf("%s %s %q %q", types[typ], name, help, unit), err
+}
@@ -0,0 +1,244 @@
+// Package omscrape scrapes metrics from HTTP targets which expose OpenMetrics
+// or Prometheus text documents.
+package omscrape
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/bsm/openmetrics"
+)
+
+// acceptHeader prefers OpenMetrics over the Prometheus text format.
+const acceptHeader = "application/openmetrics-text;version=1.0.0;q=0.9,text/plain;version=0.0.4;q=0.5,*/*;q=0.1"
+
+// Error reasons, as reported by the errors family.
+const (
+	reasonHTTP    = "http"
+	reasonTimeout = "timeout"
+	reasonParse   = "parse"
+)
+
+// Scraper scrapes targets and reports scrape health as metrics.
+type Scraper struct {
+	conf config
+
+	up       openmetrics.GaugeFamily
+	duration openmetrics.GaugeFamily
+	samples  openmetrics.GaugeFamily
+	errors   openmetrics.CounterFamily
+}
+
+// New inits a new Scraper. It registers the following families on reg:
+//
+//	scrape_up{target}
+//	scrape_duration_seconds{target}
+//	scrape_samples{target}
+//	scrape_errors_total{target,reason}
+//
+// The up gauge is 1 if the last scrape succeeded and 0 otherwise, duration
+// and samples describe the last scrape. Errors are counted by reason, which
+// is one of "http", "timeout" or "parse".
+//
+// If reg is nil, the DefaultRegistry is used. It panics if any of the
+// families conflicts with an existing registration.
+func New(reg *openmetrics.Registry, opts ...Option) *Scraper {
+	conf := config{
+		client:  http.DefaultClient,
+		timeout: 10 * time.Second,
+		maxSize: 64 << 20,
+		prefix:  "scrape",
+	}
+	for _, o := range opts {
+		o.update(&conf)
+	}
+
+	if reg == nil {
+		reg = openmetrics.DefaultRegistry()
+	}
+
+	return &Scraper{
+		conf: conf,
+		up: reg.Gauge(openmetrics.Desc{
+			Name:   conf.prefix + "_up",
+			Help:   "Whether the last scrape of the target succeeded.",
+			Labels: []string{"target"},
+		}),
+		duration: reg.Gauge(openmetrics.Desc{
+			Name:   conf.prefix + "_duration",
+			Unit:   "seconds",
+			Help:   "Duration of the last scrape of the target.",
+			Labels: []string{"target"},
+		}),
+		samples: reg.Gauge(openmetrics.Desc{
+			Name:   conf.prefix + "_samples",
+			Help:   "Number of samples returned by the last scrape of the target.",
+			Labels: []string{"target"},
+		}),
+		errors: reg.Counter(openmetrics.Desc{
+			Name:   conf.prefix + "_errors",
+			Help:   "Total number of failed scrapes of the target.",
+			Labels: []string{"target", "reason"},
+		}),
+	}
+}
+
+// Scrape fetches the document exposed at the target URL and parses it into
+// metric families. Documents are requested in the OpenMetrics format, but
+// the Prometheus text format is accepted as a fallback. Parse errors wrap an
+// *openmetrics.ParseError.
+func (s *Scraper) Scrape(ctx context.Context, target string) ([]openmetrics.FamilySnapshot, error) {
+	start := time.Now()
+	fams, reason, err := s.scrape(ctx, target)
+	s.duration.With(target).Set(time.Since(start).Seconds())
+
+	if err != nil {
+		s.up.With(target).Set(0)
+		s.samples.With(target).Set(0)
+		s.errors.With(target, reason).Add(1)
+		return nil, err
+	}
+
+	samples := 0
+	for _, fam := range fams {
+		for _, series := range fam.Series {
+			samples += len(series.Points)
+		}
+	}
+	s.up.With(target).Set(1)
+	s.samples.With(target).Set(float64(samples))
+	return fams, nil
+}
+
+func (s *Scraper) scrape(ctx context.Context, target string) ([]openmetrics.FamilySnapshot, string, error) {
+	if s.conf.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.conf.timeout)
+		defer cancel()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, reasonHTTP, fmt.Errorf("omscrape: %w", err)
+	}
+	for name, values := range s.conf.header {
+		req.Header[name] = values
+	}
+	req.Header.Set("Accept", acceptHeader)
+	req.Header.Set("Accept-Encoding", "gzip")
+	if deadline, ok := ctx.Deadline(); ok {
+		timeout := time.Until(deadline).Seconds()
+		req.Header.Set("X-Prometheus-Scrape-Timeout-Seconds", strconv.FormatFloat(timeout, 'f', 3, 64))
+	}
+
+	resp, err := s.conf.client.Do(req)
+	if err != nil {
+		return nil, errorReason(ctx, reasonHTTP), fmt.Errorf("omscrape: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+		return nil, reasonHTTP, fmt.Errorf("omscrape: unexpected status code %d from %s", resp.StatusCode, target)
+	}
+
+	var body io.Reader = http.MaxBytesReader(nil, resp.Body, s.conf.maxSize)
+	switch enc := resp.Header.Get("Content-Encoding"); enc {
+	case "", "identity":
+	case "gzip":
+		z, err := gzip.NewReader(body)
+		if err != nil {
+			return nil, errorReason(ctx, reasonHTTP), fmt.Errorf("omscrape: %w", err)
+		}
+		defer z.Close()
+
+		// limit the decompressed size, too
+		body = http.MaxBytesReader(nil, z, s.conf.maxSize)
+	default:
+		return nil, reasonHTTP, fmt.Errorf("omscrape: unsupported content encoding %q from %s", enc, target)
+	}
+
+	parse := openmetrics.ParsePrometheus
+	if mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type")); mediaType == "application/openmetrics-text" {
+		parse = openmetrics.Parse
+	}
+
+	fams, err := parse(body)
+	if err != nil {
+		var perr *openmetrics.ParseError
+		if errors.As(err, &perr) {
+			return nil, reasonParse, fmt.Errorf("omscrape: invalid document from %s: %w", target, err)
+		}
+		return nil, errorReason(ctx, reasonHTTP), fmt.Errorf("omscrape: %w", err)
+	}
+	return fams, "", nil
+}
+
+// errorReason returns "timeout" if the context deadline has been exceeded,
+// otherwise the fallback.
+func errorReason(ctx context.Context, fallback string) string {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return reasonTimeout
+	}
+	return fallback
+}
+
+// ----------------------------------------------------------------------------
+
+type config struct {
+	client  *http.Client
+	header  http.Header
+	timeout time.Duration
+	maxSize int64
+	prefix  string
+}
+
+// An Option configures the Scraper.
+type Option interface {
+	update(*config)
+}
+
+type inlineOption func(*config)
+
+func (f inlineOption) update(c *config) { f(c) }
+
+// Client sets a custom HTTP client. Default: http.DefaultClient.
+func Client(client *http.Client) Option {
+	return inlineOption(func(c *config) { c.client = client })
+}
+
+// Header sets a custom request header, e.g. for authorization.
+func Header(name, value string) Option {
+	return inlineOption(func(c *config) {
+		if c.header == nil {
+			c.header = make(http.Header)
+		}
+		c.header.Set(name, value)
+	})
+}
+
+// Timeout limits the duration of each scrape. The remaining time is
+// advertised to the target via the X-Prometheus-Scrape-Timeout-Seconds
+// header. Default: 10s.
+func Timeout(d time.Duration) Option {
+	return inlineOption(func(c *config) { c.timeout = d })
+}
+
+// MaxSize limits the size of scraped documents in bytes, both compressed and
+// decompressed. Default: 64MiB.
+func MaxSize(n int64) Option {
+	return inlineOption(func(c *config) { c.maxSize = n })
+}
+
+// Prefix sets the prefix of the registered health family names.
+// Default: "scrape".
+func Prefix(prefix string) Option {
+	return inlineOption(func(c *config) { c.prefix = prefix })
+}
@@ -0,0 +1,165 @@
+package omscrape_test
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bsm/openmetrics"
+	"github.com/bsm/openmetrics/omscrape"
+)
+
+func TestScraper_Scrape(t *testing.T) {
+	var accept, timeout string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		accept = r.Header.Get("Accept")
+		timeout = r.Header.Get("X-Prometheus-Scrape-Timeout-Seconds")
+
+		w.Header().Set("Content-Type", openmetrics.ContentType)
+		w.Header().Set("Content-Encoding", "gzip")
+		z := gzip.NewWriter(w)
+		defer z.Close()
+		_, _ = io.WriteString(z, "# TYPE jobs counter\njobs_total{kind=\"a\"} 3\njobs_created{kind=\"a\"} 1515151515\n# EOF\n")
+	}))
+	defer srv.Close()
+
+	reg := openmetrics.NewConsistentRegistry(mockNow)
+	s := omscrape.New(reg, omscrape.Timeout(5*time.Second))
+	fams, err := s.Scrape(context.Background(), srv.URL)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if exp, got := 1, len(fams); exp != got {
+		t.Fatalf("expected %v, got %v", exp, got)
+	}
+	if exp, got := "jobs", fams[0].Desc.Name; exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+	if !strings.HasPrefix(accept, "application/openmetrics-text") {
+		t.Errorf("expected OpenMetrics to be preferred, got %q", accept)
+	}
+	if timeout == "" || timeout > "5.000" {
+		t.Errorf("expected timeout to be advertised, got %q", timeout)
+	}
+
+	if exp, got := 1.0, gaugeValue(t, reg, "scrape_up", srv.URL); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+	if exp, got := 2.0, gaugeValue(t, reg, "scrape_samples", srv.URL); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+	if got := gaugeValue(t, reg, "scrape_duration", srv.URL); got <= 0 {
+		t.Errorf("expected positive duration, got %v", got)
+	}
+}
+
+func TestScraper_Scrape_prometheus(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", openmetrics.PrometheusContentType)
+		_, _ = io.WriteString(w, "# TYPE jobs_total counter\njobs_total 3\nup 1\n")
+	}))
+	defer srv.Close()
+
+	s := omscrape.New(openmetrics.NewRegistry())
+	fams, err := s.Scrape(context.Background(), srv.URL)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if exp, got := 2, len(fams); exp != got {
+		t.Fatalf("expected %v, got %v", exp, got)
+	}
+	if exp, got := openmetrics.CounterType, fams[0].Type; exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+}
+
+func TestScraper_Scrape_errors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/invalid":
+			w.Header().Set("Content-Type", openmetrics.ContentType)
+			_, _ = io.WriteString(w, "foo 1\n")
+		case "/slow":
+			select {
+			case <-r.Context().Done():
+			case <-time.After(time.Second):
+			}
+		default:
+			http.Error(w, "Oops", http.StatusInternalServerError)
+		}
+	}))
+	defer srv.Close()
+
+	reg := openmetrics.NewRegistry()
+	s := omscrape.New(reg, omscrape.Timeout(50*time.Millisecond))
+
+	_, err := s.Scrape(context.Background(), srv.URL+"/invalid")
+	var perr *openmetrics.ParseError
+	if !errors.As(err, &perr) {
+		t.Fatalf("expected parse error, got %v", err)
+	}
+	if _, err := s.Scrape(context.Background(), srv.URL+"/slow"); err == nil {
+		t.Fatalf("expected error")
+	}
+	if _, err := s.Scrape(context.Background(), srv.URL+"/fail"); err == nil || !strings.Contains(err.Error(), "unexpected status code 500") {
+		t.Fatalf("expected status error, got %v", err)
+	}
+
+	if exp, got := 0.0, gaugeValue(t, reg, "scrape_up", srv.URL+"/invalid"); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+
+	errs := make(map[string]float64)
+	for _, series := range family(t, reg, "scrape_errors").Series {
+		errs[series.Labels[0].Value+" "+series.Labels[1].Value] = series.Points[0].Value
+	}
+	if exp, got := map[string]float64{
+		srv.URL + "/invalid parse": 1,
+		srv.URL + "/slow timeout":  1,
+		srv.URL + "/fail http":     1,
+	}, errs; !reflect.DeepEqual(exp, got) {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+}
+
+// --------------------------------------------------------------------
+
+var mockTime = time.Unix(1515151515, 757575757)
+
+func mockNow() time.Time { return mockTime }
+
+func family(t *testing.T, reg *openmetrics.Registry, name string) openmetrics.FamilySnapshot {
+	t.Helper()
+
+	fams, err := reg.Snapshot()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	for _, fam := range fams {
+		if fam.Desc.Name == name {
+			return fam
+		}
+	}
+	t.Fatalf("family %q not found", name)
+	return openmetrics.FamilySnapshot{}
+}
+
+func gaugeValue(t *testing.T, reg *openmetrics.Registry, name, target string) float64 {
+	t.Helper()
+
+	for _, series := range family(t, reg, name).Series {
+		if series.Labels[0].Value == target {
+			return series.Points[0].Value
+		}
+	}
+	t.Fatalf("series %s{target=%q} not found", name, target)
+	return 0
+}
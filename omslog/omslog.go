@@ -0,0 +1,173 @@
+// Package omslog counts log records emitted via log/slog.
+package omslog
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+
+	"github.com/bsm/openmetrics"
+)
+
+// NewHandler wraps a slog.Handler and counts handled records by level. It
+// registers the following family on reg:
+//
+//	log_records_total{level}
+//
+// Levels are reported in lower case, e.g. "info" or "warn+2". If an
+// attribute is configured via the Attribute option, its value is recorded as
+// an additional label. An attribute named "level" is recorded as
+// "exported_level".
+//
+// If reg is nil, the DefaultRegistry is used. It panics if the family
+// conflicts with an existing registration.
+func NewHandler(reg *openmetrics.Registry, next slog.Handler, opts ...Option) slog.Handler {
+	c := config{
+		prefix: "log",
+	}
+	for _, o := range opts {
+		o.update(&c)
+	}
+
+	if reg == nil {
+		reg = openmetrics.DefaultRegistry()
+	}
+
+	labels := []string{"level"}
+	if c.attribute == "level" {
+		labels = append(labels, "exported_level")
+	} else if c.attribute != "" {
+		labels = append(labels, c.attribute)
+	}
+
+	return &handler{
+		next: next,
+		counter: &counter{
+			records: reg.Counter(openmetrics.Desc{
+				Name:   c.prefix + "_records",
+				Help:   "Total number of log records.",
+				Labels: labels,
+			}),
+			attribute: c.attribute,
+			exemplar:  c.exemplar,
+		},
+	}
+}
+
+type counter struct {
+	records   openmetrics.CounterFamily
+	attribute string
+	exemplar  func(context.Context) openmetrics.LabelSet
+}
+
+type handler struct {
+	next    slog.Handler
+	counter *counter
+	value   string // attribute value, inherited via WithAttrs
+	grouped bool   // attributes are nested in a group
+}
+
+func (h *handler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h *handler) Handle(ctx context.Context, r slog.Record) error {
+	c := h.counter
+	lvs := []string{strings.ToLower(r.Level.String())}
+	if c.attribute != "" {
+		lvs = append(lvs, h.attributeValue(r))
+	}
+
+	var exemplar openmetrics.LabelSet
+	if c.exemplar != nil {
+		exemplar = c.exemplar(ctx)
+	}
+
+	if len(exemplar) != 0 {
+		c.records.With(lvs...).AddExemplar(&openmetrics.Exemplar{Value: 1, Timestamp: r.Time, Labels: exemplar})
+	} else {
+		c.records.With(lvs...).Add(1)
+	}
+
+	return h.next.Handle(ctx, r)
+}
+
+func (h *handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+
+	h2 := *h
+	h2.next = h.next.WithAttrs(attrs)
+	if !h.grouped && h.counter.attribute != "" {
+		for _, a := range attrs {
+			if a.Key == h.counter.attribute {
+				h2.value = a.Value.Resolve().String()
+			}
+		}
+	}
+	return &h2
+}
+
+func (h *handler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+
+	h2 := *h
+	h2.next = h.next.WithGroup(name)
+	h2.grouped = true
+	return &h2
+}
+
+// attributeValue returns the value of the configured attribute. Record
+// attributes take precedence over inherited ones.
+func (h *handler) attributeValue(r slog.Record) string {
+	value := h.value
+	if !h.grouped {
+		r.Attrs(func(a slog.Attr) bool {
+			if a.Key == h.counter.attribute {
+				value = a.Value.Resolve().String()
+				return false
+			}
+			return true
+		})
+	}
+	return value
+}
+
+// ----------------------------------------------------------------------------
+
+type config struct {
+	prefix    string
+	attribute string
+	exemplar  func(context.Context) openmetrics.LabelSet
+}
+
+// An Option configures the handler.
+type Option interface {
+	update(*config)
+}
+
+type inlineOption func(*config)
+
+func (f inlineOption) update(c *config) { f(c) }
+
+// Prefix sets the prefix of the registered family name. Default: "log".
+func Prefix(prefix string) Option {
+	return inlineOption(func(c *config) { c.prefix = prefix })
+}
+
+// Attribute records the value of a top-level attribute, e.g. "component", as
+// an additional label of the same name, or "exported_level" if the attribute
+// is named "level". Only use attributes with a small, bounded set of values.
+func Attribute(key string) Option {
+	return inlineOption(func(c *config) { c.attribute = key })
+}
+
+// Exemplar attaches exemplars with labels extracted from the record context,
+// e.g. a trace ID, to the counter. Exemplars are skipped when fn returns an
+// empty label set.
+func Exemplar(fn func(context.Context) openmetrics.LabelSet) Option {
+	return inlineOption(func(c *config) { c.exemplar = fn })
+}
@@ -0,0 +1,113 @@
+package omslog_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bsm/openmetrics"
+	"github.com/bsm/openmetrics/omslog"
+)
+
+var (
+	mockTime = time.Unix(1515151515, 757575757)
+	mockNow  = func() time.Time { return mockTime }
+)
+
+type traceKey struct{}
+
+func TestNewHandler(t *testing.T) {
+	var buf bytes.Buffer
+	reg := openmetrics.NewConsistentRegistry(mockNow)
+	reg.OmitCreated = true
+
+	logger := slog.New(omslog.NewHandler(reg, slog.NewTextHandler(&buf, nil)))
+	logger.Info("started")
+	logger.Info("listening")
+	logger.Warn("slow")
+	logger.Debug("skipped")
+	logger.Log(context.Background(), slog.LevelError+2, "boom")
+
+	checkOutput(t, reg, `
+		# TYPE log_records counter
+		# HELP log_records Total number of log records.
+		log_records_total{level="info"} 2
+		log_records_total{level="warn"} 1
+		log_records_total{level="error+2"} 1
+		# EOF
+	`)
+
+	if exp, got := 4, strings.Count(buf.String(), "\n"); exp != got {
+		t.Fatalf("expected %v, got %v", exp, got)
+	}
+}
+
+func TestNewHandler_options(t *testing.T) {
+	reg := openmetrics.NewConsistentRegistry(mockNow)
+	reg.OmitCreated = true
+
+	logger := slog.New(omslog.NewHandler(reg, slog.NewTextHandler(io.Discard, nil),
+		omslog.Prefix("app_log"),
+		omslog.Attribute("component"),
+		omslog.Exemplar(func(ctx context.Context) openmetrics.LabelSet {
+			if id, ok := ctx.Value(traceKey{}).(string); ok {
+				return openmetrics.Labels("trace_id", id)
+			}
+			return nil
+		}),
+	))
+	db := logger.With("component", "db")
+
+	logger.Info("started")
+	db.Info("connected")
+	db.Info("overridden", "component", "cache")
+	db.WithGroup("query").Info("grouped", "component", "ignored")
+
+	ctx := context.WithValue(context.Background(), traceKey{}, "abcd")
+	record := slog.NewRecord(mockTime, slog.LevelError, "failed", 0)
+	_ = db.Handler().Handle(ctx, record)
+
+	checkOutput(t, reg, `
+		# TYPE app_log_records counter
+		# HELP app_log_records Total number of log records.
+		app_log_records_total{level="info"} 1
+		app_log_records_total{level="info",component="db"} 2
+		app_log_records_total{level="info",component="cache"} 1
+		app_log_records_total{level="error",component="db"} 1 # {trace_id="abcd"} 1 1515151515.757576
+		# EOF
+	`)
+}
+
+func TestNewHandler_levelAttribute(t *testing.T) {
+	reg := openmetrics.NewConsistentRegistry(mockNow)
+	reg.OmitCreated = true
+
+	logger := slog.New(omslog.NewHandler(reg, slog.NewTextHandler(io.Discard, nil), omslog.Attribute("level")))
+	logger.Info("started", "level", "debug")
+
+	checkOutput(t, reg, `
+		# TYPE log_records counter
+		# HELP log_records Total number of log records.
+		log_records_total{level="info",exported_level="debug"} 1
+		# EOF
+	`)
+}
+
+func checkOutput(t *testing.T, reg *openmetrics.Registry, exp string) {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if _, err := reg.WriteTo(&buf); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	exp = strings.ReplaceAll(exp, "\t", "")
+	exp = strings.TrimSpace(exp) + "\n"
+	if got := buf.String(); exp != got {
+		t.Fatalf("output mismatch:\n--> EXPECTED\n%s--> GOT\n%s", exp, got)
+	}
+}
@@ -0,0 +1,168 @@
+// Package omsql exports connection pool statistics of database/sql handles.
+package omsql
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+
+	"github.com/bsm/openmetrics"
+)
+
+// Collector collects connection pool statistics of named database handles.
+// It implements the openmetrics.Collector interface:
+//
+//	reg.AddCollector(omsql.New(map[string]*sql.DB{"main": db}))
+//
+// On first use, it registers the following families:
+//
+//	sql_open_connections{db}
+//	sql_in_use_connections{db}
+//	sql_idle_connections{db}
+//	sql_max_open_connections{db}
+//	sql_waits_total{db}
+//	sql_wait_duration_seconds_total{db}
+//	sql_max_idle_closed_total{db}
+//	sql_max_idle_time_closed_total{db}
+//	sql_max_lifetime_closed_total{db}
+//
+// A Collector must only be added to a single registry.
+type Collector struct {
+	conf config
+	dbs  map[string]*sql.DB
+	last map[string]sql.DBStats
+
+	registered  bool
+	registerErr error
+
+	openConns         openmetrics.GaugeFamily
+	inUseConns        openmetrics.GaugeFamily
+	idleConns         openmetrics.GaugeFamily
+	maxOpenConns      openmetrics.GaugeFamily
+	waits             openmetrics.CounterFamily
+	waitDuration      openmetrics.CounterFamily
+	maxIdleClosed     openmetrics.CounterFamily
+	maxIdleTimeClosed openmetrics.CounterFamily
+	maxLifetimeClosed openmetrics.CounterFamily
+
+	mu sync.Mutex
+}
+
+// New inits a new Collector for the given database handles, keyed by the
+// value of the db label.
+func New(dbs map[string]*sql.DB, opts ...Option) *Collector {
+	conf := config{
+		prefix: "sql",
+	}
+	for _, o := range opts {
+		o.update(&conf)
+	}
+
+	c := &Collector{
+		conf: conf,
+		dbs:  make(map[string]*sql.DB, len(dbs)),
+		last: make(map[string]sql.DBStats, len(dbs)),
+	}
+	for name, db := range dbs {
+		c.dbs[name] = db
+	}
+	return c
+}
+
+// Collect implements the openmetrics.Collector interface.
+func (c *Collector) Collect(_ context.Context, reg *openmetrics.Registry) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.registered {
+		c.registered = true
+		c.registerErr = c.register(reg)
+	}
+	if c.registerErr != nil {
+		return c.registerErr
+	}
+
+	for name, db := range c.dbs {
+		c.collect(reg, name, db.Stats())
+	}
+	return nil
+}
+
+func (c *Collector) collect(reg *openmetrics.Registry, name string, stats sql.DBStats) {
+	last := c.last[name]
+	c.last[name] = stats
+
+	c.openConns.With(name).Set(float64(stats.OpenConnections))
+	c.inUseConns.With(name).Set(float64(stats.InUse))
+	c.idleConns.With(name).Set(float64(stats.Idle))
+	c.maxOpenConns.With(name).Set(float64(stats.MaxOpenConnections))
+
+	addTotal(reg, c.waits.With(name), float64(stats.WaitCount), float64(last.WaitCount))
+	addTotal(reg, c.waitDuration.With(name), stats.WaitDuration.Seconds(), last.WaitDuration.Seconds())
+	addTotal(reg, c.maxIdleClosed.With(name), float64(stats.MaxIdleClosed), float64(last.MaxIdleClosed))
+	addTotal(reg, c.maxIdleTimeClosed.With(name), float64(stats.MaxIdleTimeClosed), float64(last.MaxIdleTimeClosed))
+	addTotal(reg, c.maxLifetimeClosed.With(name), float64(stats.MaxLifetimeClosed), float64(last.MaxLifetimeClosed))
+}
+
+// addTotal advances a counter to the current total. Counters are reset if the
+// total decreases, e.g. after a handle has been reopened.
+func addTotal(reg *openmetrics.Registry, c openmetrics.Counter, cur, last float64) {
+	if cur < last {
+		c.Reset(openmetrics.CounterOptions{CreatedAt: reg.Now(), OnError: reg.OnError, LabelPolicy: reg.LabelPolicy})
+		last = 0
+	}
+	if delta := cur - last; delta > 0 {
+		c.Add(delta)
+	}
+}
+
+func (c *Collector) register(reg *openmetrics.Registry) (err error) {
+	labels := []string{"db"}
+	gauge := func(name, help string) openmetrics.GaugeFamily {
+		if err != nil {
+			return nil
+		}
+		var fam openmetrics.GaugeFamily
+		fam, err = reg.AddGauge(openmetrics.Desc{Name: c.conf.prefix + "_" + name, Help: help, Labels: labels})
+		return fam
+	}
+	counter := func(name, unit, help string) openmetrics.CounterFamily {
+		if err != nil {
+			return nil
+		}
+		var fam openmetrics.CounterFamily
+		fam, err = reg.AddCounter(openmetrics.Desc{Name: c.conf.prefix + "_" + name, Unit: unit, Help: help, Labels: labels})
+		return fam
+	}
+
+	c.openConns = gauge("open_connections", "Number of established connections, both in use and idle.")
+	c.inUseConns = gauge("in_use_connections", "Number of connections currently in use.")
+	c.idleConns = gauge("idle_connections", "Number of idle connections.")
+	c.maxOpenConns = gauge("max_open_connections", "Maximum number of open connections.")
+	c.waits = counter("waits", "", "Total number of connections waited for.")
+	c.waitDuration = counter("wait_duration", "seconds", "Total time blocked waiting for a new connection.")
+	c.maxIdleClosed = counter("max_idle_closed", "", "Total number of connections closed due to SetMaxIdleConns.")
+	c.maxIdleTimeClosed = counter("max_idle_time_closed", "", "Total number of connections closed due to SetConnMaxIdleTime.")
+	c.maxLifetimeClosed = counter("max_lifetime_closed", "", "Total number of connections closed due to SetConnMaxLifetime.")
+	return err
+}
+
+// ----------------------------------------------------------------------------
+
+type config struct {
+	prefix string
+}
+
+// An Option configures the Collector.
+type Option interface {
+	update(*config)
+}
+
+type inlineOption func(*config)
+
+func (f inlineOption) update(c *config) { f(c) }
+
+// Prefix sets the prefix of the registered family names. Default: "sql".
+func Prefix(prefix string) Option {
+	return inlineOption(func(c *config) { c.prefix = prefix })
+}
@@ -0,0 +1,30 @@
+package omsql
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bsm/openmetrics"
+)
+
+func TestAddTotal(t *testing.T) {
+	now := time.Unix(1515151515, 0)
+	reg := openmetrics.NewConsistentRegistry(func() time.Time { return now })
+	c := reg.Counter(openmetrics.Desc{Name: "waits"}).With()
+
+	addTotal(reg, c, 3, 0)
+	addTotal(reg, c, 5, 3)
+	if exp, got := 5.0, c.Total(); exp != got {
+		t.Fatalf("expected %v, got %v", exp, got)
+	}
+
+	// counters are reset using the registry clock
+	now = now.Add(time.Minute)
+	addTotal(reg, c, 2, 5)
+	if exp, got := 2.0, c.Total(); exp != got {
+		t.Fatalf("expected %v, got %v", exp, got)
+	}
+	if exp, got := now, c.Created(); !exp.Equal(got) {
+		t.Fatalf("expected %v, got %v", exp, got)
+	}
+}
@@ -0,0 +1,171 @@
+package omsql_test
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bsm/openmetrics"
+	"github.com/bsm/openmetrics/omsql"
+)
+
+var (
+	mockTime = time.Unix(1515151515, 757575757)
+	mockNow  = func() time.Time { return mockTime }
+)
+
+func init() {
+	sql.Register("omsql_test", mockDriver{})
+}
+
+func TestCollector(t *testing.T) {
+	db, err := sql.Open("omsql_test", "")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	reg := openmetrics.NewConsistentRegistry(mockNow)
+	reg.OmitCreated = true
+	reg.AddCollector(omsql.New(map[string]*sql.DB{"main": db}))
+
+	checkOutput(t, reg, `
+		# TYPE sql_open_connections gauge
+		# HELP sql_open_connections Number of established connections, both in use and idle.
+		sql_open_connections{db="main"} 1
+		# TYPE sql_in_use_connections gauge
+		# HELP sql_in_use_connections Number of connections currently in use.
+		sql_in_use_connections{db="main"} 1
+		# TYPE sql_idle_connections gauge
+		# HELP sql_idle_connections Number of idle connections.
+		sql_idle_connections{db="main"} 0
+		# TYPE sql_max_open_connections gauge
+		# HELP sql_max_open_connections Maximum number of open connections.
+		sql_max_open_connections{db="main"} 1
+		# TYPE sql_waits counter
+		# HELP sql_waits Total number of connections waited for.
+		sql_waits_total{db="main"} 0
+		# TYPE sql_wait_duration_seconds counter
+		# UNIT sql_wait_duration_seconds seconds
+		# HELP sql_wait_duration_seconds Total time blocked waiting for a new connection.
+		sql_wait_duration_seconds_total{db="main"} 0
+		# TYPE sql_max_idle_closed counter
+		# HELP sql_max_idle_closed Total number of connections closed due to SetMaxIdleConns.
+		sql_max_idle_closed_total{db="main"} 0
+		# TYPE sql_max_idle_time_closed counter
+		# HELP sql_max_idle_time_closed Total number of connections closed due to SetConnMaxIdleTime.
+		sql_max_idle_time_closed_total{db="main"} 0
+		# TYPE sql_max_lifetime_closed counter
+		# HELP sql_max_lifetime_closed Total number of connections closed due to SetConnMaxLifetime.
+		sql_max_lifetime_closed_total{db="main"} 0
+		# EOF
+	`)
+
+	// wait for the only connection
+	done := make(chan error, 1)
+	go func() {
+		conn, err := db.Conn(ctx)
+		if err == nil {
+			err = conn.Close()
+		}
+		done <- err
+	}()
+	for db.Stats().WaitCount == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(time.Millisecond)
+	_ = conn.Close()
+	if err := <-done; err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	fams, err := reg.Snapshot()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if exp, got := 0.0, value(t, fams, "sql_in_use_connections"); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+	if exp, got := 1.0, value(t, fams, "sql_idle_connections"); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+	if exp, got := 1.0, value(t, fams, "sql_waits"); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+	if got := value(t, fams, "sql_wait_duration_seconds"); got <= 0 {
+		t.Errorf("expected positive wait duration, got %v", got)
+	}
+
+	// totals are not added twice
+	fams, err = reg.Snapshot()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if exp, got := 1.0, value(t, fams, "sql_waits"); exp != got {
+		t.Errorf("expected %v, got %v", exp, got)
+	}
+}
+
+func TestCollector_conflict(t *testing.T) {
+	reg := openmetrics.NewConsistentRegistry(mockNow)
+	reg.Gauge(openmetrics.Desc{Name: "db_idle_connections", Labels: []string{"db"}})
+
+	c := omsql.New(nil, omsql.Prefix("db"))
+	for i := 0; i < 2; i++ {
+		var conflict openmetrics.ErrAlreadyRegistered
+		if err := c.Collect(context.Background(), reg); !errors.As(err, &conflict) {
+			t.Fatalf("expected ErrAlreadyRegistered, got %v", err)
+		}
+	}
+}
+
+func value(t *testing.T, fams []openmetrics.FamilySnapshot, name string) float64 {
+	t.Helper()
+
+	for _, fam := range fams {
+		if fam.Desc.FullName() == name && len(fam.Series) == 1 {
+			return fam.Series[0].Points[0].Value
+		}
+	}
+	t.Fatalf("series %q not found", name)
+	return 0
+}
+
+func checkOutput(t *testing.T, reg *openmetrics.Registry, exp string) {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if _, err := reg.WriteTo(&buf); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	exp = strings.ReplaceAll(exp, "\t", "")
+	exp = strings.TrimSpace(exp) + "\n"
+	if got := buf.String(); exp != got {
+		t.Fatalf("output mismatch:\n--> EXPECTED\n%s--> GOT\n%s", exp, got)
+	}
+}
+
+// ----------------------------------------------------------------------------
+
+type mockDriver struct{}
+
+func (mockDriver) Open(string) (driver.Conn, error) { return mockConn{}, nil }
+
+type mockConn struct{}
+
+func (mockConn) Prepare(string) (driver.Stmt, error) { return nil, errors.New("not supported") }
+func (mockConn) Close() error                        { return nil }
+func (mockConn) Begin() (driver.Tx, error)           { return nil, errors.New("not supported") }
@@ -0,0 +1,402 @@
+// Package omstatsd bridges metrics to StatsD and DogStatsD agents.
+package omstatsd
+
+import (
+	"context"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bsm/openmetrics"
+)
+
+// Exporter periodically walks a Registry and emits its metrics to a StatsD
+// agent. Counters are emitted as deltas since the last flush and gauges as
+// gauges. Histogram observations are emitted as timings in milliseconds if
+// the unit is seconds and as histograms (DogStatsD: distributions) otherwise.
+// Summaries are emitted as counters of their count and sum. Info metrics and
+// created times are not emitted.
+type Exporter struct {
+	reg  *openmetrics.Registry
+	conn net.Conn
+	conf config
+
+	last map[string]float64
+	buf  []byte
+	pkt  []byte
+	mu   sync.Mutex
+}
+
+// NewExporter inits a new exporter, connecting to an agent at network address,
+// e.g. NewExporter(reg, "udp", "127.0.0.1:8125") or
+// NewExporter(reg, "unixgram", "/var/run/datadog/dsd.socket").
+func NewExporter(reg *openmetrics.Registry, network, address string, opts ...Option) (*Exporter, error) {
+	conf := config{
+		interval:      10 * time.Second,
+		maxPacketSize: 1432,
+		onError:       openmetrics.WarnOnError,
+	}
+	for _, o := range opts {
+		o.update(&conf)
+	}
+
+	conn, err := net.Dial(network, address)
+	if err != nil {
+		return nil, err
+	}
+
+	if reg == nil {
+		reg = openmetrics.DefaultRegistry()
+	}
+	return &Exporter{
+		reg:  reg,
+		conn: conn,
+		conf: conf,
+		last: make(map[string]float64),
+	}, nil
+}
+
+// Run flushes metrics at the configured interval. It blocks until the context
+// is cancelled and then performs a final flush.
+func (e *Exporter) Run(ctx context.Context) error {
+	ticker := time.NewTicker(e.conf.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return e.Flush()
+		case <-ticker.C:
+			if err := e.Flush(); err != nil {
+				e.conf.onError(err)
+			}
+		}
+	}
+}
+
+// Flush emits all metrics once.
+func (e *Exporter) Flush() error {
+	fams, err := e.reg.Snapshot()
+	if err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	seen := make(map[string]struct{}, len(e.last))
+	e.pkt = e.pkt[:0]
+	for i := range fams {
+		if err := e.emitFamily(&fams[i], seen); err != nil {
+			return err
+		}
+	}
+	for key := range e.last {
+		if _, ok := seen[key]; !ok {
+			delete(e.last, key)
+		}
+	}
+	return e.writePacket()
+}
+
+// Close closes the connection to the agent.
+func (e *Exporter) Close() error {
+	return e.conn.Close()
+}
+
+func (e *Exporter) emitFamily(fam *openmetrics.FamilySnapshot, seen map[string]struct{}) error {
+	name := e.conf.prefix + fam.Desc.FullName()
+
+	for _, s := range fam.Series {
+		switch fam.Type {
+		case openmetrics.CounterType:
+			for _, pt := range s.Points {
+				if pt.Suffix == openmetrics.SuffixTotal {
+					if err := e.emitDelta(name, s.Labels, pt.Label, pt.Value, seen); err != nil {
+						return err
+					}
+				}
+			}
+		case openmetrics.SummaryType:
+			for _, pt := range s.Points {
+				if pt.Suffix == openmetrics.SuffixCount || pt.Suffix == openmetrics.SuffixSum {
+					if err := e.emitDelta(name+pt.Suffix.String(), s.Labels, pt.Label, pt.Value, seen); err != nil {
+						return err
+					}
+				}
+			}
+		case openmetrics.HistogramType:
+			if err := e.emitHistogram(name, fam.Desc.Unit, &s, seen); err != nil {
+				return err
+			}
+		case openmetrics.GaugeType, openmetrics.UnknownType, openmetrics.StateSetType:
+			for _, pt := range s.Points {
+				if err := e.emitGauge(name, s.Labels, pt.Label, pt.Value); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (e *Exporter) emitDelta(name string, labels openmetrics.LabelSet, extra openmetrics.Label, value float64, seen map[string]struct{}) error {
+	delta := e.delta(name, labels, extra, value, seen)
+	if delta == 0 {
+		return nil
+	}
+	return e.emit(name, labels, extra, delta, "c", 1)
+}
+
+func (e *Exporter) emitGauge(name string, labels openmetrics.LabelSet, extra openmetrics.Label, value float64) error {
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return nil
+	}
+
+	// negative values are interpreted as decrements, reset to zero first
+	if value < 0 {
+		if err := e.emit(name, labels, extra, 0, "g", 1); err != nil {
+			return err
+		}
+	}
+	return e.emit(name, labels, extra, value, "g", 1)
+}
+
+// emitHistogram emits the observations since the last flush. As individual
+// observations are not retained, each observation is approximated by the upper
+// bound of its bucket and emitted using a sample rate. Values which fall into
+// the +Inf bucket are approximated by the highest finite bound or, if there is
+// none, by the mean of the observations since the last flush.
+func (e *Exporter) emitHistogram(name, unit string, s *openmetrics.SeriesSnapshot, seen map[string]struct{}) error {
+	// timings are expected in milliseconds
+	typ, scale := "h", 1.0
+	if unit == "seconds" {
+		typ, scale = "ms", 1000
+	} else if e.conf.dogstatsd {
+		typ = "d"
+	}
+
+	var (
+		prevCount, prevBound float64
+		sum, count           float64
+		hasBound             bool
+	)
+	for _, pt := range s.Points {
+		switch pt.Suffix {
+		case openmetrics.SuffixSum:
+			sum = e.delta(name+"\xffsum", s.Labels, openmetrics.Label{}, pt.Value, seen)
+		case openmetrics.SuffixCount:
+			count = e.delta(name+"\xffcount", s.Labels, openmetrics.Label{}, pt.Value, seen)
+		}
+	}
+
+	for _, pt := range s.Points {
+		if pt.Suffix != openmetrics.SuffixBucket {
+			continue
+		}
+
+		n := e.delta(name, s.Labels, pt.Label, pt.Value-prevCount, seen)
+		prevCount = pt.Value
+
+		bound, err := strconv.ParseFloat(pt.Label.Value, 64)
+		if err != nil {
+			continue
+		}
+		if !math.IsInf(bound, 1) {
+			hasBound = true
+		} else if hasBound {
+			bound = prevBound
+		} else if count > 0 {
+			bound = sum / count
+		}
+		prevBound = bound
+
+		if n <= 0 {
+			continue
+		}
+		if err := e.emit(name, s.Labels, openmetrics.Label{}, bound*scale, typ, 1/n); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// delta returns the difference to the value of the previous flush.
+func (e *Exporter) delta(key string, labels openmetrics.LabelSet, extra openmetrics.Label, value float64, seen map[string]struct{}) float64 {
+	b := append(e.buf[:0], key...)
+	for _, l := range labels {
+		b = append(b, 0xff)
+		b = append(b, l.Name...)
+		b = append(b, '=')
+		b = append(b, l.Value...)
+	}
+	if !extra.IsZero() {
+		b = append(b, 0xff)
+		b = append(b, extra.Name...)
+		b = append(b, '=')
+		b = append(b, extra.Value...)
+	}
+	e.buf = b
+
+	k := string(b)
+	seen[k] = struct{}{}
+
+	delta := value - e.last[k]
+	if delta < 0 { // reset
+		delta = value
+	}
+	e.last[k] = value
+	return delta
+}
+
+func (e *Exporter) emit(name string, labels openmetrics.LabelSet, extra openmetrics.Label, value float64, typ string, rate float64) error {
+	b := e.appendName(e.buf[:0], name, labels, extra)
+	b = append(b, ':')
+	b = strconv.AppendFloat(b, value, 'f', -1, 64)
+	b = append(b, '|')
+	b = append(b, typ...)
+	if rate < 1 {
+		b = append(b, "|@"...)
+		b = strconv.AppendFloat(b, rate, 'f', -1, 64)
+	}
+	if e.conf.dogstatsd {
+		b = appendTags(b, labels, extra)
+	}
+	e.buf = b
+
+	if len(e.pkt) != 0 && len(e.pkt)+1+len(b) > e.conf.maxPacketSize {
+		if err := e.writePacket(); err != nil {
+			return err
+		}
+	}
+	if len(e.pkt) != 0 {
+		e.pkt = append(e.pkt, '\n')
+	}
+	e.pkt = append(e.pkt, b...)
+	return nil
+}
+
+func (e *Exporter) writePacket() error {
+	if len(e.pkt) == 0 {
+		return nil
+	}
+	_, err := e.conn.Write(e.pkt)
+	e.pkt = e.pkt[:0]
+	return err
+}
+
+// appendName appends the metric name. Without DogStatsD tags, label values
+// are appended to the name as dotted segments.
+func (e *Exporter) appendName(b []byte, name string, labels openmetrics.LabelSet, extra openmetrics.Label) []byte {
+	b = appendSanitized(b, name)
+	if e.conf.dogstatsd {
+		return b
+	}
+
+	for _, l := range labels {
+		if !l.IsZero() {
+			b = append(b, '.')
+			b = appendSanitized(b, l.Value)
+		}
+	}
+	if !extra.IsZero() {
+		b = append(b, '.')
+		b = appendSanitized(b, extra.Value)
+	}
+	return b
+}
+
+func appendTags(b []byte, labels openmetrics.LabelSet, extra openmetrics.Label) []byte {
+	first := true
+	appendTag := func(l openmetrics.Label) {
+		if l.IsZero() {
+			return
+		}
+		if first {
+			b = append(b, "|#"...)
+			first = false
+		} else {
+			b = append(b, ',')
+		}
+		b = appendSanitized(b, l.Name)
+		b = append(b, ':')
+		b = appendSanitized(b, l.Value)
+	}
+
+	for _, l := range labels {
+		appendTag(l)
+	}
+	appendTag(extra)
+	return b
+}
+
+// appendSanitized appends s, replacing characters reserved by the protocol.
+func appendSanitized(b []byte, s string) []byte {
+	if !strings.ContainsAny(s, ":|@#,\n\r\t ") {
+		return append(b, s...)
+	}
+
+	for _, r := range s {
+		switch r {
+		case ':', '|', '@', '#', ',', '\n', '\r', '\t', ' ':
+			b = append(b, '_')
+		default:
+			b = append(b, string(r)...)
+		}
+	}
+	return b
+}
+
+// ----------------------------------------------------------------------------
+
+type config struct {
+	prefix        string
+	dogstatsd     bool
+	interval      time.Duration
+	maxPacketSize int
+	onError       openmetrics.ErrorHandler
+}
+
+// An Option configures the Exporter.
+type Option interface {
+	update(*config)
+}
+
+type inlineOption func(*config)
+
+func (f inlineOption) update(c *config) { f(c) }
+
+// Prefix adds a prefix to all metric names, e.g. "myapp.".
+func Prefix(prefix string) Option {
+	return inlineOption(func(c *config) { c.prefix = prefix })
+}
+
+// DogStatsD enables DogStatsD tag encoding of labels. By default, label values
+// are appended to metric names.
+func DogStatsD() Option {
+	return inlineOption(func(c *config) { c.dogstatsd = true })
+}
+
+// Interval sets the flush interval. Default: 10s.
+// Non-positive values are ignored.
+func Interval(d time.Duration) Option {
+	return inlineOption(func(c *config) {
+		if d > 0 {
+			c.interval = d
+		}
+	})
+}
+
+// MaxPacketSize sets the maximum size of a single packet. Default: 1432.
+func MaxPacketSize(n int) Option {
+	return inlineOption(func(c *config) { c.maxPacketSize = n })
+}
+
+// OnError sets a custom error handler for errors during periodic flushes.
+// Default: openmetrics.WarnOnError.
+func OnError(fn openmetrics.ErrorHandler) Option {
+	return inlineOption(func(c *config) { c.onError = fn })
+}
@@ -0,0 +1,155 @@
+package omstatsd_test
+
+import (
+	"net"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bsm/openmetrics"
+	"github.com/bsm/openmetrics/omstatsd"
+)
+
+func TestExporter_Flush(t *testing.T) {
+	agent := newMockAgent(t)
+	defer agent.Close()
+
+	reg := openmetrics.NewConsistentRegistry(mockNow)
+	cnt := reg.Counter(openmetrics.Desc{Name: "http_requests", Labels: []string{"path", "status"}})
+	gauge := reg.Gauge(openmetrics.Desc{Name: "temp", Unit: "celsius"})
+	hist := reg.Histogram(openmetrics.Desc{Name: "latency", Unit: "seconds"}, []float64{.1, 1})
+	payload := reg.Histogram(openmetrics.Desc{Name: "payload", Unit: "bytes"}, []float64{512})
+	summary := reg.Summary(openmetrics.Desc{Name: "size", Unit: "bytes"})
+	reg.Info(openmetrics.Desc{Name: "build", Labels: []string{"version"}}).With("1.0")
+
+	cnt.With("/", "200").Add(3)
+	gauge.With().Set(-1.5)
+	hist.With().Observe(0.05)
+	hist.With().Observe(0.5)
+	hist.With().Observe(0.7)
+	hist.With().Observe(5)
+	payload.With().Observe(100)
+	summary.With().Observe(1024)
+
+	exp, err := omstatsd.NewExporter(reg, "udp", agent.Addr(), omstatsd.Prefix("app."))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer exp.Close()
+
+	if err := exp.Flush(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if exp, got := []string{
+		"app.http_requests./.200:3|c",
+		"app.temp_celsius:0|g",
+		"app.temp_celsius:-1.5|g",
+		"app.latency_seconds:100|ms",
+		"app.latency_seconds:1000|ms|@0.5",
+		"app.latency_seconds:1000|ms",
+		"app.payload_bytes:512|h",
+		"app.size_bytes_count:1|c",
+		"app.size_bytes_sum:1024|c",
+	}, agent.Read(t); !reflect.DeepEqual(exp, got) {
+		t.Fatalf("expected:\n\t%+v, got:\n\t%+v", strings.Join(exp, "\n\t"), strings.Join(got, "\n\t"))
+	}
+
+	cnt.With("/", "200").Add(2)
+	hist.With().Observe(0.3)
+	if err := exp.Flush(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if exp, got := []string{
+		"app.http_requests./.200:2|c",
+		"app.temp_celsius:0|g",
+		"app.temp_celsius:-1.5|g",
+		"app.latency_seconds:1000|ms",
+	}, agent.Read(t); !reflect.DeepEqual(exp, got) {
+		t.Fatalf("expected:\n\t%+v, got:\n\t%+v", strings.Join(exp, "\n\t"), strings.Join(got, "\n\t"))
+	}
+}
+
+func TestExporter_Flush_dogStatsD(t *testing.T) {
+	agent := newMockAgent(t)
+	defer agent.Close()
+
+	reg := openmetrics.NewConsistentRegistry(mockNow)
+	cnt := reg.Counter(openmetrics.Desc{Name: "http_requests", Labels: []string{"path", "status"}})
+	cnt.With("/a:b", "200").Add(1)
+	cnt.With("/", "").Add(1)
+	states := reg.StateSet(openmetrics.Desc{Name: "mode"}, []string{"on", "off"})
+	states.With().Set("on", true)
+	reg.Histogram(openmetrics.Desc{Name: "batch"}, []float64{10}).With().Observe(3)
+
+	exp, err := omstatsd.NewExporter(reg, "udp", agent.Addr(), omstatsd.DogStatsD(), omstatsd.MaxPacketSize(64))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer exp.Close()
+
+	if err := exp.Flush(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if exp, got := []string{
+		"batch:10|d",
+		"http_requests:1|c|#path:/",
+		"http_requests:1|c|#path:/a_b,status:200",
+		"mode:0|g|#mode:off",
+		"mode:1|g|#mode:on",
+	}, sorted(agent.Read(t)); !reflect.DeepEqual(exp, got) {
+		t.Fatalf("expected:\n\t%+v, got:\n\t%+v", strings.Join(exp, "\n\t"), strings.Join(got, "\n\t"))
+	}
+	if n := agent.NumPackets(); n < 2 {
+		t.Fatalf("expected multiple packets, got %d", n)
+	}
+}
+
+// ----------------------------------------------------------------------------
+
+var mockTime = time.Unix(1515151515, 757575757)
+
+func mockNow() time.Time { return mockTime }
+
+type mockAgent struct {
+	net.PacketConn
+	packets int
+}
+
+func newMockAgent(t *testing.T) *mockAgent {
+	t.Helper()
+
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	return &mockAgent{PacketConn: pc}
+}
+
+func (a *mockAgent) Addr() string { return a.LocalAddr().String() }
+
+func (a *mockAgent) NumPackets() int { return a.packets }
+
+// Read reads all pending packets.
+func (a *mockAgent) Read(t *testing.T) []string {
+	t.Helper()
+
+	var lines []string
+	buf := make([]byte, 65536)
+	for {
+		_ = a.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+		n, _, err := a.ReadFrom(buf)
+		if err != nil {
+			break
+		}
+		a.packets++
+		lines = append(lines, strings.Split(string(buf[:n]), "\n")...)
+	}
+	return lines
+}
+
+func sorted(lines []string) []string {
+	sort.Strings(lines)
+	return lines
+}
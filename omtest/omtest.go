@@ -0,0 +1,172 @@
+// Package omtest provides helpers for testing metrics.
+package omtest
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/bsm/openmetrics"
+)
+
+// CollectAndCompare renders the registry and compares the result against an
+// expected OpenMetrics text document. If names are given, only families with
+// matching names (including units, e.g. "http_request_seconds") are compared.
+//
+// Leading whitespace, blank lines and the trailing "# EOF" line are ignored,
+// as are the order of families and samples and all _created samples. On
+// mismatch, the returned error contains a line diff.
+func CollectAndCompare(reg *openmetrics.Registry, expected string, names ...string) error {
+	var buf bytes.Buffer
+	if _, err := reg.WriteTo(&buf); err != nil {
+		return fmt.Errorf("omtest: failed to collect metrics: %w", err)
+	}
+
+	exp := normalize(expected, names)
+	got := normalize(buf.String(), names)
+	if slices.Equal(exp, got) {
+		return nil
+	}
+	return fmt.Errorf("omtest: metrics do not match (-expected +got):\n%s", diff(exp, got))
+}
+
+// ToFloat64 returns the value of a metric with a single value, i.e. a counter,
+// gauge, unknown or info. It panics if the metric has more than one point,
+// excluding _created.
+func ToFloat64(m openmetrics.Metric) float64 {
+	pts, err := m.AppendPoints(nil, &openmetrics.Desc{})
+	if err != nil {
+		panic(fmt.Sprintf("omtest: failed to collect metric: %v", err))
+	}
+
+	var (
+		value float64
+		n     int
+	)
+	for _, pt := range pts {
+		if pt.Suffix != openmetrics.SuffixCreated {
+			value = pt.Value
+			n++
+		}
+	}
+	if n != 1 {
+		panic(fmt.Sprintf("omtest: expected a metric with a single value, got %d", n))
+	}
+	return value
+}
+
+// CountSeries returns the number of series, i.e. distinct label value
+// combinations, in a family.
+func CountSeries(fam openmetrics.MetricFamily) int {
+	return fam.NumMetrics()
+}
+
+// ----------------------------------------------------------------------------
+
+type family struct {
+	name  string
+	meta  []string
+	lines []string
+}
+
+// normalize parses a document into families and returns normalized lines.
+func normalize(doc string, names []string) []string {
+	var (
+		fams []*family
+		cur  *family
+	)
+	for _, line := range strings.Split(doc, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || line == "# EOF" {
+			continue
+		}
+
+		if rest, ok := strings.CutPrefix(line, "# "); ok {
+			_, rest, _ = strings.Cut(rest, " ")
+			name, _, _ := strings.Cut(rest, " ")
+			if cur == nil || cur.name != name {
+				cur = &family{name: name}
+				fams = append(fams, cur)
+			}
+			cur.meta = append(cur.meta, line)
+			continue
+		}
+
+		if cur == nil {
+			cur = &family{}
+			fams = append(fams, cur)
+		}
+		if isCreated(line, cur.name) {
+			continue
+		}
+		cur.lines = append(cur.lines, line)
+	}
+
+	fams = slices.DeleteFunc(fams, func(f *family) bool {
+		return len(names) != 0 && !slices.Contains(names, f.name)
+	})
+	sort.SliceStable(fams, func(i, j int) bool { return fams[i].name < fams[j].name })
+
+	var lines []string
+	for _, f := range fams {
+		sort.SliceStable(f.meta, func(i, j int) bool { return metaRank(f.meta[i]) < metaRank(f.meta[j]) })
+		sort.Strings(f.lines)
+		lines = append(lines, f.meta...)
+		lines = append(lines, f.lines...)
+	}
+	return lines
+}
+
+func isCreated(line, name string) bool {
+	rest, ok := strings.CutPrefix(line, name+"_created")
+	return ok && (strings.HasPrefix(rest, " ") || strings.HasPrefix(rest, "{"))
+}
+
+func metaRank(line string) int {
+	switch {
+	case strings.HasPrefix(line, "# TYPE "):
+		return 0
+	case strings.HasPrefix(line, "# UNIT "):
+		return 1
+	case strings.HasPrefix(line, "# HELP "):
+		return 2
+	}
+	return 3
+}
+
+// diff returns a line diff, based on the longest common subsequence.
+func diff(a, b []string) string {
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var sb strings.Builder
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			sb.WriteString("  " + a[i] + "\n")
+			i++
+			j++
+		case i < len(a) && (j == len(b) || lcs[i+1][j] >= lcs[i][j+1]):
+			sb.WriteString("- " + a[i] + "\n")
+			i++
+		default:
+			sb.WriteString("+ " + b[j] + "\n")
+			j++
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,89 @@
+package omtest_test
+
+import (
+	"testing"
+
+	"github.com/bsm/openmetrics"
+	"github.com/bsm/openmetrics/omtest"
+)
+
+func TestCollectAndCompare(t *testing.T) {
+	reg := openmetrics.NewRegistry()
+	cnt := reg.Counter(openmetrics.Desc{Name: "http_requests", Help: "Requests.", Labels: []string{"path"}})
+	cnt.With("/a").Add(2)
+	cnt.With("/b").Add(1)
+	reg.Gauge(openmetrics.Desc{Name: "temp", Unit: "celsius"}).With().Set(21.5)
+
+	// family and sample order, whitespace and _created are ignored
+	if err := omtest.CollectAndCompare(reg, `
+		# TYPE temp_celsius gauge
+		# UNIT temp_celsius celsius
+		temp_celsius 21.5
+
+		# HELP http_requests Requests.
+		# TYPE http_requests counter
+		http_requests_total{path="/b"} 1
+		http_requests_total{path="/a"} 2
+		http_requests_created{path="/a"} 1
+	`); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	// filtered by name
+	if err := omtest.CollectAndCompare(reg, `
+		# TYPE temp_celsius gauge
+		# UNIT temp_celsius celsius
+		temp_celsius 21.5
+		# EOF
+	`, "temp_celsius"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	// mismatch
+	err := omtest.CollectAndCompare(reg, `
+		# TYPE temp_celsius gauge
+		# UNIT temp_celsius celsius
+		temp_celsius 20
+	`, "temp_celsius")
+	if exp := "omtest: metrics do not match (-expected +got):\n" +
+		"  # TYPE temp_celsius gauge\n" +
+		"  # UNIT temp_celsius celsius\n" +
+		"- temp_celsius 20\n" +
+		"+ temp_celsius 21.5\n"; err == nil || err.Error() != exp {
+		t.Fatalf("expected:\n%s\ngot:\n%v", exp, err)
+	}
+}
+
+func TestToFloat64(t *testing.T) {
+	reg := openmetrics.NewRegistry()
+	cnt := reg.Counter(openmetrics.Desc{Name: "foo"}).With()
+	cnt.Add(3)
+	gauge := reg.Gauge(openmetrics.Desc{Name: "bar"}).With()
+	gauge.Set(-1.5)
+
+	if exp, got := 3.0, omtest.ToFloat64(cnt); exp != got {
+		t.Fatalf("expected %v, got %v", exp, got)
+	}
+	if exp, got := -1.5, omtest.ToFloat64(gauge); exp != got {
+		t.Fatalf("expected %v, got %v", exp, got)
+	}
+
+	hist := reg.Histogram(openmetrics.Desc{Name: "baz"}, []float64{1}).With()
+	defer func() {
+		if r := recover(); r == nil {
+			t.Fatal("expected panic")
+		}
+	}()
+	omtest.ToFloat64(hist)
+}
+
+func TestCountSeries(t *testing.T) {
+	reg := openmetrics.NewRegistry()
+	fam := reg.Counter(openmetrics.Desc{Name: "foo", Labels: []string{"a"}})
+	fam.With("x").Add(1)
+	fam.With("y").Add(1)
+
+	if exp, got := 2, omtest.CountSeries(fam); exp != got {
+		t.Fatalf("expected %v, got %v", exp, got)
+	}
+}
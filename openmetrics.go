@@ -31,7 +31,7 @@ func (t MetricType) String() string {
 		return "info"
 	case HistogramType:
 		return "histogram"
-	case _GaugeHistogramType:
+	case GaugeHistogramType:
 		return "gaugehistogram"
 	case SummaryType:
 		return "summary"
@@ -54,7 +54,7 @@ const (
 	// HistogramType must use histogram MetricPoint values.
 	HistogramType
 	// GaugeHistogramType must use gaugehistogram value MetricPoint values.
-	_GaugeHistogramType
+	GaugeHistogramType
 	// Summary quantiles must use summary value MetricPoint values.
 	SummaryType
 )
@@ -75,9 +75,9 @@ func (m MetricSuffix) String() string {
 		return "_sum"
 	case SuffixBucket:
 		return "_bucket"
-	case _SuffixGCount:
+	case SuffixGCount:
 		return "_gcount"
-	case _SuffixGSum:
+	case SuffixGSum:
 		return "_gsum"
 	case SuffixInfo:
 		return "_info"
@@ -94,8 +94,8 @@ const (
 	SuffixCount                       // histogram, summary
 	SuffixSum                         // histogram, summary
 	SuffixBucket                      // histogram, gaugehistogram
-	_SuffixGCount                     // gaugehistogram
-	_SuffixGSum                       // gaugehistogram
+	SuffixGCount                      // gaugehistogram
+	SuffixGSum                        // gaugehistogram
 	SuffixInfo                        // info
 	suffixTerminator
 )
@@ -131,6 +131,7 @@ type metricFamily struct {
 	metrics map[uint64]metricWithLabels
 	factory func() (Metric, error)
 	onError ErrorHandler
+	policy  LabelPolicy
 
 	mu sync.RWMutex
 }
@@ -148,27 +149,31 @@ func (f *metricFamily) NumMetrics() int {
 
 func (f *metricFamily) with(lvs ...string) (Metric, error) {
 	labelID := calculateLabelID(len(f.desc.Labels), lvs)
+	if met, ok := f.lookup(labelID); ok {
+		return met, nil
+	}
 
-	f.mu.RLock()
-	mwl, ok := f.metrics[labelID]
-	f.mu.RUnlock()
-	if ok {
-		return mwl.met, nil
+	// label values may change when sanitized, e.g. when mapped to a shared
+	// value, so look up the metric again
+	sanitized, err := f.desc.sanitizeLabelValues(lvs, f.policy)
+	if err != nil {
+		return nil, err
+	}
+	if sanitizedID := calculateLabelID(len(f.desc.Labels), sanitized); sanitizedID != labelID {
+		if met, ok := f.lookup(sanitizedID); ok {
+			return met, nil
+		}
+		labelID, lvs = sanitizedID, sanitized
 	}
 
 	// with write lock
 	f.mu.Lock()
 	defer f.mu.Unlock()
 
-	if mwl, ok = f.metrics[labelID]; ok {
+	if mwl, ok := f.metrics[labelID]; ok {
 		return mwl.met, nil
 	}
 
-	err := f.desc.validateLabelValues(lvs)
-	if err != nil {
-		return nil, err
-	}
-
 	met, err := f.factory()
 	if err != nil {
 		return nil, err
@@ -181,6 +186,13 @@ func (f *metricFamily) with(lvs ...string) (Metric, error) {
 	return met, nil
 }
 
+func (f *metricFamily) lookup(labelID uint64) (Metric, bool) {
+	f.mu.RLock()
+	mwl, ok := f.metrics[labelID]
+	f.mu.RUnlock()
+	return mwl.met, ok
+}
+
 func (f *metricFamily) snapshot(s *snapshot) error {
 	f.mu.RLock()
 	defer f.mu.RUnlock()
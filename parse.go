@@ -0,0 +1,815 @@
+package openmetrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// ParseError describes a problem with a parsed document.
+type ParseError struct {
+	// Line is the 1-based line number.
+	Line int
+	// Msg describes the problem.
+	Msg string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Msg)
+}
+
+// Parse parses and validates an OpenMetrics text document and returns its
+// metric families. A *ParseError is returned for documents which do not
+// conform to the specification. Sample timestamps are validated, but
+// discarded. Quoted UTF-8 metric and label names, as written by registries
+// with UTF8Names enabled, are accepted.
+func Parse(r io.Reader) ([]FamilySnapshot, error) {
+	p := newParser(false)
+	return p.Parse(r)
+}
+
+// ParsePrometheus parses a document in the Prometheus text exposition format,
+// version 0.0.4, and returns its metric families. Counter families are named
+// without the _total suffix and untyped metrics are returned as unknowns, so
+// the result is equivalent to an OpenMetrics document. A *ParseError is
+// returned for malformed documents. Sample timestamps are validated, but
+// discarded.
+func ParsePrometheus(r io.Reader) ([]FamilySnapshot, error) {
+	p := newParser(true)
+	return p.Parse(r)
+}
+
+// ----------------------------------------------------------------------------
+
+type parsedFamily struct {
+	FamilySnapshot
+
+	name     string
+	metaName string
+	hasType  bool
+	hasUnit  bool
+	hasHelp  bool
+	series   map[string]int
+	open     int // index of the series which received the last sample
+	openLine int // line of the last sample
+	labelIdx map[string]struct{}
+}
+
+type parser struct {
+	prom bool
+	line int
+	fams []*parsedFamily
+	cur  *parsedFamily
+	seen map[string]*parsedFamily
+	eof  bool
+}
+
+func newParser(prom bool) *parser {
+	return &parser{prom: prom, seen: make(map[string]*parsedFamily)}
+}
+
+func (p *parser) Parse(r io.Reader) ([]FamilySnapshot, error) {
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	s.Split(scanLines)
+
+	for s.Scan() {
+		p.line++
+		line := s.Text()
+		if p.prom {
+			if err := p.parsePrometheusLine(strings.TrimSuffix(line, "\n")); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if p.eof {
+			return nil, p.errorf("unexpected content after # EOF")
+		}
+		if !strings.HasSuffix(line, "\n") {
+			return nil, p.errorf("line must end with a newline")
+		}
+		if err := p.parseLine(line[:len(line)-1]); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	if err := p.closeSeries(p.cur); err != nil {
+		return nil, err
+	}
+	if !p.eof && !p.prom {
+		p.line++
+		return nil, p.errorf("missing # EOF")
+	}
+
+	fams := make([]FamilySnapshot, 0, len(p.fams))
+	for _, f := range p.fams {
+		fams = append(fams, f.FamilySnapshot)
+	}
+	return fams, nil
+}
+
+// scanLines splits lines, but retains the trailing newline.
+func scanLines(data []byte, atEOF bool) (int, []byte, error) {
+	if atEOF && len(data) == 0 {
+		return 0, nil, nil
+	}
+	if i := strings.IndexByte(string(data), '\n'); i >= 0 {
+		return i + 1, data[:i+1], nil
+	}
+	if atEOF {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
+
+func (p *parser) errorf(format string, args ...any) error {
+	return p.errorAt(p.line, format, args...)
+}
+
+func (p *parser) errorAt(line int, format string, args ...any) error {
+	return &ParseError{Line: line, Msg: fmt.Sprintf(format, args...)}
+}
+
+func (p *parser) parseLine(line string) error {
+	if line == "# EOF" {
+		p.eof = true
+		return nil
+	}
+	if rest, ok := strings.CutPrefix(line, "#"); ok {
+		return p.parseMetadata(rest)
+	}
+	return p.parseSample(line)
+}
+
+func (p *parser) parsePrometheusLine(line string) error {
+	line = strings.TrimLeft(line, " \t")
+	if line == "" {
+		return nil
+	}
+	if rest, ok := strings.CutPrefix(line, "#"); ok {
+		// only HELP and TYPE are significant, other comments are ignored
+		if fields := strings.Fields(rest); len(fields) >= 2 && (fields[0] == "HELP" || fields[0] == "TYPE") {
+			return p.parseMetadata(rest)
+		}
+		return nil
+	}
+	return p.parseSample(line)
+}
+
+func (p *parser) parseMetadata(line string) error {
+	keyword, rest, ok := strings.Cut(strings.TrimPrefix(line, " "), " ")
+	if !ok || !strings.HasPrefix(line, " ") {
+		return p.errorf("invalid metadata line")
+	}
+	name, value, err := cutMetricName(rest, " ")
+	if err != nil {
+		return p.errorf("%v", err)
+	}
+	value, ok = strings.CutPrefix(value, " ")
+	if !ok && value != "" {
+		return p.errorf("invalid metadata line")
+	} else if !ok && keyword == "TYPE" {
+		return p.errorf("missing %s value", keyword)
+	}
+
+	fam := p.cur
+	if fam == nil || fam.metaName != name {
+		if fam != nil && len(fam.Series) != 0 && p.belongsTo(fam, name) {
+			return p.errorf("metadata for %q must precede its samples", name)
+		}
+
+		var err error
+		if fam, err = p.startFamily(name); err != nil {
+			return err
+		}
+	} else if len(fam.Series) != 0 {
+		return p.errorf("metadata for %q must precede its samples", name)
+	}
+
+	switch keyword {
+	case "TYPE":
+		if fam.hasType {
+			return p.errorf("duplicate TYPE for %q", name)
+		}
+		mt, ok := p.parseMetricType(value)
+		if !ok {
+			return p.errorf("invalid metric type %q", value)
+		}
+		fam.hasType = true
+		fam.Type = mt
+
+		// Prometheus counters are usually named with the _total suffix
+		if p.prom && mt == CounterType && strings.HasSuffix(name, SuffixTotal.String()) {
+			fam.name = strings.TrimSuffix(name, SuffixTotal.String())
+			fam.Desc.Name = fam.name
+		}
+	case "UNIT":
+		if p.prom {
+			return p.errorf("invalid metadata keyword %q", keyword)
+		}
+		if fam.hasUnit {
+			return p.errorf("duplicate UNIT for %q", name)
+		}
+		if value != "" {
+			if !isValidMetricUnit(value) {
+				return p.errorf("invalid unit %q", value)
+			}
+			if !strings.HasSuffix(name, "_"+value) {
+				return p.errorf("metric name %q must end with unit %q", name, value)
+			}
+			fam.Desc.Name = strings.TrimSuffix(name, "_"+value)
+			fam.Desc.Unit = value
+		}
+		fam.hasUnit = true
+	case "HELP":
+		if fam.hasHelp {
+			return p.errorf("duplicate HELP for %q", name)
+		}
+		// Prometheus does not escape double quotes in HELP
+		help, err := unescape(value, !p.prom)
+		if err != nil {
+			return p.errorf("invalid HELP: %v", err)
+		}
+		fam.hasHelp = true
+		fam.Desc.Help = help
+	default:
+		return p.errorf("invalid metadata keyword %q", keyword)
+	}
+	return nil
+}
+
+func (p *parser) startFamily(name string) (*parsedFamily, error) {
+	if err := p.closeSeries(p.cur); err != nil {
+		return nil, err
+	}
+
+	if fam, ok := p.seen[name]; ok {
+		// Prometheus permits scattered samples of untyped metrics
+		if p.prom && len(fam.Series) != 0 {
+			p.cur = fam
+			return fam, nil
+		}
+		return nil, p.errorf("metric family %q must not be interleaved", name)
+	}
+
+	fam := &parsedFamily{
+		FamilySnapshot: FamilySnapshot{Desc: Desc{Name: name}},
+		name:           name,
+		metaName:       name,
+		series:         make(map[string]int),
+		labelIdx:       make(map[string]struct{}),
+		open:           -1,
+	}
+	p.seen[name] = fam
+	p.fams = append(p.fams, fam)
+	p.cur = fam
+	return fam, nil
+}
+
+// belongsTo returns true if a sample name belongs to a family.
+func (p *parser) belongsTo(fam *parsedFamily, name string) bool {
+	_, ok := p.sampleSuffix(fam, name)
+	return ok
+}
+
+func (p *parser) sampleSuffix(fam *parsedFamily, name string) (MetricSuffix, bool) {
+	rest, ok := strings.CutPrefix(name, fam.name)
+	if !ok {
+		return 0, false
+	}
+
+	// Prometheus counters may be exposed without the _total suffix
+	if p.prom && fam.Type == CounterType && rest == "" {
+		return SuffixTotal, true
+	}
+
+	for _, sfx := range typeSuffixes[fam.Type] {
+		// Prometheus exposes _created samples as separate gauges
+		if p.prom && sfx == SuffixCreated {
+			continue
+		}
+		if rest == sfx.String() {
+			return sfx, true
+		}
+	}
+	return 0, false
+}
+
+// isSuffixOf returns true if name is the family name with an optional
+// well-known suffix.
+func isSuffixOf(famName, name string) bool {
+	rest, ok := strings.CutPrefix(name, famName)
+	if !ok {
+		return false
+	}
+	for sfx := SuffixEmpty; sfx < suffixTerminator; sfx++ {
+		if rest == sfx.String() {
+			return true
+		}
+	}
+	return false
+}
+
+var typeSuffixes = map[MetricType][]MetricSuffix{
+	UnknownType:        {SuffixEmpty},
+	GaugeType:          {SuffixEmpty},
+	CounterType:        {SuffixTotal, SuffixCreated},
+	StateSetType:       {SuffixEmpty},
+	InfoType:           {SuffixInfo},
+	HistogramType:      {SuffixBucket, SuffixCount, SuffixSum, SuffixCreated},
+	GaugeHistogramType: {SuffixBucket, SuffixGCount, SuffixGSum},
+	SummaryType:        {SuffixEmpty, SuffixCount, SuffixSum, SuffixCreated},
+}
+
+func (p *parser) parseMetricType(s string) (MetricType, bool) {
+	if p.prom {
+		switch s {
+		case "counter":
+			return CounterType, true
+		case "gauge":
+			return GaugeType, true
+		case "histogram":
+			return HistogramType, true
+		case "summary":
+			return SummaryType, true
+		case "untyped":
+			return UnknownType, true
+		}
+		return 0, false
+	}
+
+	for mt := UnknownType; mt <= SummaryType; mt++ {
+		if mt.String() == s {
+			return mt, true
+		}
+	}
+	return 0, false
+}
+
+func (p *parser) parseSample(line string) error {
+	// name, quoted names may also be the first item of the label set
+	var quoted bool
+	if strings.HasPrefix(line, "{\"") {
+		line, quoted = line[1:], true
+	}
+	name, rest, err := cutMetricName(line, "{ \t")
+	if err != nil {
+		return p.errorf("%v", err)
+	}
+	if quoted {
+		switch {
+		case strings.HasPrefix(rest, ","):
+			rest = "{" + rest[1:]
+		case strings.HasPrefix(rest, "}"):
+			rest = rest[1:]
+		default:
+			return p.errorf("invalid sample")
+		}
+	} else if rest == "" {
+		return p.errorf("invalid sample")
+	}
+
+	fam := p.cur
+	if fam != nil && !p.belongsTo(fam, name) && isSuffixOf(fam.name, name) {
+		return p.errorf("invalid sample name %q for %s family %q", name, fam.Type, fam.name)
+	}
+	if fam == nil || !p.belongsTo(fam, name) {
+		var err error
+		if fam, err = p.startFamily(name); err != nil {
+			return err
+		}
+	}
+	sfx, _ := p.sampleSuffix(fam, name)
+
+	// labels
+	var labels LabelSet
+	if strings.HasPrefix(rest, "{") {
+		if labels, rest, err = parseLabels(rest); err != nil {
+			return p.errorf("%v", err)
+		}
+	}
+
+	// value
+	if p.prom {
+		return p.parsePrometheusValue(fam, sfx, labels, rest)
+	}
+	if !strings.HasPrefix(rest, " ") {
+		return p.errorf("missing value")
+	}
+	sample, exemplar, hasExemplar := strings.Cut(rest[1:], " # ")
+	fields := strings.Split(sample, " ")
+	if len(fields) > 2 {
+		return p.errorf("invalid sample %q", sample)
+	}
+	value, err := parseNumber(fields[0])
+	if err != nil {
+		return p.errorf("invalid value %q", fields[0])
+	}
+	if len(fields) == 2 {
+		if _, err := parseNumber(fields[1]); err != nil {
+			return p.errorf("invalid timestamp %q", fields[1])
+		}
+	}
+
+	pt := MetricPoint{Suffix: sfx, Value: value}
+	if hasExemplar {
+		if !(sfx == SuffixTotal || sfx == SuffixBucket) {
+			return p.errorf("exemplars are only allowed on counters and buckets")
+		}
+		x, err := parseExemplar(exemplar)
+		if err != nil {
+			return p.errorf("%v", err)
+		}
+		pt.Exemplar = x
+	}
+	return p.addPoint(fam, labels, pt)
+}
+
+func (p *parser) parsePrometheusValue(fam *parsedFamily, sfx MetricSuffix, labels LabelSet, s string) error {
+	fields := strings.Fields(s)
+	if len(fields) == 0 {
+		return p.errorf("missing value")
+	} else if len(fields) > 2 || (s[0] != ' ' && s[0] != '\t') {
+		return p.errorf("invalid sample %q", strings.TrimSpace(s))
+	}
+
+	value, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return p.errorf("invalid value %q", fields[0])
+	}
+	if len(fields) == 2 {
+		if _, err := strconv.ParseInt(fields[1], 10, 64); err != nil {
+			return p.errorf("invalid timestamp %q", fields[1])
+		}
+	}
+	return p.addPoint(fam, labels, MetricPoint{Suffix: sfx, Value: value})
+}
+
+// addPoint validates a point and appends it to the family.
+func (p *parser) addPoint(fam *parsedFamily, labels LabelSet, pt MetricPoint) error {
+	// point label
+	var pointLabel string
+	switch {
+	case pt.Suffix == SuffixBucket:
+		pointLabel = "le"
+	case fam.Type == SummaryType && pt.Suffix == SuffixEmpty:
+		pointLabel = "quantile"
+	case fam.Type == StateSetType:
+		pointLabel = fam.name
+	}
+	if pointLabel != "" {
+		pos := -1
+		for i, l := range labels {
+			if l.Name == pointLabel {
+				pos = i
+			}
+		}
+		if pos < 0 {
+			return p.errorf("missing %q label", pointLabel)
+		}
+		pt.Label = labels[pos]
+		labels = append(labels[:pos:pos], labels[pos+1:]...)
+
+		if pointLabel != fam.name {
+			if _, err := parseNumber(pt.Label.Value); err != nil {
+				return p.errorf("invalid %q label value %q", pointLabel, pt.Label.Value)
+			}
+		}
+	}
+
+	if err := validatePointValue(fam.Type, pt.Suffix, pt.Value); err != nil {
+		return p.errorf("%v", err)
+	}
+
+	return p.appendPoint(fam, labels, pt)
+}
+
+func validatePointValue(mt MetricType, sfx MetricSuffix, value float64) error {
+	switch {
+	case mt == StateSetType:
+		if value != 0 && value != 1 {
+			return fmt.Errorf("stateset value must be 0 or 1")
+		}
+	case mt == InfoType:
+		if value != 1 {
+			return fmt.Errorf("info value must be 1")
+		}
+	case sfx == SuffixTotal, sfx == SuffixBucket, sfx == SuffixCount, sfx == SuffixGCount:
+		if math.IsNaN(value) || value < 0 {
+			return fmt.Errorf("value must be non-negative, got %v", value)
+		}
+	}
+	return nil
+}
+
+func (p *parser) appendPoint(fam *parsedFamily, labels LabelSet, pt MetricPoint) error {
+	// empty label values are equivalent to absent labels
+	labels = slices.DeleteFunc(labels, func(l Label) bool { return l.Value == "" })
+	if len(labels) == 0 {
+		labels = nil
+	}
+
+	key := labelSetKey(labels)
+	pos, ok := fam.series[key]
+	if !ok || pos != fam.open {
+		// Prometheus permits scattered samples of untyped metrics
+		if ok && !p.prom {
+			return p.errorf("samples of a series must be contiguous")
+		}
+		if err := p.closeSeries(fam); err != nil {
+			return err
+		}
+	}
+	if !ok {
+		pos = len(fam.Series)
+		fam.series[key] = pos
+		fam.Series = append(fam.Series, SeriesSnapshot{Labels: labels})
+
+		for _, l := range labels {
+			if _, ok := fam.labelIdx[l.Name]; !ok {
+				fam.labelIdx[l.Name] = struct{}{}
+				fam.Desc.Labels = append(fam.Desc.Labels, l.Name)
+			}
+		}
+	}
+
+	s := &fam.Series[pos]
+	if slices.ContainsFunc(s.Points, func(x MetricPoint) bool { return x.Suffix == pt.Suffix && x.Label == pt.Label }) {
+		return p.errorf("duplicate sample")
+	}
+	if pt.Suffix == SuffixBucket {
+		// compare with the previous bucket
+		for i := len(s.Points) - 1; i >= 0; i-- {
+			if prev := s.Points[i]; prev.Suffix == SuffixBucket {
+				if parseLE(pt.Label.Value) <= parseLE(prev.Label.Value) {
+					return p.errorf("bucket \"le\" values must be increasing")
+				}
+				if pt.Value < prev.Value {
+					return p.errorf("bucket values must not decrease")
+				}
+				break
+			}
+		}
+	}
+	s.Points = append(s.Points, pt)
+	fam.open, fam.openLine = pos, p.line
+	return nil
+}
+
+// closeSeries validates the series which received the last sample of fam, once
+// it is complete.
+func (p *parser) closeSeries(fam *parsedFamily) error {
+	if fam == nil || fam.open < 0 {
+		return nil
+	}
+	s := fam.Series[fam.open]
+	fam.open = -1
+
+	if fam.Type != HistogramType && fam.Type != GaugeHistogramType {
+		return nil
+	}
+
+	var inf, count *MetricPoint
+	for i, pt := range s.Points {
+		switch {
+		case pt.Suffix == SuffixBucket && math.IsInf(parseLE(pt.Label.Value), 1):
+			inf = &s.Points[i]
+		case pt.Suffix == SuffixCount, pt.Suffix == SuffixGCount:
+			count = &s.Points[i]
+		}
+	}
+	if inf == nil {
+		return p.errorAt(fam.openLine, "missing +Inf bucket")
+	}
+	if count != nil && count.Value != inf.Value {
+		return p.errorAt(fam.openLine, "%s value must match the +Inf bucket", count.Suffix)
+	}
+	return nil
+}
+
+// parseLE parses a validated "le" label value.
+func parseLE(s string) float64 {
+	f, _ := parseNumber(s)
+	return f
+}
+
+func labelSetKey(labels LabelSet) string {
+	var sb strings.Builder
+	for _, l := range labels {
+		sb.WriteString(l.Name)
+		sb.WriteByte(0)
+		sb.WriteString(l.Value)
+		sb.WriteByte(0)
+	}
+	return sb.String()
+}
+
+func parseExemplar(s string) (*Exemplar, error) {
+	if !strings.HasPrefix(s, "{") {
+		return nil, fmt.Errorf("invalid exemplar")
+	}
+	labels, rest, err := parseLabels(s)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(rest, " ") {
+		return nil, fmt.Errorf("missing exemplar value")
+	}
+
+	fields := strings.Split(rest[1:], " ")
+	if len(fields) > 2 {
+		return nil, fmt.Errorf("invalid exemplar")
+	}
+	value, err := parseNumber(fields[0])
+	if err != nil {
+		return nil, fmt.Errorf("invalid exemplar value %q", fields[0])
+	}
+
+	x := &Exemplar{Value: value, Labels: labels}
+	if len(fields) == 2 {
+		ts, err := parseNumber(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid exemplar timestamp %q", fields[1])
+		}
+		x.Timestamp = fromEpoch(ts)
+	}
+	if err := x.Validate(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// parseLabels parses a label set, starting with "{".
+func parseLabels(s string) (LabelSet, string, error) {
+	var labels LabelSet
+
+	s = s[1:]
+	for {
+		if rest, ok := strings.CutPrefix(s, "}"); ok {
+			return labels, rest, nil
+		}
+		if len(labels) != 0 {
+			rest, ok := strings.CutPrefix(s, ",")
+			if !ok {
+				return nil, "", fmt.Errorf("invalid label set")
+			}
+			s = rest
+		}
+
+		name, rest, err := cutLabelName(s)
+		if err != nil {
+			return nil, "", err
+		}
+		for _, l := range labels {
+			if l.Name == name {
+				return nil, "", fmt.Errorf("duplicate label name %q", name)
+			}
+		}
+
+		end := closingQuote(rest)
+		if end < 0 {
+			return nil, "", fmt.Errorf("unterminated label value")
+		}
+		value, err := unescape(rest[:end], true)
+		if err != nil {
+			return nil, "", fmt.Errorf("invalid label value: %w", err)
+		}
+
+		labels = append(labels, Label{Name: name, Value: value})
+		s = rest[end+1:]
+	}
+}
+
+// cutMetricName cuts a metric name from the start of s. Plain names end at any
+// of the separator characters, quoted names at the closing quote.
+func cutMetricName(s, seps string) (string, string, error) {
+	if !strings.HasPrefix(s, "\"") {
+		n := strings.IndexAny(s, seps)
+		if n < 0 {
+			n = len(s)
+		}
+		if !isValidMetricName(s[:n]) {
+			return "", "", fmt.Errorf("invalid metric name %q", s[:n])
+		}
+		return s[:n], s[n:], nil
+	}
+
+	end := closingQuote(s[1:])
+	if end < 0 {
+		return "", "", fmt.Errorf("unterminated metric name")
+	}
+	name, err := unescape(s[1:end+1], true)
+	if err != nil || name == "" {
+		return "", "", fmt.Errorf("invalid metric name %q", s[:end+2])
+	}
+	return name, s[end+2:], nil
+}
+
+// cutLabelName cuts a plain or quoted label name and the opening quote of its
+// value from the start of s.
+func cutLabelName(s string) (string, string, error) {
+	if !strings.HasPrefix(s, "\"") {
+		name, rest, ok := strings.Cut(s, "=\"")
+		if !ok {
+			return "", "", fmt.Errorf("invalid label set")
+		}
+		if !isValidParsedLabelName(name) {
+			return "", "", fmt.Errorf("invalid label name %q", name)
+		}
+		return name, rest, nil
+	}
+
+	end := closingQuote(s[1:])
+	if end < 0 {
+		return "", "", fmt.Errorf("unterminated label name")
+	}
+	name, err := unescape(s[1:end+1], true)
+	if err != nil || name == "" {
+		return "", "", fmt.Errorf("invalid label name %q", s[:end+2])
+	}
+	rest, ok := strings.CutPrefix(s[end+2:], "=\"")
+	if !ok {
+		return "", "", fmt.Errorf("invalid label set")
+	}
+	return name, rest, nil
+}
+
+// closingQuote returns the position of the first unescaped double quote.
+func closingQuote(s string) int {
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			return i
+		}
+	}
+	return -1
+}
+
+func isValidParsedLabelName(s string) bool {
+	return isValidLabelName(s) || (strings.HasPrefix(s, "_") && (len(s) == 1 || isValidLabelName("a"+s[1:])))
+}
+
+// unescape reverts escaping of backslashes, newlines and optionally double
+// quotes.
+func unescape(s string, quotes bool) (string, error) {
+	if !utf8.ValidString(s) {
+		return "", fmt.Errorf("invalid UTF-8")
+	}
+	if !strings.Contains(s, "\\") {
+		return s, nil
+	}
+
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c != '\\' {
+			sb.WriteByte(c)
+			continue
+		}
+
+		i++
+		if i == len(s) {
+			return "", fmt.Errorf("invalid escape sequence")
+		}
+		switch s[i] {
+		case '\\':
+			sb.WriteByte('\\')
+		case 'n':
+			sb.WriteByte('\n')
+		case '"':
+			if !quotes {
+				return "", fmt.Errorf("invalid escape sequence")
+			}
+			sb.WriteByte('"')
+		default:
+			return "", fmt.Errorf("invalid escape sequence")
+		}
+	}
+	return sb.String(), nil
+}
+
+func parseNumber(s string) (float64, error) {
+	switch s {
+	case "+Inf":
+		return math.Inf(1), nil
+	case "-Inf":
+		return math.Inf(-1), nil
+	case "NaN":
+		return math.NaN(), nil
+	}
+
+	// reject alternative spellings, accepted by strconv
+	if s == "" || strings.ContainsAny(s, "_iInN") || strings.HasPrefix(s, "0x") || strings.HasPrefix(s, "-0x") {
+		return 0, strconv.ErrSyntax
+	}
+	return strconv.ParseFloat(s, 64)
+}
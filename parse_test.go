@@ -0,0 +1,302 @@
+package openmetrics_test
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/bsm/openmetrics"
+)
+
+func TestParse(t *testing.T) {
+	fams, err := Parse(strings.NewReader(`# TYPE http_requests counter
+# HELP http_requests Total \\ "requests"\n.
+http_requests_total{path="/",code="200"} 3 # {trace_id="abc"} 1 1515151515.5
+http_requests_created{path="/",code="200"} 1515151515.757576
+http_requests_total{path="/x",code=""} 0
+# TYPE latency_seconds histogram
+# UNIT latency_seconds seconds
+latency_seconds_bucket{le="0.1"} 1
+latency_seconds_bucket{le="+Inf"} 2
+latency_seconds_count 2
+latency_seconds_sum 1.05
+# TYPE mode stateset
+mode{mode="a"} 1
+mode{mode="b"} 0
+# TYPE build info
+build_info{version="1.2"} 1
+# TYPE rpc summary
+rpc{quantile="0.5",svc="a\"b"} NaN
+rpc_count{svc="a\"b"} 4 1515151515
+temp -1.5e3
+# EOF
+`))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if exp, got := []string{"http_requests", "latency", "mode", "build", "rpc", "temp"}, familyNames(fams); !reflect.DeepEqual(exp, got) {
+		t.Fatalf("expected %v, got %v", exp, got)
+	}
+
+	if exp, got := (Desc{Name: "http_requests", Help: "Total \\ \"requests\"\n.", Labels: []string{"path", "code"}}), fams[0].Desc; !reflect.DeepEqual(exp, got) {
+		t.Fatalf("expected %+v, got %+v", exp, got)
+	}
+	if exp, got := (FamilySnapshot{
+		Desc: Desc{Name: "latency", Unit: "seconds"},
+		Type: HistogramType,
+		Series: []SeriesSnapshot{{
+			Points: []MetricPoint{
+				{Suffix: SuffixBucket, Value: 1, Label: Label{Name: "le", Value: "0.1"}},
+				{Suffix: SuffixBucket, Value: 2, Label: Label{Name: "le", Value: "+Inf"}},
+				{Suffix: SuffixCount, Value: 2},
+				{Suffix: SuffixSum, Value: 1.05},
+			},
+		}},
+	}), fams[1]; !reflect.DeepEqual(exp, got) {
+		t.Fatalf("expected %+v, got %+v", exp, got)
+	}
+
+	counter := fams[0].Series
+	if exp, got := 2, len(counter); exp != got {
+		t.Fatalf("expected %v, got %v", exp, got)
+	}
+	if exp, got := Labels("path", "/x"), counter[1].Labels; !reflect.DeepEqual(exp, got) {
+		t.Fatalf("expected %v, got %v", exp, got)
+	}
+	if exp, got := (&Exemplar{Value: 1, Timestamp: time.Unix(1515151515, 5e8).UTC(), Labels: Labels("trace_id", "abc")}), counter[0].Points[0].Exemplar; !reflect.DeepEqual(exp, got) {
+		t.Fatalf("expected %+v, got %+v", exp, got)
+	}
+
+	if exp, got := (MetricPoint{Label: Label{Name: "mode", Value: "b"}}), fams[2].Series[0].Points[1]; !reflect.DeepEqual(exp, got) {
+		t.Fatalf("expected %+v, got %+v", exp, got)
+	}
+	if exp, got := (MetricPoint{Suffix: SuffixInfo, Value: 1}), fams[3].Series[0].Points[0]; !reflect.DeepEqual(exp, got) {
+		t.Fatalf("expected %+v, got %+v", exp, got)
+	}
+	if exp, got := Labels("svc", `a"b`), fams[4].Series[0].Labels; !reflect.DeepEqual(exp, got) {
+		t.Fatalf("expected %v, got %v", exp, got)
+	}
+	if got := fams[4].Series[0].Points[0]; !math.IsNaN(got.Value) || got.Label.Value != "0.5" {
+		t.Fatalf("expected NaN quantile, got %+v", got)
+	}
+	if exp, got := UnknownType, fams[5].Type; exp != got {
+		t.Fatalf("expected %v, got %v", exp, got)
+	}
+}
+
+func TestParse_roundTrip(t *testing.T) {
+	reg := NewConsistentRegistry(mockNow)
+	reg.OmitCreated = true // _created values are rounded to microseconds
+	reg.Counter(Desc{Name: "foo", Help: "Foo \"quoted\" \\ help.\nNext line.", Labels: []string{"a"}}).With("x").Add(2)
+	reg.Histogram(Desc{Name: "bar", Unit: "seconds"}, []float64{.1, 1}).With().Observe(.5)
+	reg.StateSet(Desc{Name: "baz"}, []string{"on", "off"}).With().Set("on", true)
+
+	var buf bytes.Buffer
+	if _, err := reg.WriteTo(&buf); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	got, err := Parse(&buf)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	exp, err := reg.Snapshot()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	for i := range exp {
+		if exp[i].Type == StateSetType {
+			exp[i].Desc.Labels = nil // stateset label is a point label
+		}
+	}
+	if !reflect.DeepEqual(exp, got) {
+		t.Fatalf("expected:\n%+v\ngot:\n%+v", exp, got)
+	}
+}
+
+func TestParse_quotedNames(t *testing.T) {
+	reg := NewConsistentRegistry(mockNow)
+	reg.OmitCreated = true
+	reg.UTF8Names = true
+	reg.Counter(Desc{Name: "http.requests", Help: "Requests.", Labels: []string{"http.method", "code"}}).With("GET", "200").Add(1)
+	reg.Gauge(Desc{Name: "temp", Labels: []string{"room \"a\""}}).With("x").Set(2)
+	reg.Gauge(Desc{Name: "up.time"}).With().Set(3)
+
+	var buf bytes.Buffer
+	if _, err := reg.WriteTo(&buf); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	got, err := Parse(&buf)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	exp, err := reg.Snapshot()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if !reflect.DeepEqual(exp, got) {
+		t.Fatalf("expected:\n%+v\ngot:\n%+v", exp, got)
+	}
+}
+
+func TestParsePrometheus(t *testing.T) {
+	fams, err := ParsePrometheus(strings.NewReader(`# HELP http_requests_total Total "requests"\n.
+# TYPE http_requests_total counter
+http_requests_total{path="/"} 3 1515151515000
+# some comment
+http_requests_total{path="/x"}	0
+
+# TYPE http_requests_created gauge
+http_requests_created{path="/"} 1.5151515e+09
+# TYPE errors counter
+errors 2
+# TYPE latency_seconds histogram
+latency_seconds_bucket{le="0.1"} 1
+latency_seconds_bucket{le="+Inf"} 2
+latency_seconds_count 2
+latency_seconds_sum 1.05
+up 1
+other 3
+up{job="x"} Inf`))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if exp, got := []string{"http_requests", "http_requests_created", "errors", "latency_seconds", "up", "other"}, familyNames(fams); !reflect.DeepEqual(exp, got) {
+		t.Fatalf("expected %v, got %v", exp, got)
+	}
+	if exp, got := (FamilySnapshot{
+		Desc: Desc{Name: "http_requests", Help: "Total \"requests\"\n.", Labels: []string{"path"}},
+		Type: CounterType,
+		Series: []SeriesSnapshot{
+			{Labels: Labels("path", "/"), Points: []MetricPoint{{Suffix: SuffixTotal, Value: 3}}},
+			{Labels: Labels("path", "/x"), Points: []MetricPoint{{Suffix: SuffixTotal, Value: 0}}},
+		},
+	}), fams[0]; !reflect.DeepEqual(exp, got) {
+		t.Fatalf("expected %+v, got %+v", exp, got)
+	}
+	if exp, got := []MetricPoint{{Suffix: SuffixTotal, Value: 2}}, fams[2].Series[0].Points; !reflect.DeepEqual(exp, got) {
+		t.Fatalf("expected %+v, got %+v", exp, got)
+	}
+	if exp, got := HistogramType, fams[3].Type; exp != got {
+		t.Fatalf("expected %v, got %v", exp, got)
+	}
+	if exp, got := UnknownType, fams[4].Type; exp != got {
+		t.Fatalf("expected %v, got %v", exp, got)
+	}
+	if exp, got := 2, len(fams[4].Series); exp != got {
+		t.Fatalf("expected %v, got %v", exp, got)
+	}
+
+	_, err = ParsePrometheus(strings.NewReader("# TYPE foo gauge\nfoo 1\nfoo 2\n"))
+	var perr *ParseError
+	if !errors.As(err, &perr) {
+		t.Fatalf("expected parse error, got %v", err)
+	} else if exp, got := `line 3: duplicate sample`, perr.Error(); exp != got {
+		t.Fatalf("expected %v, got %v", exp, got)
+	}
+
+	_, err = ParsePrometheus(strings.NewReader("# TYPE foo stateset\n"))
+	if !errors.As(err, &perr) {
+		t.Fatalf("expected parse error, got %v", err)
+	} else if exp, got := `line 1: invalid metric type "stateset"`, perr.Error(); exp != got {
+		t.Fatalf("expected %v, got %v", exp, got)
+	}
+}
+
+func TestParsePrometheus_roundTrip(t *testing.T) {
+	reg := NewConsistentRegistry(mockNow)
+	reg.OmitCreated = true
+	reg.Counter(Desc{Name: "foo", Help: "Foo \\ bar.", Labels: []string{"a"}}).With("x").Add(2)
+	reg.Histogram(Desc{Name: "bar"}, []float64{.1, 1}).With().Observe(.5)
+	reg.Summary(Desc{Name: "baz"}).With().Observe(3)
+
+	var buf bytes.Buffer
+	if _, err := reg.WritePrometheus(&buf, nil); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	got, err := ParsePrometheus(&buf)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	exp, err := reg.Snapshot()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if !reflect.DeepEqual(exp, got) {
+		t.Fatalf("expected:\n%+v\ngot:\n%+v", exp, got)
+	}
+}
+
+func TestParse_errors(t *testing.T) {
+	examples := []struct {
+		Doc  string
+		Line int
+		Msg  string
+	}{
+		{"foo 1\n", 2, "missing # EOF"},
+		{"foo 1\n# EOF", 2, "line must end with a newline"},
+		{"# EOF\nfoo 1\n", 2, "unexpected content after # EOF"},
+		{"foo\n# EOF\n", 1, "invalid sample"},
+		{"foo{a=\"b\"}\n# EOF\n", 1, "missing value"},
+		{"foo 1.x\n# EOF\n", 1, `invalid value "1.x"`},
+		{"foo Inf\n# EOF\n", 1, `invalid value "Inf"`},
+		{"foo 1 x\n# EOF\n", 1, `invalid timestamp "x"`},
+		{"foo{a=\"b\",a=\"c\"} 1\n# EOF\n", 1, `duplicate label name "a"`},
+		{"foo{a=\"b} 1\n# EOF\n", 1, "unterminated label value"},
+		{"foo{a=\"\\x\"} 1\n# EOF\n", 1, "invalid label value: invalid escape sequence"},
+		{"foo{1a=\"b\"} 1\n# EOF\n", 1, `invalid label name "1a"`},
+		{"# TYPE foo counter\nfoo 1\n# EOF\n", 2, `invalid sample name "foo" for counter family "foo"`},
+		{"# TYPE foo counter\nfoo_total -1\n# EOF\n", 2, "value must be non-negative, got -1"},
+		{"# TYPE foo foo\n# EOF\n", 1, `invalid metric type "foo"`},
+		{"# TYPE foo gauge\n# TYPE foo gauge\n# EOF\n", 2, `duplicate TYPE for "foo"`},
+		{"# TYPE foo_seconds gauge\n# UNIT foo_seconds bytes\n# EOF\n", 2, `metric name "foo_seconds" must end with unit "bytes"`},
+		{"foo 1\n# TYPE foo gauge\n# EOF\n", 2, `metadata for "foo" must precede its samples`},
+		{"foo 1\nbar 1\nfoo 2\n# EOF\n", 3, `metric family "foo" must not be interleaved`},
+		{"# TYPE foo histogram\nfoo_bucket 1\n# EOF\n", 2, `missing "le" label`},
+		{"# TYPE foo histogram\nfoo_bucket{le=\"x\"} 1\n# EOF\n", 2, `invalid "le" label value "x"`},
+		{"foo 1 # {a=\"b\"} 1\n# EOF\n", 1, "exemplars are only allowed on counters and buckets"},
+		{"# TYPE foo stateset\nfoo{foo=\"a\"} 2\n# EOF\n", 2, "stateset value must be 0 or 1"},
+		{"# FOO foo bar\n# EOF\n", 1, `invalid metadata keyword "FOO"`},
+		{"#TYPE foo gauge\n# EOF\n", 1, "invalid metadata line"},
+		{"# TYPE foo gauge\nfoo 1\nfoo 2\n# EOF\n", 3, "duplicate sample"},
+		{"foo{a=\"x\"} 1\nfoo{a=\"y\"} 1\nfoo{a=\"x\"} 1\n# EOF\n", 3, "samples of a series must be contiguous"},
+		{"# TYPE foo histogram\nfoo_bucket{le=\"1\"} 5\nfoo_bucket{le=\"+Inf\"} 3\n# EOF\n", 3, "bucket values must not decrease"},
+		{"# TYPE foo histogram\nfoo_bucket{le=\"2\"} 1\nfoo_bucket{le=\"1\"} 1\n# EOF\n", 3, `bucket "le" values must be increasing`},
+		{"# TYPE foo histogram\nfoo_bucket{le=\"1\"} 1\nfoo_count 1\n# EOF\n", 3, "missing +Inf bucket"},
+		{"# TYPE foo histogram\nfoo_bucket{le=\"1\"} 1\nfoo_bucket{le=\"+Inf\"} 2\nfoo_count 3\n# TYPE bar gauge\nbar 1\n# EOF\n", 4, "_count value must match the +Inf bucket"},
+		{"# TYPE foo gaugehistogram\nfoo_bucket{a=\"x\",le=\"+Inf\"} 2\nfoo_gcount{a=\"x\"} 1\nfoo_bucket{a=\"y\",le=\"+Inf\"} 1\n# EOF\n", 3, "_gcount value must match the +Inf bucket"},
+		{"# TYPE \"foo gauge\n# EOF\n", 1, "unterminated metric name"},
+		{"# TYPE \"foo\"gauge\n# EOF\n", 1, "invalid metadata line"},
+		{"{\"\"} 1\n# EOF\n", 1, `invalid metric name "\"\""`},
+		{"{\"foo\" 1\n# EOF\n", 1, "invalid sample"},
+		{"foo{\"a} 1\n# EOF\n", 1, "unterminated label name"},
+		{"foo{\"a\"} 1\n# EOF\n", 1, "invalid label set"},
+	}
+	for _, x := range examples {
+		_, err := Parse(strings.NewReader(x.Doc))
+
+		var perr *ParseError
+		if !errors.As(err, &perr) {
+			t.Fatalf("expected parse error, got %v (%q)", err, x.Doc)
+		}
+		if exp, got := (ParseError{Line: x.Line, Msg: x.Msg}), *perr; exp != got {
+			t.Errorf("expected %+v, got %+v (%q)", exp, got, x.Doc)
+		}
+	}
+}
+
+func familyNames(fams []FamilySnapshot) []string {
+	names := make([]string, 0, len(fams))
+	for _, f := range fams {
+		names = append(names, f.Desc.Name)
+	}
+	return names
+}
@@ -0,0 +1,111 @@
+package openmetrics
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// LabelPolicy sanitizes label values before they are used. It is called with
+// the label name and value and returns the value to use, or an error if the
+// value must be rejected. Policies must be idempotent, i.e. sanitizing an
+// already sanitized value must return it unchanged.
+type LabelPolicy func(name, value string) (string, error)
+
+// RejectInvalidLabelValues is the default LabelPolicy. It rejects values which
+// are not valid UTF-8.
+func RejectInvalidLabelValues(name, value string) (string, error) {
+	if !isValidLabelValue(value) {
+		return "", fmt.Errorf("label value %q of %q is invalid", value, name)
+	}
+	return value, nil
+}
+
+// ReplaceInvalidLabelValues is a LabelPolicy which replaces invalid UTF-8
+// byte sequences with the Unicode replacement character.
+func ReplaceInvalidLabelValues(_, value string) (string, error) {
+	return strings.ToValidUTF8(value, string(utf8.RuneError)), nil
+}
+
+// TruncateLabelValues returns a LabelPolicy which truncates values to at most
+// maxLen characters. Invalid UTF-8 byte sequences are replaced.
+func TruncateLabelValues(maxLen int) LabelPolicy {
+	return func(name, value string) (string, error) {
+		value, _ = ReplaceInvalidLabelValues(name, value)
+
+		n := 0
+		for i := range value {
+			if n == maxLen {
+				return value[:i], nil
+			}
+			n++
+		}
+		return value, nil
+	}
+}
+
+// MapLabelValues returns a LabelPolicy which maps values through fn, e.g. to
+// normalize case or to collapse IDs. Invalid UTF-8 byte sequences in mapped
+// values are rejected.
+func MapLabelValues(fn func(name, value string) string) LabelPolicy {
+	return func(name, value string) (string, error) {
+		return RejectInvalidLabelValues(name, fn(name, value))
+	}
+}
+
+// ChainLabelPolicies returns a LabelPolicy which applies policies in order.
+func ChainLabelPolicies(policies ...LabelPolicy) LabelPolicy {
+	return func(name, value string) (string, error) {
+		var err error
+		for _, policy := range policies {
+			if value, err = policy(name, value); err != nil {
+				return "", err
+			}
+		}
+		return value, nil
+	}
+}
+
+// sanitizeLabels applies a policy to a label set. The set is copied before
+// values are modified.
+func sanitizeLabels(set LabelSet, policy LabelPolicy) (LabelSet, error) {
+	var sanitized LabelSet
+	for i, l := range set {
+		if l.IsZero() {
+			continue
+		}
+
+		value, err := applyLabelPolicy(policy, l.Name, l.Value)
+		if err != nil {
+			return nil, err
+		}
+		if value != l.Value {
+			if sanitized == nil {
+				sanitized = make(LabelSet, len(set))
+				copy(sanitized, set)
+			}
+			sanitized[i].Value = value
+		}
+	}
+
+	if sanitized != nil {
+		return sanitized, nil
+	}
+	return set, nil
+}
+
+// applyLabelPolicy applies a policy, but ensures the result is always valid.
+func applyLabelPolicy(policy LabelPolicy, name, value string) (string, error) {
+	if policy == nil {
+		policy = RejectInvalidLabelValues
+	}
+
+	value, err := policy(name, value)
+	if err != nil {
+		return "", err
+	}
+	if !isValidLabelValue(value) {
+		return "", fmt.Errorf("label value %q of %q is invalid", value, name)
+	}
+	return value, nil
+}
@@ -0,0 +1,102 @@
+package openmetrics_test
+
+import (
+	"strings"
+	"testing"
+
+	. "github.com/bsm/openmetrics"
+)
+
+func TestLabelPolicy(t *testing.T) {
+	lower := MapLabelValues(func(_, value string) string { return strings.ToLower(value) })
+
+	examples := []struct {
+		Policy LabelPolicy
+		Value  string
+		Exp    string
+		Err    string
+	}{
+		{Policy: RejectInvalidLabelValues, Value: "ok", Exp: "ok"},
+		{Policy: RejectInvalidLabelValues, Value: "a\xffb", Err: `label value "a\xffb" of "foo" is invalid`},
+		{Policy: ReplaceInvalidLabelValues, Value: "a\xffb", Exp: "a�b"},
+		{Policy: TruncateLabelValues(3), Value: "abcdef", Exp: "abc"},
+		{Policy: TruncateLabelValues(3), Value: "äöüß", Exp: "äöü"},
+		{Policy: TruncateLabelValues(3), Value: "ab", Exp: "ab"},
+		{Policy: lower, Value: "GET", Exp: "get"},
+		{Policy: MapLabelValues(func(_, value string) string { return value + "\xff" }), Value: "a", Err: `label value "a\xff" of "foo" is invalid`},
+		{Policy: ChainLabelPolicies(lower, TruncateLabelValues(2)), Value: "POST", Exp: "po"},
+	}
+
+	for i, x := range examples {
+		got, err := x.Policy("foo", x.Value)
+		if x.Err != "" {
+			if err == nil || err.Error() != x.Err {
+				t.Errorf("[%d] expected error %q, got %v", i, x.Err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("[%d] expected no error, got %v", i, err)
+		} else if x.Exp != got {
+			t.Errorf("[%d] expected %q, got %q", i, x.Exp, got)
+		}
+	}
+}
+
+func TestRegistry_LabelPolicy(t *testing.T) {
+	var errs []error
+	reg := NewConsistentRegistry(mockNow)
+	reg.OmitCreated = true
+	reg.OnError = func(err error) { errs = append(errs, err) }
+	reg.LabelPolicy = ChainLabelPolicies(
+		MapLabelValues(func(name, value string) string {
+			if name == "method" {
+				return strings.ToUpper(value)
+			}
+			return value
+		}),
+		TruncateLabelValues(5),
+	)
+
+	foo := reg.Counter(Desc{Name: "foo", Labels: []string{"method"}})
+	foo.With("get").Add(1)
+	foo.With("GET").Add(1)
+	foo.With("post\xff").AddExemplar(&Exemplar{Value: 1, Labels: Labels("trace_id", "abcdefgh")})
+	reg.Info(Desc{Name: "build", Labels: []string{"version"}}).With("1.2.3-beta")
+
+	if exp, got := 2, foo.NumMetrics(); exp != got {
+		t.Fatalf("expected %v, got %v", exp, got)
+	}
+	if len(errs) != 0 {
+		t.Fatalf("expected no errors, got %v", errs)
+	}
+
+	checkOutput(t, reg, `
+		# TYPE foo counter
+		foo_total{method="GET"} 2
+		foo_total{method="POST�"} 1 # {trace_id="abcde"} 1
+		# TYPE build info
+		build_info{version="1.2.3"} 1
+		# EOF
+	`)
+}
+
+func TestRegistry_LabelPolicy_reject(t *testing.T) {
+	var errs []error
+	reg := NewConsistentRegistry(mockNow)
+	reg.OmitCreated = true
+	reg.OnError = func(err error) { errs = append(errs, err) }
+
+	foo := reg.Counter(Desc{Name: "foo", Labels: []string{"path"}})
+	foo.With("a\xffb").Add(1)
+	foo.With("ok").AddExemplar(&Exemplar{Value: 1, Labels: Labels("trace_id", "\xff")})
+
+	if exp, got := 2, len(errs); exp != got {
+		t.Fatalf("expected %v, got %v", exp, got)
+	}
+	checkOutput(t, reg, `
+		# TYPE foo counter
+		foo_total{path="ok"} 1
+		# EOF
+	`)
+}
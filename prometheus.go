@@ -0,0 +1,154 @@
+package openmetrics
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"time"
+)
+
+// PrometheusContentType is the content type of documents written by
+// WritePrometheus.
+const PrometheusContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// PrometheusOptions configure WritePrometheus.
+type PrometheusOptions struct {
+	// CreatedAsGauge exposes the _created points of counters, histograms and
+	// summaries as separate <name>_created gauge families. By default, they
+	// are omitted as the format has no notion of creation times.
+	CreatedAsGauge bool
+}
+
+// WritePrometheus writes snapshots of metric families in the Prometheus text
+// exposition format, version 0.0.4. Families are converted to their closest
+// equivalents: state sets and infos are exposed as gauges, gauge histograms as
+// histograms and unknowns as untyped. Units and exemplars are not supported
+// by the format and are omitted.
+func WritePrometheus(w io.Writer, fams []FamilySnapshot, opts *PrometheusOptions) (int64, error) {
+	if opts == nil {
+		opts = new(PrometheusOptions)
+	}
+
+	cw := &countingWriter{Writer: w}
+	pw := &promWriter{
+		bufferedWriter: bufferedWriter{Writer: bufio.NewWriter(cw)},
+		createdAsGauge: opts.CreatedAsGauge,
+	}
+	for i := range fams {
+		pw.writeFamily(&fams[i])
+	}
+
+	// write errors are sticky, it is sufficient to check the final flush
+	err := pw.Flush()
+	return cw.n, err
+}
+
+// WritePrometheus writes a snapshot of all registered metric families in the
+// Prometheus text exposition format. See WritePrometheus for details.
+func (r *Registry) WritePrometheus(w io.Writer, opts *PrometheusOptions) (int64, error) {
+	fams, err := r.Snapshot()
+	if err != nil {
+		return 0, err
+	}
+	return WritePrometheus(w, fams, opts)
+}
+
+type promWriter struct {
+	bufferedWriter
+	createdAsGauge bool
+	lns, lvs       []string
+}
+
+func (w *promWriter) writeFamily(fam *FamilySnapshot) {
+	if len(fam.Series) == 0 {
+		return
+	}
+
+	name := fam.Desc.FullName()
+	typeName, typ := name, "untyped"
+	switch fam.Type {
+	case CounterType:
+		typeName, typ = name+SuffixTotal.String(), "counter"
+	case GaugeType, StateSetType:
+		typ = "gauge"
+	case InfoType:
+		typeName, typ = name+SuffixInfo.String(), "gauge"
+	case HistogramType, GaugeHistogramType:
+		typ = "histogram"
+	case SummaryType:
+		typ = "summary"
+	}
+	w.writeMeta(typeName, typ, fam.Desc.Help)
+
+	hasCreated := false
+	for _, s := range fam.Series {
+		for _, pt := range s.Points {
+			switch pt.Suffix {
+			case SuffixCreated:
+				hasCreated = true
+				continue
+			case SuffixGCount:
+				pt.Suffix = SuffixCount
+			case SuffixGSum:
+				pt.Suffix = SuffixSum
+			}
+			w.writeSample(name+pt.Suffix.String(), s.Labels, pt.Label, pt.Value, false)
+		}
+	}
+
+	if !w.createdAsGauge || !hasCreated {
+		return
+	}
+
+	createdName := name + SuffixCreated.String()
+	w.writeMeta(createdName, "gauge", "")
+	for _, s := range fam.Series {
+		for _, pt := range s.Points {
+			if pt.Suffix == SuffixCreated {
+				w.writeSample(createdName, s.Labels, Label{}, pt.Value, true)
+			}
+		}
+	}
+}
+
+func (w *promWriter) writeMetricName(name string) (int, error) {
+	if isValidMetricName(name) {
+		return w.WriteString(name)
+	}
+	return w.writeQuotedName(name, "", "")
+}
+
+var promHelpEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+
+func (w *promWriter) writeMeta(name, typ, help string) {
+	if help != "" {
+		_, _ = w.WriteString("# HELP ")
+		_, _ = w.writeMetricName(name)
+		_ = w.WriteByte(' ')
+		_, _ = promHelpEscaper.WriteString(w, help)
+		_ = w.WriteByte('\n')
+	}
+
+	_, _ = w.WriteString("# TYPE ")
+	_, _ = w.writeMetricName(name)
+	_ = w.WriteByte(' ')
+	_, _ = w.WriteString(typ)
+	_ = w.WriteByte('\n')
+}
+
+func (w *promWriter) writeSample(name string, set LabelSet, extra Label, value float64, isEpoch bool) {
+	w.lns, w.lvs = w.lns[:0], w.lvs[:0]
+	for _, l := range set {
+		w.lns = append(w.lns, l.Name)
+		w.lvs = append(w.lvs, l.Value)
+	}
+
+	if isValidMetricName(name) {
+		_, _ = w.WriteString(name)
+		_, _ = w.writeLabels(w.lns, w.lvs, extra)
+	} else {
+		_, _ = w.writeQuotedSeries(name, "", "", w.lns, w.lvs, extra)
+	}
+	_, _ = w.writeValue(value, time.Time{}, isEpoch)
+	_ = w.WriteByte('\n')
+}
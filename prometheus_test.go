@@ -0,0 +1,81 @@
+package openmetrics_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	. "github.com/bsm/openmetrics"
+)
+
+func TestRegistry_WritePrometheus(t *testing.T) {
+	reg := NewConsistentRegistry(mockNow)
+	foo := reg.Counter(Desc{Name: "foo", Help: "Helpful\\\nline.", Labels: []string{"status"}})
+	foo.With("200").AddExemplar(&Exemplar{Value: 2, Timestamp: mockTime, Labels: Labels("trace_id", "abc")})
+	bar := reg.Histogram(Desc{Name: "bar", Unit: "seconds"}, []float64{.1})
+	bar.With().Observe(0.05)
+	reg.StateSet(Desc{Name: "qux"}, []string{"a", "b"}).With().Set("a", true)
+	reg.Info(Desc{Name: "build", Labels: []string{"version"}}).With("1.0")
+	reg.Unknown(Desc{Name: "baz"}).With().Set(3)
+	reg.Gauge(Desc{Name: "empty"})
+
+	var buf bytes.Buffer
+	if n, err := reg.WritePrometheus(&buf, nil); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	} else if exp, got := buf.Len(), int(n); exp != got {
+		t.Fatalf("expected %v, got %v", exp, got)
+	}
+
+	if exp, got := strings.Join([]string{
+		`# HELP foo_total Helpful\\\nline.`,
+		`# TYPE foo_total counter`,
+		`foo_total{status="200"} 2`,
+		`# TYPE bar_seconds histogram`,
+		`bar_seconds_bucket{le="0.1"} 1`,
+		`bar_seconds_bucket{le="+Inf"} 1`,
+		`bar_seconds_count 1`,
+		`bar_seconds_sum 0.05`,
+		`# TYPE qux gauge`,
+		`qux{qux="a"} 1`,
+		`qux{qux="b"} 0`,
+		`# TYPE build_info gauge`,
+		`build_info{version="1.0"} 1`,
+		`# TYPE baz untyped`,
+		`baz 3`,
+	}, "\n")+"\n", buf.String(); exp != got {
+		t.Fatalf("expected:\n%v\ngot:\n%v", exp, got)
+	}
+}
+
+func TestWritePrometheus_createdAsGauge(t *testing.T) {
+	reg := NewConsistentRegistry(mockNow)
+	reg.Counter(Desc{Name: "foo", Labels: []string{"status"}}).With("200").Add(1)
+
+	fams, err := reg.Snapshot()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	var buf bytes.Buffer
+	if _, err := WritePrometheus(&buf, fams, &PrometheusOptions{CreatedAsGauge: true}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if exp, got := strings.Join([]string{
+		`# TYPE foo_total counter`,
+		`foo_total{status="200"} 1`,
+		`# TYPE foo_created gauge`,
+		`foo_created{status="200"} 1515151515.757576`,
+	}, "\n")+"\n", buf.String(); exp != got {
+		t.Fatalf("expected:\n%v\ngot:\n%v", exp, got)
+	}
+
+	// created times are omitted along with the _created points
+	reg.OmitCreated = true
+	buf.Reset()
+	if _, err := reg.WritePrometheus(&buf, &PrometheusOptions{CreatedAsGauge: true}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if exp, got := "# TYPE foo_total counter\nfoo_total{status=\"200\"} 1\n", buf.String(); exp != got {
+		t.Fatalf("expected:\n%v\ngot:\n%v", exp, got)
+	}
+}
@@ -2,6 +2,7 @@ package openmetrics
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"io"
 	"sync"
@@ -23,12 +24,28 @@ var defaultRegisty = NewRegistry()
 type Registry struct {
 	// Custom error handler, defaults to WarnOnError.
 	OnError ErrorHandler
+	// OmitCreated suppresses _created points of all registered families.
+	// Creation times are still tracked internally.
+	OmitCreated bool
+	// UTF8Names permits metric and label names with arbitrary UTF-8
+	// characters, as proposed by newer OpenMetrics drafts. Such names are
+	// quoted in the exposition, which OpenMetrics 1.0 parsers (other than
+	// Parse) do not support. It must be set before families are registered.
+	UTF8Names bool
+	// LabelPolicy sanitizes label values of metrics, infos and exemplars.
+	// It must be set before families are registered and defaults to
+	// RejectInvalidLabelValues.
+	LabelPolicy LabelPolicy
 
 	fams []*metricFamily
 	snap snapshot
 	bw   bufferedWriter
 	now  func() time.Time
 	mu   sync.Mutex
+
+	collectors []Collector
+	csem       chan struct{}
+	cmu        sync.Mutex
 }
 
 // DefaultRegistry returns the default registry instance.
@@ -52,9 +69,16 @@ func NewConsistentRegistry(now func() time.Time) *Registry {
 	return reg
 }
 
+// Now returns the current time, as seen by the registry. It is used for the
+// created times of registered metrics and is useful to reset them
+// consistently.
+func (r *Registry) Now() time.Time {
+	return r.now()
+}
+
 // AddCounter registers a counter.
 func (r *Registry) AddCounter(desc Desc) (CounterFamily, error) {
-	if err := desc.Validate(); err != nil {
+	if err := desc.validate(r.UTF8Names); err != nil {
 		return nil, err
 	}
 
@@ -62,9 +86,10 @@ func (r *Registry) AddCounter(desc Desc) (CounterFamily, error) {
 		desc: desc,
 		mt:   CounterType,
 		factory: func() (Metric, error) {
-			return NewCounter(CounterOptions{CreatedAt: r.now(), OnError: r.onError()}), nil
+			return NewCounter(CounterOptions{CreatedAt: r.now(), OnError: r.onError(), LabelPolicy: r.LabelPolicy}), nil
 		},
 		onError: r.onError(),
+		policy:  r.LabelPolicy,
 	}}
 	if err := r.register(&fam.metricFamily); err != nil {
 		return nil, err
@@ -84,7 +109,7 @@ func (r *Registry) Counter(desc Desc) CounterFamily {
 
 // AddGauge registers a gauge.
 func (r *Registry) AddGauge(desc Desc) (GaugeFamily, error) {
-	if err := desc.Validate(); err != nil {
+	if err := desc.validate(r.UTF8Names); err != nil {
 		return nil, err
 	}
 
@@ -93,6 +118,7 @@ func (r *Registry) AddGauge(desc Desc) (GaugeFamily, error) {
 		mt:      GaugeType,
 		factory: func() (Metric, error) { return NewGauge(GaugeOptions{}), nil },
 		onError: r.onError(),
+		policy:  r.LabelPolicy,
 	}}
 	if err := r.register(&fam.metricFamily); err != nil {
 		return nil, err
@@ -118,7 +144,7 @@ func (r *Registry) Gauge(desc Desc) GaugeFamily {
 // When len(bounds) is 0 the histogram will be created with a single bucket with
 // an +Inf threshold.
 func (r *Registry) AddHistogram(desc Desc, bounds []float64) (HistogramFamily, error) {
-	if err := desc.Validate(); err != nil {
+	if err := desc.validate(r.UTF8Names); err != nil {
 		return nil, err
 	}
 
@@ -131,9 +157,10 @@ func (r *Registry) AddHistogram(desc Desc, bounds []float64) (HistogramFamily, e
 		desc: desc,
 		mt:   HistogramType,
 		factory: func() (Metric, error) {
-			return NewHistogram(bounds, HistogramOptions{CreatedAt: r.now(), OnError: r.onError()})
+			return NewHistogram(bounds, HistogramOptions{CreatedAt: r.now(), OnError: r.onError(), LabelPolicy: r.LabelPolicy})
 		},
 		onError: r.onError(),
+		policy:  r.LabelPolicy,
 	}}
 	if err := r.register(&fam.metricFamily); err != nil {
 		return nil, err
@@ -159,7 +186,7 @@ func (r *Registry) Histogram(desc Desc, bounds []float64) HistogramFamily {
 
 // AddInfo registers an info.
 func (r *Registry) AddInfo(desc Desc) (InfoFamily, error) {
-	if err := desc.Validate(); err != nil {
+	if err := desc.validate(r.UTF8Names); err != nil {
 		return nil, err
 	}
 
@@ -168,6 +195,7 @@ func (r *Registry) AddInfo(desc Desc) (InfoFamily, error) {
 		mt:      InfoType,
 		factory: func() (Metric, error) { return NewInfo(InfoOptions{}), nil },
 		onError: r.onError(),
+		policy:  r.LabelPolicy,
 	}}
 	if err := r.register(&fam.metricFamily); err != nil {
 		return nil, err
@@ -187,7 +215,7 @@ func (r *Registry) Info(desc Desc) InfoFamily {
 
 // AddStateSet registers a state set.
 func (r *Registry) AddStateSet(desc Desc, names []string) (StateSetFamily, error) {
-	if err := desc.Validate(); err != nil {
+	if err := desc.validate(r.UTF8Names); err != nil {
 		return nil, err
 	}
 
@@ -198,6 +226,7 @@ func (r *Registry) AddStateSet(desc Desc, names []string) (StateSetFamily, error
 			return NewStateSet(names, StateSetOptions{OnError: r.onError()}), nil
 		},
 		onError: r.onError(),
+		policy:  r.LabelPolicy,
 	}}
 	if err := r.register(&fam.metricFamily); err != nil {
 		return nil, err
@@ -217,7 +246,7 @@ func (r *Registry) StateSet(desc Desc, names []string) StateSetFamily {
 
 // AddSummary registers a summary.
 func (r *Registry) AddSummary(desc Desc) (SummaryFamily, error) {
-	if err := desc.Validate(); err != nil {
+	if err := desc.validate(r.UTF8Names); err != nil {
 		return nil, err
 	}
 
@@ -228,6 +257,7 @@ func (r *Registry) AddSummary(desc Desc) (SummaryFamily, error) {
 			return NewSummary(SummaryOptions{CreatedAt: r.now(), OnError: r.onError()})
 		},
 		onError: r.onError(),
+		policy:  r.LabelPolicy,
 	}}
 	if err := r.register(&fam.metricFamily); err != nil {
 		return nil, err
@@ -247,7 +277,7 @@ func (r *Registry) Summary(desc Desc) SummaryFamily {
 
 // AddUnknown registers an unknown.
 func (r *Registry) AddUnknown(desc Desc) (GaugeFamily, error) {
-	if err := desc.Validate(); err != nil {
+	if err := desc.validate(r.UTF8Names); err != nil {
 		return nil, err
 	}
 
@@ -256,6 +286,7 @@ func (r *Registry) AddUnknown(desc Desc) (GaugeFamily, error) {
 		mt:      UnknownType,
 		factory: func() (Metric, error) { return NewGauge(GaugeOptions{}), nil },
 		onError: r.onError(),
+		policy:  r.LabelPolicy,
 	}}
 	if err := r.register(&fam.metricFamily); err != nil {
 		return nil, err
@@ -275,8 +306,18 @@ func (r *Registry) Unknown(desc Desc) GaugeFamily {
 
 // WriteTo implements io.WriterTo interface.
 func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	return r.WriteToContext(context.Background(), w)
+}
+
+// WriteToContext writes all registered metric families to w, just like
+// WriteTo. It stops and returns the context error if ctx is cancelled before
+// all families have been written, in which case the output is incomplete and
+// lacks the terminating "# EOF" line.
+func (r *Registry) WriteToContext(ctx context.Context, w io.Writer) (int64, error) {
 	var total int64
 
+	r.collect(ctx)
+
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
@@ -285,8 +326,13 @@ func (r *Registry) WriteTo(w io.Writer) (int64, error) {
 	} else {
 		r.bw.Reset(w)
 	}
+	r.snap.omitCreated = r.OmitCreated
 
 	for _, fam := range r.fams {
+		if err := ctx.Err(); err != nil {
+			return total, err
+		}
+
 		err := fam.snapshot(&r.snap)
 		if err != nil {
 			return total, err
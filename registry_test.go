@@ -2,6 +2,8 @@ package openmetrics_test
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"math"
 	"math/rand"
@@ -210,6 +212,218 @@ func TestRegistry_Summary(t *testing.T) {
 		# EOF
 	`)
 }
+
+func TestRegistry_OmitCreated(t *testing.T) {
+	reg := NewConsistentRegistry(mockNow)
+	foo := reg.Counter(Desc{Name: "foo", OmitCreated: true})
+	foo.With().Add(1)
+	bar := reg.Summary(Desc{Name: "bar"})
+	bar.With().Observe(2)
+
+	checkOutput(t, reg, `
+		# TYPE foo counter
+		foo_total 1
+		# TYPE bar summary
+		bar_count 1
+		bar_sum 2
+		bar_created 1515151515.757576
+		# EOF
+	`)
+
+	reg.OmitCreated = true
+	checkOutput(t, reg, `
+		# TYPE foo counter
+		foo_total 1
+		# TYPE bar summary
+		bar_count 1
+		bar_sum 2
+		# EOF
+	`)
+
+	if exp, got := mockTime, foo.With().Created(); exp != got {
+		t.Fatalf("expected %v, got %v", exp, got)
+	}
+}
+
+func TestRegistry_UTF8Names(t *testing.T) {
+	reg := NewConsistentRegistry(mockNow)
+	reg.OmitCreated = true
+	if _, err := reg.AddCounter(Desc{Name: "http.requests"}); err == nil {
+		t.Fatal("expected error")
+	}
+
+	reg.UTF8Names = true
+	foo := reg.Counter(Desc{Name: "http.requests", Help: "Requests.", Labels: []string{"http.method", "code"}})
+	foo.With("GET", "200").Add(1)
+	bar := reg.Gauge(Desc{Name: "bar", Unit: "bytes"})
+	bar.With().Set(2)
+	baz := reg.StateSet(Desc{Name: "baz.state"}, []string{"on", "off"})
+	baz.With().Set("on", true)
+
+	checkOutput(t, reg, `
+		# TYPE "http.requests" counter
+		# HELP "http.requests" Requests.
+		{"http.requests_total","http.method"="GET",code="200"} 1
+		# TYPE bar_bytes gauge
+		# UNIT bar_bytes bytes
+		bar_bytes 2
+		# TYPE "baz.state" stateset
+		{"baz.state","baz.state"="on"} 1
+		{"baz.state","baz.state"="off"} 0
+		# EOF
+	`)
+}
+
+func TestRegistry_AddCollector(t *testing.T) {
+	acc := new(errorCollector)
+	reg := NewConsistentRegistry(mockNow)
+	reg.OnError = acc.OnError
+
+	var calls GaugeFamily
+	reg.AddCollector(CollectorFunc(func(_ context.Context, reg *Registry) error {
+		if calls == nil {
+			calls = reg.Gauge(Desc{Name: "calls"})
+		}
+		calls.With().Add(1)
+		return nil
+	}))
+	reg.AddCollector(CollectorFunc(func(context.Context, *Registry) error {
+		return errors.New("failed")
+	}))
+
+	checkOutput(t, reg, `
+		# TYPE calls gauge
+		calls 1
+		# EOF
+	`)
+	if exp, got := 1, len(acc.errs); exp != got {
+		t.Fatalf("expected %v, got %v", exp, got)
+	}
+
+	fams, err := reg.Snapshot()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if exp, got := 2.0, fams[0].Series[0].Points[0].Value; exp != got {
+		t.Fatalf("expected %v, got %v", exp, got)
+	}
+
+	// collectors are skipped when the context is cancelled
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := reg.SnapshotContext(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context error, got %v", err)
+	}
+	if exp, got := 2.0, calls.With().Value(); exp != got {
+		t.Fatalf("expected %v, got %v", exp, got)
+	}
+}
+
+func TestRegistry_AddCollector_slow(t *testing.T) {
+	reg := NewConsistentRegistry(mockNow)
+	reg.Gauge(Desc{Name: "temp"})
+
+	started, release := make(chan struct{}), make(chan struct{})
+	reg.AddCollector(CollectorFunc(func(context.Context, *Registry) error {
+		select {
+		case started <- struct{}{}:
+			<-release
+		default:
+		}
+		return nil
+	}))
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := reg.Snapshot()
+		done <- err
+	}()
+	<-started
+
+	// a concurrent scrape gives up waiting for the slow collector
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := reg.SnapshotContext(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected context error, got %v", err)
+	}
+
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+}
+
+func TestRegistry_Snapshot(t *testing.T) {
+	reg := NewConsistentRegistry(mockNow)
+	reg.OmitCreated = true
+	foo := reg.Counter(Desc{Name: "foo", Labels: []string{"a", "b"}})
+	foo.With("x", "").Add(1)
+	foo.With("", "y").AddExemplar(&Exemplar{Value: 2, Labels: Labels("trace_id", "abc")})
+	reg.Gauge(Desc{Name: "bar"})
+
+	got, err := reg.Snapshot()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	exp := []FamilySnapshot{
+		{
+			Desc: Desc{Name: "foo", Labels: []string{"a", "b"}},
+			Type: CounterType,
+			Series: []SeriesSnapshot{
+				{
+					Labels: Labels("a", "x"),
+					Points: []MetricPoint{{Suffix: SuffixTotal, Value: 1}},
+				},
+				{
+					Labels: Labels("b", "y"),
+					Points: []MetricPoint{{Suffix: SuffixTotal, Value: 2, Exemplar: &Exemplar{Value: 2, Labels: Labels("trace_id", "abc")}}},
+				},
+			},
+		},
+		{Desc: Desc{Name: "bar"}, Type: GaugeType, Series: []SeriesSnapshot{}},
+	}
+	if !reflect.DeepEqual(exp, got) {
+		t.Fatalf("expected:\n\t%+v, got:\n\t%+v", exp, got)
+	}
+
+	// exemplars must be copied
+	foo.With("", "y").AddExemplar(&Exemplar{Value: 3})
+	if exp, got := 2.0, got[0].Series[1].Points[0].Exemplar.Value; exp != got {
+		t.Fatalf("expected %v, got %v", exp, got)
+	}
+}
+
+func TestWriteText(t *testing.T) {
+	reg := NewConsistentRegistry(mockNow)
+	foo := reg.Counter(Desc{Name: "foo", Help: "Foo \"bar\".", Labels: []string{"a", "b"}})
+	foo.With("x", "").Add(1)
+	foo.With("", "y").AddExemplar(&Exemplar{Value: 2, Timestamp: mockTime, Labels: Labels("trace_id", "abc")})
+	reg.Histogram(Desc{Name: "bar", Unit: "seconds"}, []float64{.1}).With().Observe(.05)
+	reg.StateSet(Desc{Name: "baz"}, []string{"on", "off"}).With().Set("on", true)
+	reg.Gauge(Desc{Name: "qux"})
+
+	var exp bytes.Buffer
+	if _, err := reg.WriteTo(&exp); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	fams, err := reg.Snapshot()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	var got bytes.Buffer
+	if n, err := WriteText(&got, fams); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	} else if exp, got := got.Len(), int(n); exp != got {
+		t.Fatalf("expected %v, got %v", exp, got)
+	}
+
+	if exp, got := exp.String(), got.String(); exp != got {
+		t.Fatalf("expected:\n%v\ngot:\n%v", exp, got)
+	}
+}
+
 func TestRegistry_Unknowns(t *testing.T) {
 	reg := NewConsistentRegistry(mockNow)
 	foo := reg.Unknown(Desc{Name: "foo"})
@@ -222,6 +436,39 @@ func TestRegistry_Unknowns(t *testing.T) {
 	`)
 }
 
+func TestRegistry_WriteToContext(t *testing.T) {
+	reg := NewConsistentRegistry(mockNow)
+	reg.Gauge(Desc{Name: "foo"}).With().Set(1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	var buf bytes.Buffer
+	if _, err := reg.WriteToContext(ctx, &buf); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected %v, got %v", context.Canceled, err)
+	}
+	if _, err := reg.SnapshotContext(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected %v, got %v", context.Canceled, err)
+	}
+
+	buf.Reset()
+	if _, err := reg.WriteToContext(context.Background(), &buf); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if exp, got := "# TYPE foo gauge\nfoo 1\n# EOF\n", buf.String(); exp != got {
+		t.Fatalf("expected %q, got %q", exp, got)
+	}
+}
+
+func TestRegistry_Now(t *testing.T) {
+	if exp, got := mockTime, NewConsistentRegistry(mockNow).Now(); !exp.Equal(got) {
+		t.Fatalf("expected %v, got %v", exp, got)
+	}
+	if got := NewRegistry().Now(); time.Since(got) > time.Minute {
+		t.Fatalf("expected current time, got %v", got)
+	}
+}
+
 func BenchmarkRegistry_WriteTo(b *testing.B) {
 	reg := NewRegistry()
 	for i := 0; i < 10_000; i++ {
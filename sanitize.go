@@ -0,0 +1,73 @@
+package openmetrics
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// SanitizeMetricName turns an arbitrary string into a valid metric name, e.g.
+// to bridge names from foreign systems. Valid names are returned unchanged,
+// unless they begin with "U__". All others are escaped in a collision-safe
+// manner: the result is prefixed with "U__", underscores are doubled and all
+// other invalid characters are replaced by their hex code point, enclosed in
+// underscores. For example, "http.requests" becomes "U__http_2e_requests".
+// Bytes which are not valid UTF-8 are replaced by their hex value, prefixed
+// with an "x", e.g. "\xff" becomes "U___xff_".
+//
+// Empty strings are returned as is.
+func SanitizeMetricName(s string) string {
+	return sanitizeName(s, isValidMetricName, isValidMetricNameRune)
+}
+
+// SanitizeLabelName turns an arbitrary string into a valid label name. It uses
+// the same escaping scheme as SanitizeMetricName.
+func SanitizeLabelName(s string) string {
+	return sanitizeName(s, isValidLabelName, isValidLabelNameRune)
+}
+
+// SanitizeUnit turns an arbitrary string into a valid unit. It uses the same
+// escaping scheme as SanitizeMetricName.
+func SanitizeUnit(s string) string {
+	return sanitizeName(s, isValidMetricUnit, func(r rune, _ int) bool {
+		return isAlpha(r) || isDigit(r) || r == ':'
+	})
+}
+
+func sanitizeName(s string, valid func(string) bool, validRune func(r rune, pos int) bool) string {
+	if s == "" || (valid(s) && !strings.HasPrefix(s, "U__")) {
+		return s
+	}
+
+	var b strings.Builder
+	b.Grow(len(s) + 8)
+	b.WriteString("U__")
+
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		switch {
+		case r == utf8.RuneError && size == 1:
+			b.WriteString("_x")
+			b.WriteString(strconv.FormatInt(int64(s[i]), 16))
+			b.WriteByte('_')
+		case r == '_':
+			b.WriteString("__")
+		case validRune(r, i):
+			b.WriteRune(r)
+		default:
+			b.WriteByte('_')
+			b.WriteString(strconv.FormatInt(int64(r), 16))
+			b.WriteByte('_')
+		}
+		i += size
+	}
+	return b.String()
+}
+
+func isValidMetricNameRune(r rune, pos int) bool {
+	return isAlpha(r) || r == ':' || (pos > 0 && isDigit(r))
+}
+
+func isValidLabelNameRune(r rune, pos int) bool {
+	return isAlpha(r) || (pos > 0 && isDigit(r))
+}
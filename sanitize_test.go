@@ -0,0 +1,64 @@
+package openmetrics_test
+
+import (
+	"testing"
+
+	. "github.com/bsm/openmetrics"
+)
+
+func TestSanitizeMetricName(t *testing.T) {
+	examples := []struct{ In, Exp string }{
+		{"", ""},
+		{"http_requests", "http_requests"},
+		{"node:cpu", "node:cpu"},
+		{"http.requests", "U__http_2e_requests"},
+		{"http_requests.total", "U__http__requests_2e_total"},
+		{"2xx", "U___32_xx"},
+		{"größe", "U__gr_f6__df_e"},
+		{"a\xffb", "U__a_xff_b"},
+		{"a\uFFFDb", "U__a_fffd_b"},
+		{"U__foo", "U__U____foo"},
+	}
+	for _, x := range examples {
+		if got := SanitizeMetricName(x.In); x.Exp != got {
+			t.Errorf("expected %q to become %q, got %q", x.In, x.Exp, got)
+		}
+	}
+
+	// escaped names do not collide
+	if a, b := SanitizeMetricName("a.b"), SanitizeMetricName("a_2e_b"); a == b {
+		t.Errorf("expected %q != %q", a, b)
+	}
+	if a, b := SanitizeMetricName("\xff"), SanitizeMetricName("\uFFFD"); a == b {
+		t.Errorf("expected %q != %q", a, b)
+	}
+}
+
+func TestSanitizeLabelName(t *testing.T) {
+	examples := []struct{ In, Exp string }{
+		{"", ""},
+		{"method", "method"},
+		{"k8s.pod", "U__k8s_2e_pod"},
+		{"node:name", "U__node_3a_name"},
+		{"_private", "U____private"},
+	}
+	for _, x := range examples {
+		if got := SanitizeLabelName(x.In); x.Exp != got {
+			t.Errorf("expected %q to become %q, got %q", x.In, x.Exp, got)
+		}
+	}
+}
+
+func TestSanitizeUnit(t *testing.T) {
+	examples := []struct{ In, Exp string }{
+		{"", ""},
+		{"seconds", "seconds"},
+		{"1_000", "1_000"},
+		{"m/s", "U__m_2f_s"},
+	}
+	for _, x := range examples {
+		if got := SanitizeUnit(x.In); x.Exp != got {
+			t.Errorf("expected %q to become %q, got %q", x.In, x.Exp, got)
+		}
+	}
+}
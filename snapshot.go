@@ -1,5 +1,11 @@
 package openmetrics
 
+import (
+	"bufio"
+	"context"
+	"io"
+)
+
 type snapshot struct {
 	desc Desc
 	mt   MetricType
@@ -7,6 +13,8 @@ type snapshot struct {
 	lvs  [][]string
 	off  []int
 	cos  uint64Slice
+
+	omitCreated bool
 }
 
 func (s *snapshot) Reset(desc Desc, mt MetricType) {
@@ -17,6 +25,8 @@ func (s *snapshot) Reset(desc Desc, mt MetricType) {
 		lvs:  s.lvs[:0],
 		off:  s.off[:0],
 		cos:  s.cos[:0],
+
+		omitCreated: s.omitCreated,
 	}
 }
 
@@ -24,7 +34,13 @@ func (s *snapshot) Append(m *metricWithLabels) (err error) {
 	// append points, exit early if none collected
 	origSize := len(s.pts)
 	s.pts, err = m.met.AppendPoints(s.pts, &s.desc)
-	if err != nil || len(s.pts) == origSize {
+	if err != nil {
+		return
+	}
+	if s.omitCreated || s.desc.OmitCreated {
+		s.pts = omitCreatedPoints(s.pts, origSize)
+	}
+	if len(s.pts) == origSize {
 		return
 	}
 
@@ -60,3 +76,126 @@ func (s *snapshot) WriteTo(bw *bufferedWriter) (total int64, err error) {
 
 	return
 }
+
+// omitCreatedPoints removes all _created points from pts[offset:].
+func omitCreatedPoints(pts []MetricPoint, offset int) []MetricPoint {
+	n := offset
+	for _, pt := range pts[offset:] {
+		if pt.Suffix != SuffixCreated {
+			pts[n] = pt
+			n++
+		}
+	}
+	return pts[:n]
+}
+
+// ----------------------------------------------------------------------------
+
+// FamilySnapshot is a point-in-time copy of a metric family.
+type FamilySnapshot struct {
+	Desc   Desc
+	Type   MetricType
+	Series []SeriesSnapshot
+}
+
+// SeriesSnapshot is a point-in-time copy of a single metric within a family.
+type SeriesSnapshot struct {
+	// Labels contains the non-empty labels of the metric.
+	Labels LabelSet
+	// Points contains the collected points.
+	Points []MetricPoint
+}
+
+// Snapshot returns a point-in-time copy of all registered metric families,
+// including families without any metrics.
+func (r *Registry) Snapshot() ([]FamilySnapshot, error) {
+	return r.SnapshotContext(context.Background())
+}
+
+// SnapshotContext is like Snapshot but stops and returns the context error if
+// ctx is cancelled before all families have been collected.
+func (r *Registry) SnapshotContext(ctx context.Context) ([]FamilySnapshot, error) {
+	r.collect(ctx)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.snap.omitCreated = r.OmitCreated
+
+	fams := make([]FamilySnapshot, 0, len(r.fams))
+	for _, fam := range r.fams {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if err := fam.snapshot(&r.snap); err != nil {
+			return nil, err
+		}
+		fams = append(fams, r.snap.Export())
+	}
+	return fams, nil
+}
+
+// Export exports a copy of the snapshot.
+func (s *snapshot) Export() FamilySnapshot {
+	fs := FamilySnapshot{
+		Desc:   s.desc,
+		Type:   s.mt,
+		Series: make([]SeriesSnapshot, 0, len(s.off)),
+	}
+
+	off := 0
+	for i, max := range s.off {
+		var labels LabelSet
+		for j, name := range s.desc.Labels {
+			if lv := s.lvs[i][j]; lv != "" {
+				labels = labels.Append(name, lv)
+			}
+		}
+
+		pts := make([]MetricPoint, max-off)
+		copy(pts, s.pts[off:max])
+		for j := range pts {
+			if x := pts[j].Exemplar; x != nil {
+				pts[j].Exemplar = new(Exemplar)
+				pts[j].Exemplar.copyFrom(x)
+			}
+		}
+		off = max
+
+		fs.Series = append(fs.Series, SeriesSnapshot{Labels: labels, Points: pts})
+	}
+	return fs
+}
+
+// WriteText writes snapshots of metric families as an OpenMetrics text
+// document, including the terminating "# EOF" line. Just like with
+// Registry.WriteTo, families without any series are omitted.
+func WriteText(w io.Writer, fams []FamilySnapshot) (int64, error) {
+	cw := &countingWriter{Writer: w}
+	bw := &bufferedWriter{Writer: bufio.NewWriter(cw)}
+
+	var lns, lvs []string
+	for i := range fams {
+		fam := &fams[i]
+		if len(fam.Series) == 0 {
+			continue
+		}
+
+		_, _ = fam.Desc.writeTo(bw, fam.Type)
+		for _, s := range fam.Series {
+			lns, lvs = lns[:0], lvs[:0]
+			for _, l := range s.Labels {
+				lns = append(lns, l.Name)
+				lvs = append(lvs, l.Value)
+			}
+			for j := range s.Points {
+				_, _ = bw.WritePoint(fam.Desc.Name, fam.Desc.Unit, lns, lvs, &s.Points[j])
+			}
+		}
+	}
+	_, _ = bw.WriteString("# EOF\n")
+
+	// write errors are sticky, it is sufficient to check the final flush
+	err := bw.Flush()
+	return cw.n, err
+}
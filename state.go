@@ -0,0 +1,276 @@
+package openmetrics
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const stateVersion = 1
+
+var errStateVersion = fmt.Errorf("unsupported state version")
+
+type registryState struct {
+	Version  int           `json:"version"`
+	Families []familyState `json:"families"`
+}
+
+type familyState struct {
+	ID     uint64        `json:"id"`
+	Name   string        `json:"name"`
+	Unit   string        `json:"unit,omitempty"`
+	Type   string        `json:"type"`
+	Series []seriesState `json:"series"`
+}
+
+type seriesState struct {
+	Labels  []string  `json:"labels,omitempty"`
+	Created int64     `json:"created"`
+	Total   float64   `json:"total,omitempty"`
+	Count   int64     `json:"count,omitempty"`
+	Sum     float64   `json:"sum,omitempty"`
+	Bounds  []float64 `json:"bounds,omitempty"`
+	Buckets []int64   `json:"buckets,omitempty"`
+}
+
+// persistentMetric is implemented by metrics which can be persisted.
+type persistentMetric interface {
+	saveState(*seriesState)
+	restoreState(*seriesState) error
+}
+
+// SaveState writes the current state of all registered counters, histograms
+// and summaries to w. The state can be restored into a registry with matching
+// families using RestoreState.
+func (r *Registry) SaveState(w io.Writer) error {
+	state := registryState{Version: stateVersion}
+	for _, fam := range r.families() {
+		if st, ok := fam.saveState(); ok {
+			state.Families = append(state.Families, st)
+		}
+	}
+
+	return json.NewEncoder(w).Encode(&state)
+}
+
+// RestoreState reads a state previously written by SaveState and restores it
+// into the registered families. Families are matched by name, unit and type,
+// metrics by their label values. Saved families which are not registered are
+// skipped. An error is returned if the state cannot be decoded or if saved
+// metrics are incompatible with registered ones, e.g. when histogram bucket
+// bounds have changed. Compatible metrics are restored regardless.
+func (r *Registry) RestoreState(rd io.Reader) error {
+	var state registryState
+	if err := json.NewDecoder(rd).Decode(&state); err != nil {
+		return err
+	}
+	if state.Version != stateVersion {
+		return fmt.Errorf("%w %d", errStateVersion, state.Version)
+	}
+
+	registered := r.families()
+	fams := make(map[uint64]*metricFamily, len(registered))
+	for _, fam := range registered {
+		fams[fam.ID()] = fam
+	}
+
+	var errs []error
+	for i := range state.Families {
+		st := &state.Families[i]
+		fam, ok := fams[st.ID]
+		if !ok {
+			continue
+		}
+		if err := fam.restoreState(st); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// SaveStateFile atomically writes the state of the registry to a file.
+func (r *Registry) SaveStateFile(name string) error {
+	tmp, err := os.CreateTemp(filepath.Dir(name), filepath.Base(name)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+
+	if err := r.SaveState(tmp); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), name)
+}
+
+// RestoreStateFile restores the state of the registry from a file written by
+// SaveStateFile. It is not an error if the file does not exist.
+func (r *Registry) RestoreStateFile(name string) error {
+	f, err := os.Open(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return r.RestoreState(f)
+}
+
+func (r *Registry) families() []*metricFamily {
+	r.mu.Lock()
+	fams := make([]*metricFamily, len(r.fams))
+	copy(fams, r.fams)
+	r.mu.Unlock()
+	return fams
+}
+
+// ----------------------------------------------------------------------------
+
+func (f *metricFamily) saveState() (familyState, bool) {
+	switch f.mt {
+	case CounterType, HistogramType, SummaryType:
+	default:
+		return familyState{}, false
+	}
+
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	st := familyState{
+		ID:     f.desc.calcID(),
+		Name:   f.desc.Name,
+		Unit:   f.desc.Unit,
+		Type:   f.mt.String(),
+		Series: make([]seriesState, 0, len(f.metrics)),
+	}
+	for _, m := range f.metrics {
+		if pm, ok := m.met.(persistentMetric); ok {
+			ss := seriesState{Labels: trimLabelValues(m.lvs)}
+			pm.saveState(&ss)
+			st.Series = append(st.Series, ss)
+		}
+	}
+	return st, true
+}
+
+func (f *metricFamily) restoreState(st *familyState) error {
+	if st.Type != f.mt.String() {
+		return fmt.Errorf("metric %q cannot restore %s state into %s", f.desc.FullName(), st.Type, f.mt)
+	}
+
+	var errs []error
+	for i := range st.Series {
+		ss := &st.Series[i]
+		met, err := f.with(ss.Labels...)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("metric %q: %w", f.desc.FullName(), err))
+			continue
+		}
+
+		pm, ok := met.(persistentMetric)
+		if !ok {
+			continue
+		}
+		if err := pm.restoreState(ss); err != nil {
+			errs = append(errs, fmt.Errorf("metric %q: %w", f.desc.FullName(), err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func trimLabelValues(lvs []string) []string {
+	n := len(lvs)
+	for n > 0 && lvs[n-1] == "" {
+		n--
+	}
+	return lvs[:n]
+}
+
+// ----------------------------------------------------------------------------
+
+func (m *counter) saveState(ss *seriesState) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	ss.Created = m.created.UnixNano()
+	ss.Total = m.total
+}
+
+func (m *counter) restoreState(ss *seriesState) error {
+	if err := counterValidateValue(ss.Total); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.created = time.Unix(0, ss.Created)
+	m.total = ss.Total
+	return nil
+}
+
+func (m *histogram) saveState(ss *seriesState) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	ss.Created = m.created.UnixNano()
+	ss.Count = m.count
+	ss.Sum = m.sum
+	ss.Bounds = m.bounds
+	ss.Buckets = make([]int64, len(m.buckets))
+	for i, b := range m.buckets {
+		ss.Buckets[i] = b.count
+	}
+}
+
+var errHistogramStateBounds = fmt.Errorf("histogram bounds do not match")
+
+func (m *histogram) restoreState(ss *seriesState) error {
+	if len(ss.Bounds) != len(m.bounds) || len(ss.Buckets) != len(m.buckets) {
+		return errHistogramStateBounds
+	}
+	for i, b := range ss.Bounds {
+		if b != m.bounds[i] {
+			return errHistogramStateBounds
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.created = time.Unix(0, ss.Created)
+	m.count = ss.Count
+	m.sum = ss.Sum
+	for i, n := range ss.Buckets {
+		m.buckets[i].count = n
+	}
+	return nil
+}
+
+func (m *summary) saveState(ss *seriesState) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	ss.Created = m.created.UnixNano()
+	ss.Count = m.count
+	ss.Sum = m.sum
+}
+
+func (m *summary) restoreState(ss *seriesState) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.created = time.Unix(0, ss.Created)
+	m.count = ss.Count
+	m.sum = ss.Sum
+	return nil
+}
@@ -0,0 +1,123 @@
+package openmetrics_test
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/bsm/openmetrics"
+)
+
+func TestRegistry_SaveState(t *testing.T) {
+	src := NewConsistentRegistry(mockNow)
+	src.Counter(Desc{Name: "foo", Labels: []string{"a"}}).With("b").Add(3)
+	src.Histogram(Desc{Name: "bar", Unit: "seconds"}, []float64{.1, 1}).With().Observe(0.5)
+	src.Summary(Desc{Name: "baz"}).With().Observe(7)
+	src.Gauge(Desc{Name: "qux"}).With().Set(9)
+
+	var buf bytes.Buffer
+	if err := src.SaveState(&buf); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	later := mockTime.Add(time.Hour)
+	dst := NewConsistentRegistry(func() time.Time { return later })
+	foo := dst.Counter(Desc{Name: "foo", Labels: []string{"a"}})
+	bar := dst.Histogram(Desc{Name: "bar", Unit: "seconds"}, []float64{.1, 1})
+	dst.Summary(Desc{Name: "baz"})
+	dst.Gauge(Desc{Name: "qux"})
+
+	if err := dst.RestoreState(&buf); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	foo.With("b").Add(1)
+	bar.With().Observe(2)
+
+	checkOutput(t, dst, `
+		# TYPE foo counter
+		foo_total{a="b"} 4
+		foo_created{a="b"} 1515151515.757576
+		# TYPE bar_seconds histogram
+		# UNIT bar_seconds seconds
+		bar_seconds_bucket{le="0.1"} 0
+		bar_seconds_bucket{le="1"} 1
+		bar_seconds_bucket{le="+Inf"} 2
+		bar_seconds_count 2
+		bar_seconds_sum 2.5
+		bar_seconds_created 1515151515.757576
+		# TYPE baz summary
+		baz_count 1
+		baz_sum 7
+		baz_created 1515151515.757576
+		# EOF
+	`)
+}
+
+func TestRegistry_RestoreState(t *testing.T) {
+	src := NewConsistentRegistry(mockNow)
+	src.Histogram(Desc{Name: "foo"}, []float64{1, 2}).With().Observe(1.5)
+	src.Counter(Desc{Name: "bar"}).With().Add(2)
+
+	var buf bytes.Buffer
+	if err := src.SaveState(&buf); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	t.Run("mismatching bounds", func(t *testing.T) {
+		dst := NewConsistentRegistry(mockNow)
+		dst.Histogram(Desc{Name: "foo"}, []float64{1, 5})
+		bar := dst.Counter(Desc{Name: "bar"})
+
+		err := dst.RestoreState(bytes.NewReader(buf.Bytes()))
+		if err == nil || err.Error() != `metric "foo": histogram bounds do not match` {
+			t.Fatalf("expected error, got %v", err)
+		}
+		if exp, got := 2.0, bar.With().Total(); exp != got {
+			t.Fatalf("expected %v, got %v", exp, got)
+		}
+	})
+
+	t.Run("mismatching type", func(t *testing.T) {
+		dst := NewConsistentRegistry(mockNow)
+		dst.Summary(Desc{Name: "bar"})
+
+		err := dst.RestoreState(bytes.NewReader(buf.Bytes()))
+		if err == nil || err.Error() != `metric "bar" cannot restore counter state into summary` {
+			t.Fatalf("expected error, got %v", err)
+		}
+	})
+
+	t.Run("bad version", func(t *testing.T) {
+		dst := NewConsistentRegistry(mockNow)
+		err := dst.RestoreState(strings.NewReader(`{"version":99}`))
+		if err == nil || err.Error() != `unsupported state version 99` {
+			t.Fatalf("expected error, got %v", err)
+		}
+	})
+}
+
+func TestRegistry_SaveStateFile(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "state.json")
+
+	src := NewConsistentRegistry(mockNow)
+	src.Counter(Desc{Name: "foo"}).With().Add(5)
+
+	dst := NewConsistentRegistry(mockNow)
+	foo := dst.Counter(Desc{Name: "foo"})
+
+	if err := dst.RestoreStateFile(name); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := src.SaveStateFile(name); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := dst.RestoreStateFile(name); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if exp, got := 5.0, foo.With().Total(); exp != got {
+		t.Fatalf("expected %v, got %v", exp, got)
+	}
+}
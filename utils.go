@@ -1,6 +1,7 @@
 package openmetrics
 
 import (
+	"math"
 	"time"
 	"unicode/utf8"
 )
@@ -47,6 +48,10 @@ func isValidLabelName(s string) bool {
 	return true
 }
 
+func isValidUTF8Name(s string) bool {
+	return s != "" && utf8.ValidString(s)
+}
+
 func isValidLabelValue(s string) bool {
 	return utf8.ValidString(s)
 }
@@ -74,3 +79,8 @@ type uint64Slice []uint64
 func (s uint64Slice) Len() int           { return len(s) }
 func (s uint64Slice) Less(i, j int) bool { return s[i] < s[j] }
 func (s uint64Slice) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+func fromEpoch(e float64) time.Time {
+	sec, frac := math.Modf(e)
+	return time.Unix(int64(sec), int64(math.Round(frac*1e9/1e3)*1e3)).UTC()
+}
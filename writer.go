@@ -27,7 +27,11 @@ func (w *bufferedWriter) WriteIntro(prefix, name, unit, value string, escape boo
 		return
 	}
 
-	n, err = w.writeName(name, unit, "")
+	if isValidMetricName(name) {
+		n, err = w.writeName(name, unit, "")
+	} else {
+		n, err = w.writeQuotedName(name, unit, "")
+	}
 	total += n
 	if err != nil {
 		return
@@ -59,13 +63,17 @@ func (w *bufferedWriter) WriteIntro(prefix, name, unit, value string, escape boo
 func (w *bufferedWriter) WritePoint(name, unit string, lns, lvs []string, pt *MetricPoint) (total int, err error) {
 	var n int
 
-	n, err = w.writeName(name, unit, pt.Suffix.String())
-	total += n
-	if err != nil {
-		return
-	}
+	if isValidMetricName(name) {
+		n, err = w.writeName(name, unit, pt.Suffix.String())
+		total += n
+		if err != nil {
+			return
+		}
 
-	n, err = w.writeLabels(lns, lvs, pt.Label)
+		n, err = w.writeLabels(lns, lvs, pt.Label)
+	} else {
+		n, err = w.writeQuotedSeries(name, unit, pt.Suffix.String(), lns, lvs, pt.Label)
+	}
 	total += n
 	if err != nil {
 		return
@@ -138,6 +146,66 @@ func (w *bufferedWriter) writeName(name, unit, suffix string) (total int, err er
 	return
 }
 
+// writeQuotedName writes a quoted metric name, as required for names which
+// are not valid in OpenMetrics 1.0.
+func (w *bufferedWriter) writeQuotedName(name, unit, suffix string) (total int, err error) {
+	var n int
+
+	if err = w.WriteByte('"'); err != nil {
+		return
+	}
+	total++
+
+	n, err = w.writeEscaped(name)
+	total += n
+	if err != nil {
+		return
+	}
+
+	n, err = w.writeName("", unit, suffix)
+	total += n
+	if err != nil {
+		return
+	}
+
+	if err = w.WriteByte('"'); err != nil {
+		return
+	}
+	total++
+
+	return
+}
+
+// writeQuotedSeries writes a quoted metric name inside the label set, e.g.
+// {"my.name",a="b"}.
+func (w *bufferedWriter) writeQuotedSeries(name, unit, suffix string, lns, lvs []string, extra Label) (total int, err error) {
+	var n int
+
+	if err = w.WriteByte('{'); err != nil {
+		return
+	}
+	total++
+
+	n, err = w.writeQuotedName(name, unit, suffix)
+	total += n
+	if err != nil {
+		return
+	}
+
+	n, err = w.writeLabelPairs(lns, lvs, extra, false)
+	total += n
+	if err != nil {
+		return
+	}
+
+	if err = w.WriteByte('}'); err != nil {
+		return
+	}
+	total++
+
+	return
+}
+
 func (w *bufferedWriter) writeEscaped(s string) (total int, err error) {
 	var n int
 
@@ -208,7 +276,23 @@ func (w *bufferedWriter) writeLabels(lns, lvs []string, extra Label) (total int,
 	}
 	total++
 
-	first := true
+	n, err = w.writeLabelPairs(lns, lvs, extra, true)
+	total += n
+	if err != nil {
+		return
+	}
+
+	if err = w.WriteByte('}'); err != nil {
+		return
+	}
+	total++
+
+	return
+}
+
+func (w *bufferedWriter) writeLabelPairs(lns, lvs []string, extra Label, first bool) (total int, err error) {
+	var n int
+
 	for i, name := range lns {
 		if value := lvs[i]; value != "" {
 			n, err = w.writeLabel(name, value, first)
@@ -228,11 +312,6 @@ func (w *bufferedWriter) writeLabels(lns, lvs []string, extra Label) (total int,
 		}
 	}
 
-	if err = w.WriteByte('}'); err != nil {
-		return
-	}
-	total++
-
 	return
 }
 
@@ -246,7 +325,11 @@ func (w *bufferedWriter) writeLabel(name, value string, first bool) (total int,
 		total++
 	}
 
-	n, err = w.WriteString(name)
+	if isValidLabelName(name) {
+		n, err = w.WriteString(name)
+	} else {
+		n, err = w.writeQuotedName(name, "", "")
+	}
 	total += n
 	if err != nil {
 		return